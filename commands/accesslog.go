@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Wrap the given handler to print the method, path, status and duration of each request,
+// e.g. to find out which assets the browser requests and which are missing.
+// The live reload event streams are left out, since they stay open for as long as the page.
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/_events/") {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+		handler.ServeHTTP(recorder, req)
+		fmt.Printf("%s %s %d %s\n", req.Method, req.URL.RequestURI(), recorder.status, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+// A response writer that keeps the status code sent by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Pass the connection through to the wrapped writer, e.g. for websocket upgrades of proxied requests.
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		// the handler writes the response to the connection directly
+		recorder.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Return the wrapped writer, for http.ResponseController.
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
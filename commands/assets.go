@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/facundoolano/jorge/config"
+	"github.com/facundoolano/jorge/markup"
+)
+
+// The directory, relative to the target dir, checked for unused files by the asset audit.
+const ASSETS_DIR = "assets"
+
+// The extensions of the output files searched for the names of assets, since they may reference them
+// in ways that can't be parsed, e.g. scripts fetching data files or manifests listing icons.
+var ASSET_NAME_SEARCH_EXTS = []string{".js", ".mjs", ".json", ".webmanifest", ".xml", ".txt", ".svg"}
+
+type CheckAssets struct {
+	ProjectDir string `arg:"" name:"path" optional:"" default:"." help:"Path to the website project."`
+}
+
+// A script or stylesheet referenced by a page that's missing from the output.
+type missingAsset struct {
+	path string
+	page string
+}
+
+// Inspect the built site and print the files in the assets dir that aren't referenced by any page or
+// stylesheet, nor mentioned by name in scripts and data files, along with the scripts and stylesheets
+// referenced by pages that aren't in the output, since they tend to accumulate unnoticed.
+func (cmd *CheckAssets) Run(ctx *kong.Context) error {
+	config, err := config.Load(cmd.ProjectDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(config.TargetDir); os.IsNotExist(err) {
+		return fmt.Errorf("missing target directory, run jorge build first")
+	}
+
+	assets, unused, missing, err := auditAssets(config)
+	if err != nil {
+		return err
+	}
+	for _, asset := range unused {
+		fmt.Printf("unused asset /%s\n", asset)
+	}
+	for _, asset := range missing {
+		fmt.Printf("missing asset /%s, referenced by /%s\n", asset.path, asset.page)
+	}
+	fmt.Printf("%d assets checked, %d unused, %d missing references\n", len(assets), len(unused), len(missing))
+	return nil
+}
+
+// Walk the target dir and return the paths of the asset files, the unused ones and the missing references.
+func auditAssets(config *config.Config) ([]string, []string, []missingAsset, error) {
+	var assets []string
+	referenced := make(map[string]bool)
+	var missing []missingAsset
+	var searchable bytes.Buffer
+
+	err := filepath.WalkDir(config.TargetDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relPath, _ := filepath.Rel(config.TargetDir, filePath)
+		relPath = filepath.ToSlash(relPath)
+		if strings.HasPrefix(relPath, ASSETS_DIR+"/") {
+			assets = append(assets, relPath)
+		}
+
+		ext := filepath.Ext(relPath)
+		var references []markup.AssetReference
+		switch {
+		case ext == ".html" || ext == ".css":
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			if ext == ".html" {
+				references = markup.AssetReferences(bytes.NewReader(content))
+			} else {
+				references = markup.StylesheetReferences(string(content))
+			}
+		case slices.Contains(ASSET_NAME_SEARCH_EXTS, ext):
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			searchable.Write(content)
+			searchable.WriteByte('\n')
+		}
+
+		for _, reference := range references {
+			target, ok := localTargetPath(config, relPath, reference.Url)
+			if !ok {
+				continue
+			}
+			referenced[target] = true
+			if reference.Required && !targetExists(config, target) {
+				missing = append(missing, missingAsset{path: target, page: relPath})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var unused []string
+	slices.Sort(assets)
+	for _, asset := range assets {
+		if !referenced[asset] && !bytes.Contains(searchable.Bytes(), []byte(path.Base(asset))) {
+			unused = append(unused, asset)
+		}
+	}
+	slices.SortFunc(missing, func(a missingAsset, b missingAsset) int {
+		return strings.Compare(a.page+a.path, b.page+b.path)
+	})
+	return assets, unused, missing, nil
+}
+
+// Return true if there's an output file at the given path relative to the target dir,
+// or an index file if it's a directory.
+func targetExists(config *config.Config, relPath string) bool {
+	info, err := os.Stat(filepath.Join(config.TargetDir, filepath.FromSlash(relPath)))
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		_, err = os.Stat(filepath.Join(config.TargetDir, filepath.FromSlash(relPath), "index.html"))
+		return err == nil
+	}
+	return true
+}
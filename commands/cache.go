@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/kong"
+	"github.com/facundoolano/jorge/markup"
+)
+
+type Cache struct {
+	Export CacheExport `cmd:"" help:"Save the build cache to a tar.gz file, e.g. to restore it in another CI run."`
+	Import CacheImport `cmd:"" help:"Restore the build cache from a tar.gz file created with cache export."`
+}
+
+type CacheExport struct {
+	File string `arg:"" help:"Path of the tar.gz file to create."`
+}
+
+type CacheImport struct {
+	File string `arg:"" type:"existingfile" help:"Path of the tar.gz file to restore."`
+}
+
+// Write the contents of the cache dir to a gzipped tarball.
+func (cmd *CacheExport) Run(ctx *kong.Context) error {
+	cacheDir, err := markup.CacheDir()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(cmd.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+
+	count := 0
+	err = filepath.WalkDir(cacheDir, func(path string, entry fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == cacheDir {
+			// nothing cached yet
+			return filepath.SkipDir
+		} else if err != nil || entry.IsDir() {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(cacheDir, path)
+		header.Name = filepath.ToSlash(relPath)
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.Copy(archive, src); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("exported %d files from %s\n", count, cacheDir)
+	return nil
+}
+
+// Extract the given tarball into the cache dir, overwriting the files already present.
+func (cmd *CacheImport) Run(ctx *kong.Context) error {
+	cacheDir, err := markup.CacheDir()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(cmd.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewReader(gz)
+
+	count := 0
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// don't let malformed archives write outside of the cache dir
+		relPath := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(relPath) {
+			return fmt.Errorf("invalid cache file path %s", header.Name)
+		}
+		path := filepath.Join(cacheDir, relPath)
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		// replaced atomically, since a running build may be reading the cache
+		if err := markup.WriteCacheFile(path, content); err != nil {
+			return err
+		}
+		count++
+	}
+	fmt.Printf("imported %d files into %s\n", count, cacheDir)
+	return nil
+}
@@ -0,0 +1,290 @@
+package commands
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/kong"
+	"github.com/facundoolano/jorge/config"
+	"github.com/facundoolano/jorge/markup"
+	"golang.org/x/net/html"
+)
+
+// Titles longer than this are usually truncated in search results.
+const SEO_MAX_TITLE_LENGTH = 60
+
+const (
+	PRIORITY_HIGH = iota
+	PRIORITY_MEDIUM
+	PRIORITY_LOW
+)
+
+var priorityNames = []string{"high", "medium", "low"}
+
+type Check struct {
+	Seo    CheckSeo    `cmd:"" name:"seo" help:"Audit the built website for common SEO problems."`
+	Assets CheckAssets `cmd:"" name:"assets" help:"Report the unused files in assets and the references to missing scripts and stylesheets."`
+}
+
+type CheckSeo struct {
+	ProjectDir string `arg:"" name:"path" optional:"" default:"." help:"Path to the website project."`
+}
+
+type seoIssue struct {
+	priority int
+	url      string
+	message  string
+}
+
+// The SEO relevant data extracted from a built html page.
+type seoPage struct {
+	url         string
+	title       string
+	description string
+	canonical   bool
+	noAltImages int
+	links       []string
+}
+
+// Inspect the html files in the target directory, reporting missing or duplicated titles and descriptions,
+// long titles, missing canonical links, images without alt text and linked pages excluded from the sitemap.
+// The issues are printed sorted by priority.
+func (cmd *CheckSeo) Run(ctx *kong.Context) error {
+	config, err := config.Load(cmd.ProjectDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(config.TargetDir); os.IsNotExist(err) {
+		return fmt.Errorf("missing target directory, run jorge build first")
+	}
+
+	var pages []seoPage
+	err = filepath.WalkDir(config.TargetDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(filePath) != ".html" {
+			return err
+		}
+		relPath, _ := filepath.Rel(config.TargetDir, filePath)
+		page, err := parseSeoPage(config, filePath, filepath.ToSlash(relPath))
+		if err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		pages = append(pages, *page)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sitemap, err := loadSitemapPaths(filepath.Join(config.TargetDir, "sitemap.xml"))
+	if err != nil {
+		return err
+	}
+
+	issues := auditPages(pages, sitemap)
+	slices.SortStableFunc(issues, func(a seoIssue, b seoIssue) int {
+		if a.priority != b.priority {
+			return a.priority - b.priority
+		}
+		return strings.Compare(a.url, b.url)
+	})
+
+	for _, issue := range issues {
+		fmt.Printf("[%s] %s: %s\n", priorityNames[issue.priority], issue.url, issue.message)
+	}
+	fmt.Printf("%d pages checked, %d issues found\n", len(pages), len(issues))
+	return nil
+}
+
+// Check each page and the site as a whole for SEO issues.
+// The sitemap paths are nil if the site doesn't have one, in which case it's not checked.
+func auditPages(pages []seoPage, sitemap map[string]bool) []seoIssue {
+	var issues []seoIssue
+	titles := make(map[string][]string)
+	descriptions := make(map[string][]string)
+	linked := make(map[string]bool)
+
+	for _, page := range pages {
+		if page.title == "" {
+			issues = append(issues, seoIssue{PRIORITY_HIGH, page.url, "missing title"})
+		} else {
+			titles[page.title] = append(titles[page.title], page.url)
+			if length := utf8.RuneCountInString(page.title); length > SEO_MAX_TITLE_LENGTH {
+				msg := fmt.Sprintf("title is too long (%d characters, max %d)", length, SEO_MAX_TITLE_LENGTH)
+				issues = append(issues, seoIssue{PRIORITY_LOW, page.url, msg})
+			}
+		}
+
+		if page.description == "" {
+			issues = append(issues, seoIssue{PRIORITY_MEDIUM, page.url, "missing meta description"})
+		} else {
+			descriptions[page.description] = append(descriptions[page.description], page.url)
+		}
+
+		if !page.canonical {
+			issues = append(issues, seoIssue{PRIORITY_LOW, page.url, "missing canonical link"})
+		}
+
+		if page.noAltImages > 0 {
+			msg := fmt.Sprintf("%d images without alt text", page.noAltImages)
+			issues = append(issues, seoIssue{PRIORITY_MEDIUM, page.url, msg})
+		}
+
+		for _, link := range page.links {
+			linked[link] = true
+		}
+	}
+
+	issues = append(issues, duplicateIssues(titles, "title", PRIORITY_MEDIUM)...)
+	issues = append(issues, duplicateIssues(descriptions, "meta description", PRIORITY_LOW)...)
+
+	if sitemap != nil {
+		for _, page := range pages {
+			if linked[page.url] && !sitemap[page.url] {
+				issues = append(issues, seoIssue{PRIORITY_MEDIUM, page.url, "linked from other pages but excluded from the sitemap"})
+			}
+		}
+	}
+
+	return issues
+}
+
+// Report the pages that repeat a value already used by another page, from a value -> urls map.
+func duplicateIssues(pagesByValue map[string][]string, name string, priority int) []seoIssue {
+	var issues []seoIssue
+	for _, urls := range pagesByValue {
+		slices.Sort(urls)
+		for _, url := range urls[1:] {
+			issues = append(issues, seoIssue{priority, url, fmt.Sprintf("%s duplicated from %s", name, urls[0])})
+		}
+	}
+	return issues
+}
+
+// Parse the html file at the given path, with the given path relative to the target dir,
+// extracting the data needed for the SEO audit.
+func parseSeoPage(config *config.Config, filePath string, relPath string) (*seoPage, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	doc, err := html.Parse(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sitemap and the links of the pages include the base url
+	page := seoPage{url: normalizeUrlPath(config.BaseUrl + "/" + relPath)}
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.Data {
+			case "title":
+				if node.FirstChild != nil {
+					page.title = strings.TrimSpace(node.FirstChild.Data)
+				}
+			case "meta":
+				if markup.GetAttribute(node, "name") == "description" {
+					page.description = strings.TrimSpace(markup.GetAttribute(node, "content"))
+				}
+			case "link":
+				if markup.GetAttribute(node, "rel") == "canonical" && markup.GetAttribute(node, "href") != "" {
+					page.canonical = true
+				}
+			case "img":
+				if strings.TrimSpace(markup.GetAttribute(node, "alt")) == "" {
+					page.noAltImages++
+				}
+			case "a":
+				if target, ok := localTargetPath(config, relPath, markup.GetAttribute(node, "href")); ok {
+					page.links = append(page.links, normalizeUrlPath(config.BaseUrl+"/"+target))
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(doc)
+	return &page, nil
+}
+
+// Return the path relative to the target dir of the local file referenced by the given url
+// in the output file at the given path, also relative to the target dir, or false if it's not local.
+// Absolute urls are local if they point to the site host, and root-relative ones if they are under its base url.
+func localTargetPath(config *config.Config, relPath string, reference string) (string, bool) {
+	parsed, err := url.Parse(reference)
+	if err != nil || parsed.Path == "" || parsed.Opaque != "" {
+		return "", false
+	}
+	if parsed.Host != "" {
+		siteUrl, err := url.Parse(config.SiteUrl)
+		if err != nil || parsed.Host != siteUrl.Host {
+			return "", false
+		}
+	} else if parsed.Scheme != "" {
+		// e.g. data: or mailto: urls
+		return "", false
+	}
+
+	target := parsed.Path
+	if strings.HasPrefix(target, "/") {
+		if config.BaseUrl != "" {
+			trimmed, found := strings.CutPrefix(target, config.BaseUrl+"/")
+			if !found {
+				return "", false
+			}
+			target = "/" + trimmed
+		}
+	} else {
+		target = path.Join("/", path.Dir(relPath), target)
+	}
+	return strings.TrimPrefix(path.Clean(target), "/"), true
+}
+
+// Return the paths of the urls listed in the sitemap file, normalized, or nil if there's no sitemap.
+func loadSitemapPaths(sitemapPath string) (map[string]bool, error) {
+	content, err := os.ReadFile(sitemapPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sitemap struct {
+		Urls []struct {
+			Loc string `xml:"loc"`
+		} `xml:"url"`
+	}
+	if err := xml.Unmarshal(content, &sitemap); err != nil {
+		return nil, fmt.Errorf("%s: %w", sitemapPath, err)
+	}
+
+	paths := make(map[string]bool)
+	for _, entry := range sitemap.Urls {
+		if loc, err := url.Parse(strings.TrimSpace(entry.Loc)); err == nil {
+			paths[normalizeUrlPath(loc.Path)] = true
+		}
+	}
+	return paths, nil
+}
+
+// Strip the index.html, .html extension and trailing slash of the given url path,
+// so the different urls of a page can be compared.
+func normalizeUrlPath(urlPath string) string {
+	urlPath = strings.TrimSuffix(urlPath, "index.html")
+	urlPath = strings.TrimSuffix(urlPath, ".html")
+	urlPath = strings.TrimSuffix(urlPath, "/")
+	if urlPath == "" {
+		return "/"
+	}
+	return urlPath
+}
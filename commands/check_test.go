@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/facundoolano/jorge/config"
+)
+
+func TestAuditPages(t *testing.T) {
+	pages := []seoPage{
+		// 40 characters, but more than 60 bytes
+		{url: "/blog/ñandú", title: strings.Repeat("ñandú ", 6) + "ñand", description: "a", canonical: true},
+		{url: "/blog/long", title: strings.Repeat("a", 61), description: "b", canonical: true, links: []string{"/blog/ñandú"}},
+	}
+	sitemap := map[string]bool{"/blog/long": true}
+
+	issues := auditPages(pages, sitemap)
+	assertEqual(t, len(issues), 2)
+	for _, issue := range issues {
+		switch issue.url {
+		case "/blog/long":
+			assertEqual(t, issue.message, "title is too long (61 characters, max 60)")
+		case "/blog/ñandú":
+			assertEqual(t, issue.message, "linked from other pages but excluded from the sitemap")
+		default:
+			t.Fatalf("unexpected issue %v", issue)
+		}
+	}
+}
+
+func TestAuditAssets(t *testing.T) {
+	conf := &config.Config{TargetDir: t.TempDir(), SiteUrl: "https://olano.dev"}
+	assetsDir := filepath.Join(conf.TargetDir, "assets")
+	os.MkdirAll(filepath.Join(assetsDir, "fonts"), DIR_RWE_MODE)
+	writeTarget := func(dir string, name string, content string) {
+		assertEqual(t, os.WriteFile(filepath.Join(dir, name), []byte(content), FILE_RW_MODE), nil)
+	}
+	writeTarget(assetsDir, "main.css", "@font-face { src: url(fonts/serif.woff2) }")
+	writeTarget(filepath.Join(assetsDir, "fonts"), "serif.woff2", "")
+	writeTarget(assetsDir, "search.js", "fetch('/assets/index.json')")
+	writeTarget(assetsDir, "index.json", "[]")
+	writeTarget(assetsDir, "logo.png", "")
+	writeTarget(assetsDir, "old.css", "")
+	writeTarget(conf.TargetDir, "index.html", `<html><head><link rel="stylesheet" href="/assets/main.css">
+<script src="/assets/search.js"></script><script src="https://olano.dev/assets/missing.js"></script>
+</head><body><img src="assets/logo.png"><a href="https://example.com/assets/old.css">old</a></body></html>`)
+
+	assets, unused, missing, err := auditAssets(conf)
+	assertEqual(t, err, nil)
+	assertEqual(t, len(assets), 6)
+	assertEqual(t, strings.Join(unused, ","), "assets/old.css")
+	assertEqual(t, len(missing), 1)
+	assertEqual(t, missing[0], missingAsset{path: "assets/missing.js", page: "index.html"})
+}
+
+func TestLocalTargetPath(t *testing.T) {
+	conf := &config.Config{SiteUrl: "https://olano.dev/blog", BaseUrl: "/blog"}
+	cases := map[string]string{
+		"/blog/assets/main.css":              "assets/main.css",
+		"https://olano.dev/blog/about/":      "about",
+		"../img/photo.png?size=2":            "posts/img/photo.png",
+		"other.html#section":                 "posts/hello/other.html",
+		"/other/main.css":                    "",
+		"https://example.com/blog/main.css":  "",
+		"mailto:someone@olano.dev":           "",
+		"data:image/png;base64,iVBORw0KGgo=": "",
+		"#top":                               "",
+	}
+	for reference, expected := range cases {
+		target, ok := localTargetPath(conf, "posts/hello/index.html", reference)
+		assertEqual(t, ok, expected != "")
+		assertEqual(t, target, expected)
+	}
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"github.com/alecthomas/kong"
+)
+
+// The jorge command line interface, as parsed by kong.
+type CLI struct {
+	Init         Init             `cmd:"" help:"Initialize a new website project." aliases:"i"`
+	Build        Build            `cmd:"" help:"Build a website project." aliases:"b"`
+	Post         Post             `cmd:"" help:"Initialize a new post template file." aliases:"p"`
+	Serve        Serve            `cmd:"" help:"Run a local server for the website." aliases:"s"`
+	Meta         Meta             `cmd:"" help:"Get the JSON results from evaluating a liquid template expression within the site context." aliases:"m"`
+	HighlightCSS HighlightCSS     `cmd:"" name:"highlight-css" help:"Print the stylesheet for a syntax highlighting theme."`
+	I18n         I18n             `cmd:"" name:"i18n" help:"Manage the translations of a multilingual website."`
+	Check        Check            `cmd:"" help:"Audit the built website."`
+	Cache        Cache            `cmd:"" help:"Manage the build cache."`
+	Migrate      Migrate          `cmd:"" help:"Update a website project to the conventions of this jorge version."`
+	History      History          `cmd:"" help:"Show the log of past builds, recorded when build_history is set in config.yml."`
+	Version      kong.VersionFlag `short:"v"`
+	ListThemes   ListThemesFlag   `help:"List the available syntax highlighting themes. The highlight_theme config can also point to a chroma XML or CSS style file."`
+}
+
+// the subcommands added with Register, passed to kong as dynamic commands
+var registered []kong.Option
+
+// Add a subcommand to the CLI, for binaries derived from jorge to extend it with their own commands,
+// e.g. a deploy flow or a content importer. As with the built-in ones, `cmd` is a pointer to a struct
+// with kong tags and a Run method, which can embed or call the exported commands to reuse them, e.g.:
+//
+//	func (cmd *Deploy) Run(ctx *kong.Context) error {
+//		build := commands.Build{ProjectDir: cmd.ProjectDir}
+//		if err := build.Run(ctx); err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// It should be called before Main, usually from an init function.
+func Register(name string, help string, cmd interface{}) {
+	registered = append(registered, kong.DynamicCommand(name, help, "", cmd))
+}
+
+// Parse the command line arguments and run the selected command, exiting on errors.
+// The given options are passed to kong after the default ones, e.g. kong.Vars to set the version.
+func Main(options ...kong.Option) {
+	var cli CLI
+	options = append([]kong.Option{
+		kong.UsageOnError(),
+		kong.HelpOptions{FlagsLast: true},
+	}, append(registered, options...)...)
+
+	ctx := kong.Parse(&cli, options...)
+	err := ctx.Run()
+	ctx.FatalIfErrorf(err)
+}
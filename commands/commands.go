@@ -2,13 +2,18 @@ package commands
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/facundoolano/jorge/config"
+	"github.com/facundoolano/jorge/markup"
 	"github.com/facundoolano/jorge/site"
 )
 
@@ -16,25 +21,86 @@ const FILE_RW_MODE = 0666
 const DIR_RWE_MODE = 0777
 
 type Build struct {
-	ProjectDir string `arg:"" name:"path" optional:"" default:"." help:"Path to the website project to build."`
-	NoMinify   bool   `help:"Disable file minifying."`
+	ProjectDir string   `arg:"" name:"path" optional:"" default:"." help:"Path to the website project to build."`
+	NoMinify   bool     `help:"Disable file minifying."`
+	Strict     bool     `help:"Fail when a template outputs an undefined variable."`
+	Committed  bool     `name:"committed-only" help:"Skip posts that aren't committed to the git repository."`
+	Watch      bool     `short:"w" help:"Keep running and rebuild the site when the project files change, e.g. to serve it with another web server."`
+	Poll       pollFlag `placeholder:"INTERVAL" help:"With --watch, poll for file changes, every second or the given interval, e.g. --poll=2s."`
+	Env        string   `placeholder:"ENV" help:"Load the config.<env>.yml overlay of the given environment instead of the prod one. Defaults to the JORGE_ENV variable."`
+	Set        []string `placeholder:"KEY=VALUE" sep:"none" help:"Override a config key, e.g. --set highlight_theme=monokai. Can be repeated."`
+	Url        string   `name:"url" env:"JORGE_URL" placeholder:"URL" help:"Override the site url from config.yml, e.g. for staging and preview deployments. A path in the url replaces the baseurl."`
+	Localize   bool     `name:"localize-remote" help:"Download the remote images and media embedded in pages and serve them from the site."`
+	Profile    bool     `name:"profile-memory" help:"Print the peak RSS, the heap allocations of each build phase and the largest pages."`
 }
 
 // Read the files in src/ render them and copy the result to target/
 func (cmd *Build) Run(ctx *kong.Context) error {
 	start := time.Now()
 
-	config, err := config.Load(cmd.ProjectDir)
+	config, err := cmd.loadConfig()
 	if err != nil {
 		return err
 	}
-	config.Minify = !cmd.NoMinify
+	if cmd.Watch {
+		return cmd.watch(config)
+	}
 
-	err = site.Build(*config)
+	if cmd.Profile {
+		err = profileBuild(config)
+	} else {
+		err = site.Build(*config)
+	}
 	fmt.Printf("done in %.2fs\n", time.Since(start).Seconds())
+	if config.BuildHistory {
+		if historyErr := appendHistory(config, config.Env, start, err); historyErr != nil {
+			fmt.Println("couldn't update the build history:", historyErr)
+		}
+	}
 	return err
 }
 
+func (cmd *Build) loadConfig() (*config.Config, error) {
+	config, err := config.LoadEnv(cmd.ProjectDir, cmd.Env, cmd.Set)
+	if err != nil {
+		return nil, err
+	}
+	config.Minify = !cmd.NoMinify
+	config.StrictVariables = config.StrictVariables || cmd.Strict
+	config.CommittedOnly = config.CommittedOnly || cmd.Committed
+	config.LocalizeRemoteAssets = config.LocalizeRemoteAssets || cmd.Localize
+	if cmd.Url != "" {
+		if err := config.OverrideSiteUrl(cmd.Url); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// Build the site and rebuild it on changes, as the serve command does, until interrupted.
+func (cmd *Build) watch(config *config.Config) error {
+	if _, err := os.Stat(config.SrcDir); os.IsNotExist(err) {
+		return fmt.Errorf("missing src directory")
+	}
+
+	// there are no live reload clients, but the broker is used to publish the build results
+	broker := newEventBroker()
+	status := &buildStatus{State: BUILD_BUILDING}
+	status.onChange = makeBuildNotifier(config.SiteUrl, config.NotifyDesktop, config.NotifyWebhook)
+	stopWatcher, err := runWatcher(config, cmd.loadConfig, broker, status, time.Duration(cmd.Poll))
+	if err != nil {
+		return err
+	}
+
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-interrupted.Done()
+	// a second interrupt kills the process right away
+	stop()
+	stopWatcher()
+	return nil
+}
+
 // Prompt the user for a string value
 func Prompt(label string) string {
 	// https://dev.to/tidalcloud/interactive-cli-prompts-in-go-3bj9
@@ -50,6 +116,46 @@ func Prompt(label string) string {
 	return strings.TrimSpace(s)
 }
 
+type ListThemesFlag bool
+
+// Print the names of the available syntax highlighting themes and exit.
+func (flag ListThemesFlag) BeforeReset(app *kong.Kong) error {
+	for _, theme := range markup.HighlightThemes() {
+		fmt.Fprintln(app.Stdout, theme)
+	}
+	app.Exit(0)
+	return nil
+}
+
+type HighlightCSS struct {
+	Theme string `arg:"" optional:"" help:"Highlighting theme, defaults to the one in the project config."`
+	Dark  string `help:"Theme to use when the browser prefers a dark color scheme."`
+}
+
+// Print the stylesheet for a syntax highlighting theme, to be used with the highlight_classes config.
+// Without arguments, the themes from the project config are used.
+func (cmd *HighlightCSS) Run(ctx *kong.Context) error {
+	theme, dark := cmd.Theme, cmd.Dark
+	if theme == "" {
+		config, err := config.Load(".")
+		if err != nil {
+			return err
+		}
+		theme = config.HighlightTheme
+		if dark == "" {
+			dark = config.HighlightThemeDark
+		}
+		for _, name := range []*string{&theme, &dark} {
+			if markup.IsHighlightThemeFile(*name) {
+				if *name, err = markup.LoadHighlightTheme(filepath.Join(config.RootDir, *name)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return markup.WriteHighlightCSS(os.Stdout, theme, dark)
+}
+
 type Meta struct {
 	Expression string `arg:"" name:"expression" default:"site" help:"liquid expression to be evaluated (what goes inside of {{ ... }} in templates)"`
 }
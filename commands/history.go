@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/facundoolano/jorge/config"
+)
+
+// The build log file, relative to the project root.
+const HISTORY_PATH = ".jorge/history.jsonl"
+
+type History struct {
+	ProjectDir string `arg:"" name:"path" optional:"" default:"." help:"Path to the website project."`
+	Limit      int    `short:"n" default:"20" help:"Number of most recent entries to show, 0 for all."`
+	File       string `help:"Only show the builds where the given project file, e.g. src/blog/hello.md, had changed."`
+}
+
+// An entry of the build history log.
+type historyEntry struct {
+	Time     time.Time `json:"time"`
+	Duration float64   `json:"duration"`
+	Env      string    `json:"env"`
+	Error    string    `json:"error,omitempty"`
+	// the number of project files modified since the previous entry, and their paths relative to the project root.
+	// The paths are left out for the first build, when all files count as changed.
+	ChangedCount int      `json:"changed_count"`
+	Changed      []string `json:"changed,omitempty"`
+}
+
+// Append an entry for a build that started at the given time to the project history log.
+func appendHistory(config *config.Config, env string, start time.Time, buildErr error) error {
+	path := filepath.Join(config.RootDir, HISTORY_PATH)
+	since, err := lastHistoryTime(path)
+	if err != nil {
+		return err
+	}
+
+	entry := historyEntry{
+		Time:     start.UTC(),
+		Duration: time.Since(start).Round(time.Millisecond).Seconds(),
+		Env:      env,
+	}
+	if buildErr != nil {
+		entry.Error = buildErr.Error()
+	}
+	changed, err := changedProjectFiles(config, since)
+	if err != nil {
+		return err
+	}
+	entry.ChangedCount = len(changed)
+	if !since.IsZero() {
+		entry.Changed = changed
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), DIR_RWE_MODE); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, FILE_RW_MODE)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%s\n", line)
+	return err
+}
+
+// Return the paths, relative to the project root, of the project source files modified after the given time.
+func changedProjectFiles(config *config.Config, since time.Time) ([]string, error) {
+	changed := []string{}
+	dirs := []string{config.SrcDir, config.LayoutsDir, config.IncludesDir, config.DataDir, config.ShortcodesDir, config.StaticDir}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			} else if err != nil {
+				return err
+			} else if config.IsIgnored(path, entry.IsDir()) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			} else if entry.IsDir() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if info.ModTime().After(since) {
+				relPath, _ := filepath.Rel(config.RootDir, path)
+				changed = append(changed, filepath.ToSlash(relPath))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
+
+// Return the time of the last entry of the history log, reading the file backwards up to its last line,
+// or the zero time if the log is empty or the last entry is invalid.
+func lastHistoryTime(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	const chunkSize = 4096
+	var line []byte
+	for offset := info.Size(); offset > 0; {
+		size := min(chunkSize, offset)
+		offset -= size
+		chunk := make([]byte, size)
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return time.Time{}, err
+		}
+		line = bytes.TrimRight(append(chunk, line...), "\n")
+		if start := bytes.LastIndexByte(line, '\n'); start >= 0 {
+			line = line[start+1:]
+			break
+		}
+	}
+
+	var entry historyEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		// count every file as changed, the next entry will be valid
+		return time.Time{}, nil
+	}
+	return entry.Time, nil
+}
+
+func readHistory(path string) ([]historyEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 10*1024*1024)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid history entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Print the most recent entries of the build history log.
+func (cmd *History) Run(ctx *kong.Context) error {
+	entries, err := readHistory(filepath.Join(cmd.ProjectDir, HISTORY_PATH))
+	if err != nil {
+		return err
+	}
+	if cmd.File != "" {
+		file := filepath.ToSlash(filepath.Clean(cmd.File))
+		entries = slices.DeleteFunc(entries, func(entry historyEntry) bool {
+			return !slices.Contains(entry.Changed, file)
+		})
+	}
+	if len(entries) == 0 {
+		fmt.Println("no builds recorded, set build_history: true in config.yml to record them")
+		return nil
+	}
+	if cmd.Limit > 0 && len(entries) > cmd.Limit {
+		entries = entries[len(entries)-cmd.Limit:]
+	}
+
+	for _, entry := range entries {
+		status := "ok"
+		if entry.Error != "" {
+			status = "failed"
+		}
+		fmt.Printf("%s  %-4s  %6.2fs  %-6s  %d changed\n",
+			entry.Time.Local().Format(time.DateTime), entry.Env, entry.Duration, status, entry.ChangedCount)
+	}
+	return nil
+}
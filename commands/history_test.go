@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastHistoryTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	since, err := lastHistoryTime(path)
+	assertEqual(t, err, nil)
+	assert(t, since.IsZero())
+
+	// only the last line is parsed, so invalid entries before it are ignored
+	long := `{"time":"2024-01-01T10:00:00Z","changed":["` + strings.Repeat("a", 5000) + `"]}`
+	os.WriteFile(path, []byte("not json\n"+long+"\n"), FILE_RW_MODE)
+	since, err = lastHistoryTime(path)
+	assertEqual(t, err, nil)
+	assertEqual(t, since, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+
+	// an invalid last entry counts all files as changed
+	os.WriteFile(path, []byte(long+"\n{\"time\":"), FILE_RW_MODE)
+	since, err = lastHistoryTime(path)
+	assertEqual(t, err, nil)
+	assert(t, since.IsZero())
+}
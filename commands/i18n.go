@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/facundoolano/jorge/config"
+	"github.com/facundoolano/jorge/markup"
+	"gopkg.in/yaml.v3"
+)
+
+type I18n struct {
+	Status   I18nStatus   `cmd:"" help:"Report missing and outdated translations for each of the site languages."`
+	Scaffold I18nScaffold `cmd:"" help:"Create draft translations of the default language files missing in another language."`
+}
+
+type I18nStatus struct {
+	ProjectDir string `arg:"" name:"path" optional:"" default:"." help:"Path to the website project."`
+}
+
+// Compare the files in the directory of the site default language (the first one in the `languages`
+// config) with those of each other language, listing the files that are missing a translation
+// and those that were modified after their translation.
+func (cmd *I18nStatus) Run(ctx *kong.Context) error {
+	config, err := config.Load(cmd.ProjectDir)
+	if err != nil {
+		return err
+	}
+	if len(config.Languages) < 2 {
+		return fmt.Errorf("at least two languages should be listed in the `languages` config key")
+	}
+
+	defaultLang := config.Languages[0]
+	sources, err := listLanguageFiles(filepath.Join(config.SrcDir, defaultLang))
+	if err != nil {
+		return err
+	}
+
+	for _, lang := range config.Languages[1:] {
+		var missing, stale []string
+		for relPath, srcInfo := range sources {
+			info, err := os.Stat(filepath.Join(config.SrcDir, lang, relPath))
+			if os.IsNotExist(err) {
+				missing = append(missing, relPath)
+			} else if err != nil {
+				return err
+			} else if info.ModTime().Before(srcInfo.ModTime()) {
+				stale = append(stale, relPath)
+			}
+		}
+
+		translated := len(sources) - len(missing)
+		coverage := 100.0
+		if len(sources) > 0 {
+			coverage = float64(translated) / float64(len(sources)) * 100
+		}
+		fmt.Printf("%s: %.0f%% translated (%d/%d), %d outdated\n", lang, coverage, translated, len(sources), len(stale))
+		printSorted("missing", missing)
+		printSorted("outdated", stale)
+	}
+	return nil
+}
+
+// Return the non hidden files in the given directory, by their path relative to it.
+func listLanguageFiles(dir string) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			relPath, _ := filepath.Rel(dir, path)
+			files[relPath] = info
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("missing default language directory %s", dir)
+	}
+	return files, err
+}
+
+type I18nScaffold struct {
+	Lang       string `arg:"" help:"Language to scaffold the missing translations for."`
+	ProjectDir string `arg:"" name:"path" optional:"" default:"." help:"Path to the website project."`
+	Translate  string `help:"Pre-fill the titles and content with a machine translation provider (deepl or libretranslate), configured via environment variables." enum:",deepl,libretranslate" default:""`
+}
+
+// Copy each template of the default language directory that is missing in the given language
+// directory, marking it as draft so it's not published before being reviewed.
+// Static files are left out, since they are usually shared between languages.
+func (cmd *I18nScaffold) Run(ctx *kong.Context) error {
+	config, err := config.Load(cmd.ProjectDir)
+	if err != nil {
+		return err
+	}
+	if len(config.Languages) < 2 {
+		return fmt.Errorf("at least two languages should be listed in the `languages` config key")
+	}
+	defaultLang := config.Languages[0]
+	if cmd.Lang == defaultLang || !slices.Contains(config.Languages, cmd.Lang) {
+		return fmt.Errorf("'%s' is not one of the translated languages listed in the `languages` config key", cmd.Lang)
+	}
+
+	var provider translator
+	if cmd.Translate != "" {
+		if provider, err = newTranslator(cmd.Translate); err != nil {
+			return err
+		}
+	}
+
+	sources, err := listLanguageFiles(filepath.Join(config.SrcDir, defaultLang))
+	if err != nil {
+		return err
+	}
+	var relPaths []string
+	for relPath := range sources {
+		relPaths = append(relPaths, relPath)
+	}
+	slices.Sort(relPaths)
+	for _, relPath := range relPaths {
+		srcPath := filepath.Join(config.SrcDir, defaultLang, relPath)
+		targetPath := filepath.Join(config.SrcDir, cmd.Lang, relPath)
+		if _, err := os.Stat(targetPath); err == nil {
+			continue
+		}
+
+		content, err := os.ReadFile(srcPath)
+		if err != nil {
+			return err
+		}
+		frontMatter, body, ok := splitFrontMatter(string(content))
+		if !ok {
+			continue
+		}
+
+		scaffold, err := scaffoldTranslation(frontMatter, body, defaultLang, cmd.Lang, provider)
+		if err != nil {
+			return fmt.Errorf("failed to scaffold %s: %w", srcPath, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(targetPath), DIR_RWE_MODE); err != nil {
+			return err
+		}
+		if err := os.WriteFile(targetPath, []byte(scaffold), FILE_RW_MODE); err != nil {
+			return err
+		}
+		fmt.Println("added", targetPath)
+	}
+	return nil
+}
+
+// Split the front matter from the rest of the given template content.
+// Returns false if the content doesn't start with front matter.
+func splitFrontMatter(content string) (string, string, bool) {
+	first, rest, found := strings.Cut(content, "\n")
+	if !found || strings.TrimSpace(first) != markup.FM_SEPARATOR {
+		return "", "", false
+	}
+	if strings.HasPrefix(rest, markup.FM_SEPARATOR) {
+		return "", strings.TrimPrefix(strings.TrimPrefix(rest, markup.FM_SEPARATOR), "\n"), true
+	}
+	frontMatter, body, found := strings.Cut(rest, "\n"+markup.FM_SEPARATOR)
+	if !found {
+		return "", "", false
+	}
+	_, body, _ = strings.Cut(body, "\n")
+	return frontMatter + "\n", body, true
+}
+
+// Return the translation template for the given front matter and body, with `draft: true`,
+// the updated `lang`, if present, and the title and body translated if a provider is given.
+func scaffoldTranslation(frontMatter string, body string, source string, target string, provider translator) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(frontMatter), &doc); err != nil {
+		return "", err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	metadata := doc.Content[0]
+	if metadata.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("front matter should be a map")
+	}
+
+	if provider != nil {
+		if title := yamlValue(metadata, "title"); title != nil && title.Value != "" {
+			translated, err := provider.Translate(title.Value, source, target)
+			if err != nil {
+				return "", err
+			}
+			title.Value = translated
+		}
+		if strings.TrimSpace(body) != "" {
+			translated, err := provider.Translate(body, source, target)
+			if err != nil {
+				return "", err
+			}
+			body = translated
+		}
+	}
+	if lang := yamlValue(metadata, "lang"); lang != nil {
+		lang.Value = target
+	}
+	if draft := yamlValue(metadata, "draft"); draft != nil {
+		draft.Value = "true"
+	} else {
+		metadata.Content = append(metadata.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "draft"},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return "", err
+	}
+	return markup.FM_SEPARATOR + "\n" + buf.String() + markup.FM_SEPARATOR + "\n" + body, nil
+}
+
+// Return the value node of the given key in a yaml mapping node, or nil if not found.
+func yamlValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func printSorted(label string, paths []string) {
+	slices.Sort(paths)
+	for _, path := range paths {
+		fmt.Printf("  %s %s\n", label, path)
+	}
+}
@@ -1,11 +1,13 @@
 package commands
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/alecthomas/kong"
@@ -25,13 +27,21 @@ var INIT_README string = `
 A jorge blog by %s.
 `
 
+// The starter directories that --update-skeleton adds new files from. The rest of the initfiles are
+// example content, which existing projects wouldn't want.
+var SKELETON_DIRS = []string{"includes", "layouts", "src/assets"}
+
 type Init struct {
-	ProjectDir string `arg:"" name:"path" help:"Directory where to initialize the website project."`
+	ProjectDir     string `arg:"" name:"path" help:"Directory where to initialize the website project."`
+	UpdateSkeleton bool   `help:"Add the starter includes, layouts and assets missing from an existing project, keeping the files already there. The files are those embedded in the running jorge binary, so upgrade jorge first to get the latest ones."`
 }
 
 // Initialize a new jorge project in the given directory,
 // prompting for basic site config and creating default files.
 func (cmd *Init) Run(ctx *kong.Context) error {
+	if cmd.UpdateSkeleton {
+		return cmd.updateSkeleton()
+	}
 	if err := ensureEmptyProjectDir(cmd.ProjectDir); err != nil {
 		return err
 	}
@@ -73,27 +83,86 @@ func (cmd *Init) Run(ctx *kong.Context) error {
 			return os.MkdirAll(targetPath, DIR_RWE_MODE)
 		}
 
-		// TODO duplicated in site, extract to somewhere else
-		// if its a file, copy it over
-		targetFile, err := os.Create(targetPath)
-		if err != nil {
+		if err := copyInitFile(path, targetPath); err != nil {
 			return err
 		}
-		defer targetFile.Close()
+		fmt.Println("added", targetPath)
+		return nil
+	})
+}
 
-		source, err := initfiles.Open(path)
-		if err != nil {
-			return err
-		}
-		defer source.Close()
+// Copy the starter files of the skeleton dirs that don't exist in the project. Files that exist
+// with different contents, e.g. because they were customized, are left as is and listed.
+// The starter files are the ones embedded in the binary, nothing is downloaded.
+func (cmd *Init) updateSkeleton() error {
+	if _, err := os.Stat(filepath.Join(cmd.ProjectDir, "src")); err != nil {
+		return fmt.Errorf("%s is not a jorge project, missing src directory", cmd.ProjectDir)
+	}
 
-		_, err = io.Copy(targetFile, source)
+	added := 0
+	for _, dir := range SKELETON_DIRS {
+		root := path.Join("initfiles", dir)
+		err := fs.WalkDir(initfiles, root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			subpath, _ := filepath.Rel("initfiles", path)
+			targetPath := filepath.Join(cmd.ProjectDir, subpath)
+
+			current, err := os.ReadFile(targetPath)
+			if err == nil {
+				starter, err := initfiles.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(current, starter) {
+					fmt.Println("skipped", targetPath, "(differs from the starter version)")
+				}
+				return nil
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+
+			if err := os.MkdirAll(filepath.Dir(targetPath), DIR_RWE_MODE); err != nil {
+				return err
+			}
+			if err := copyInitFile(path, targetPath); err != nil {
+				return err
+			}
+			fmt.Println("added", targetPath)
+			added++
+			return nil
+		})
 		if err != nil {
 			return err
 		}
-		fmt.Println("added", targetPath)
-		return targetFile.Sync()
-	})
+	}
+
+	if added == 0 {
+		fmt.Println("the project skeleton is up to date")
+	}
+	return nil
+}
+
+// TODO duplicated in site, extract to somewhere else
+func copyInitFile(path string, targetPath string) error {
+	targetFile, err := os.Create(targetPath)
+	if err != nil {
+		return err
+	}
+	defer targetFile.Close()
+
+	source, err := initfiles.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	_, err = io.Copy(targetFile, source)
+	if err != nil {
+		return err
+	}
+	return targetFile.Sync()
 }
 
 func ensureEmptyProjectDir(projectDir string) error {
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateSkeleton(t *testing.T) {
+	projectDir := t.TempDir()
+	cmd := Init{ProjectDir: projectDir, UpdateSkeleton: true}
+	assert(t, cmd.Run(nil) != nil)
+
+	os.Mkdir(filepath.Join(projectDir, "src"), DIR_RWE_MODE)
+	layoutsDir := filepath.Join(projectDir, "layouts")
+	os.Mkdir(layoutsDir, DIR_RWE_MODE)
+	starter, err := initfiles.ReadFile("initfiles/layouts/base.html")
+	assertEqual(t, err, nil)
+	os.WriteFile(filepath.Join(layoutsDir, "base.html"), starter, FILE_RW_MODE)
+	os.WriteFile(filepath.Join(layoutsDir, "post.html"), []byte("customized"), FILE_RW_MODE)
+
+	err = cmd.Run(nil)
+	assertEqual(t, err, nil)
+
+	// missing files are added
+	content, err := os.ReadFile(filepath.Join(layoutsDir, "default.html"))
+	assertEqual(t, err, nil)
+	starter, err = initfiles.ReadFile("initfiles/layouts/default.html")
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), string(starter))
+	_, err = os.Stat(filepath.Join(projectDir, "includes", "nav.html"))
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(projectDir, "src", "assets", "css", "main.css"))
+	assertEqual(t, err, nil)
+
+	// customized files are kept
+	content, err = os.ReadFile(filepath.Join(layoutsDir, "post.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), "customized")
+
+	// example content isn't added to existing projects
+	_, err = os.Stat(filepath.Join(projectDir, "src", "index.html"))
+	assert(t, os.IsNotExist(err))
+}
@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+// The script injected into html pages to listen for server events and reload the page,
+// replace its stylesheets or show build errors.
+const LIVE_RELOAD_SNIPPET = `
+const url = location.origin + '/_events/'
+var eventSource;
+var lastEventId;
+function newSSE() {
+  console.log("connecting to server events");
+  // pass the last seen event to get a reload if one was missed while disconnected
+  eventSource = new EventSource(lastEventId ? url + '?lastEventId=' + lastEventId : url);
+  eventSource.addEventListener('connected', function (event) {
+    lastEventId = event.data;
+  });
+  eventSource.addEventListener('css', function (event) {
+    lastEventId = event.lastEventId;
+    reloadStylesheets();
+  });
+  eventSource.addEventListener('build-error', function (event) {
+    showBuildError(JSON.parse(event.data));
+  });
+  eventSource.addEventListener('shutdown', function () {
+    // the server was stopped, retry quietly in case it's restarted
+    console.log("server stopped");
+    eventSource.close();
+    setTimeout(newSSE, 5000)
+  });
+  eventSource.onmessage = function () {
+    location.reload()
+  };
+  window.onbeforeunload = function() {
+    eventSource.close();
+  }
+  eventSource.onerror = function (event) {
+    console.error('An error occurred:', event);
+    eventSource.close();
+    setTimeout(newSSE, 5000)
+  };
+}
+// replace the site stylesheets with fresh copies, keeping the page state
+function reloadStylesheets() {
+  var overlay = document.getElementById('jorge-build-error');
+  if (overlay) {
+    overlay.remove();
+  }
+  document.querySelectorAll('link[rel="stylesheet"]').forEach(function (link) {
+    var href = new URL(link.href);
+    if (href.origin !== location.origin) {
+      return;
+    }
+    href.searchParams.set('_reload', Date.now());
+    // swap when the new one is loaded, to prevent a flash of unstyled content
+    var fresh = link.cloneNode();
+    fresh.href = href.toString();
+    fresh.onload = function () { link.remove(); };
+    link.after(fresh);
+  });
+}
+// display the error of a failed build over the page, until the next successful build reloads it
+function showBuildError(error) {
+  var overlay = document.getElementById('jorge-build-error');
+  if (!overlay) {
+    overlay = document.createElement('div');
+    overlay.id = 'jorge-build-error';
+    overlay.style.cssText = 'position:fixed;inset:0;z-index:2147483647;overflow:auto;padding:2em;' +
+      'background:rgba(20,20,20,0.92);color:#eee;font:14px/1.5 monospace;';
+    overlay.onclick = function () { overlay.remove(); };
+    document.body.appendChild(overlay);
+  }
+  var title = document.createElement('h2');
+  title.style.cssText = 'color:#ff6b6b;font:bold 18px monospace;margin:0 0 1em;';
+  title.textContent = 'Build error' + (error.file ? ' in ' + error.file + (error.line ? ':' + error.line : '') : '');
+  var message = document.createElement('pre');
+  message.style.cssText = 'white-space:pre-wrap;margin:0;';
+  message.textContent = error.message;
+  overlay.replaceChildren(title, message);
+}
+newSSE();`
+
+// Wrap the given handler to inject the live reload script into its html responses,
+// so the built files don't need to include it.
+func injectLiveReload(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			handler.ServeHTTP(res, req)
+			return
+		}
+		writer := &liveReloadWriter{ResponseWriter: res}
+		handler.ServeHTTP(writer, req)
+		if err := writer.flush(); err != nil {
+			fmt.Println("couldn't inject live reload script:", err)
+		}
+	})
+}
+
+// A response writer that buffers html responses to insert the live reload script
+// before sending them. Other responses are passed through.
+type liveReloadWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+	buffer      *bytes.Buffer
+}
+
+func (writer *liveReloadWriter) WriteHeader(status int) {
+	if writer.wroteHeader {
+		return
+	}
+	writer.wroteHeader = true
+
+	contentType := writer.Header().Get("Content-Type")
+	if !strings.HasPrefix(contentType, "text/html") || (status != http.StatusOK && status != http.StatusNotFound) {
+		writer.ResponseWriter.WriteHeader(status)
+		return
+	}
+	// the length will change after injecting the script
+	writer.Header().Del("Content-Length")
+	writer.status = status
+	writer.buffer = &bytes.Buffer{}
+}
+
+func (writer *liveReloadWriter) Write(content []byte) (int, error) {
+	if !writer.wroteHeader {
+		writer.WriteHeader(http.StatusOK)
+	}
+	if writer.buffer != nil {
+		return writer.buffer.Write(content)
+	}
+	return writer.ResponseWriter.Write(content)
+}
+
+// Send the buffered html response, if any, with the script injected.
+func (writer *liveReloadWriter) flush() error {
+	if writer.buffer == nil {
+		return nil
+	}
+	content, err := markup.InjectScript(writer.buffer, LIVE_RELOAD_SNIPPET)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	writer.ResponseWriter.WriteHeader(writer.status)
+	_, err = writer.ResponseWriter.Write(body)
+	return err
+}
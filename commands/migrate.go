@@ -0,0 +1,208 @@
+package commands
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/facundoolano/jorge/config"
+	"github.com/facundoolano/jorge/markup"
+	"github.com/facundoolano/jorge/site"
+	"gopkg.in/yaml.v3"
+)
+
+// Matches href and src attributes with root-relative paths, which miss the base url when it's configured.
+var rootRelativeUrl = regexp.MustCompile(`\b(href|src)="(/(?:[^/"{}%][^"{}%]*)?)"`)
+
+// Matches liquid output wrapped in a CDATA section, now better handled by the cdata filter.
+var cdataOutput = regexp.MustCompile(`<!\[CDATA\[\{\{\s*(.*?)\s*\}\}\]\]>`)
+
+// Config keys from other conventions, e.g. Jekyll's, that jorge doesn't read, with what to use instead.
+var unsupportedConfigKeys = map[string]string{
+	"permalink":   "site-wide permalinks aren't supported, set permalink or output_path in the front matter of the pages instead",
+	"paginate":    "pagination is configured with a paginate map in the front matter of the paginated page",
+	"highlighter": "use highlight_theme to choose the syntax highlighting theme",
+	"source":      "the source files are always read from the src directory",
+	"destination": "the site is always built to the target directory",
+}
+
+// Config keys renamed in newer versions, with their current name.
+var renamedConfigKeys = map[string]string{
+	"filters": "liquid_filters",
+	"tags":    "liquid_tags",
+}
+
+type Migrate struct {
+	ProjectDir string `arg:"" name:"path" optional:"" default:"." help:"Path to the website project."`
+	Write      bool   `help:"Apply the changes that can be made automatically, instead of just listing them."`
+}
+
+// A change to a project file needed to adopt the conventions of the current version.
+// Rewrites can be applied automatically, the rest are just reported.
+type migration struct {
+	path    string
+	message string
+	rewrite []byte
+}
+
+// Look for project files that rely on behavior changed in newer jorge versions. Rewrite those that can be
+// safely updated, when --write is passed, and list the rest for manual review.
+func (cmd *Migrate) Run(ctx *kong.Context) error {
+	config, err := config.Load(cmd.ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	migrations := configMigrations(config)
+	for _, dir := range []string{config.LayoutsDir, config.IncludesDir, config.SrcDir} {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			} else if err != nil || entry.IsDir() {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			migrations = append(migrations, fileMigrations(config, path, content)...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(migrations) == 0 {
+		fmt.Println("nothing to migrate")
+		return nil
+	}
+	pending := false
+	for _, migration := range migrations {
+		switch {
+		case migration.rewrite == nil:
+			fmt.Printf("manual  %s: %s\n", migration.path, migration.message)
+		case !cmd.Write:
+			fmt.Printf("pending %s: %s\n", migration.path, migration.message)
+			pending = true
+		default:
+			if err := os.WriteFile(migration.path, migration.rewrite, site.FILE_RW_MODE); err != nil {
+				return err
+			}
+			fmt.Printf("updated %s: %s\n", migration.path, migration.message)
+		}
+	}
+	if pending {
+		fmt.Println("\nrun with --write to apply the pending changes")
+	}
+	return nil
+}
+
+// Return the keys of the project config that need to be renamed, or replaced manually.
+func configMigrations(config *config.Config) []migration {
+	var migrations []migration
+	path := filepath.Join(config.RootDir, "config.yml")
+	context := config.AsContext()
+	for key, replacement := range unsupportedConfigKeys {
+		if _, found := context[key]; found {
+			migrations = append(migrations, migration{path, fmt.Sprintf("unsupported %s key, %s", key, replacement), nil})
+		}
+	}
+	slices.SortFunc(migrations, func(a, b migration) int {
+		return strings.Compare(a.message, b.message)
+	})
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return migrations
+	}
+	var renames []migration
+	rewritten := content
+	for key, newKey := range renamedConfigKeys {
+		// only maps were read as custom helpers, other values are left for the templates
+		if _, isMap := context[key].(map[string]interface{}); isMap {
+			pattern := regexp.MustCompile(`(?m)^` + key + `:`)
+			rewritten = pattern.ReplaceAll(rewritten, []byte(newKey+":"))
+			renames = append(renames, migration{path, fmt.Sprintf("rename the %s key to %s", key, newKey), nil})
+		}
+	}
+	slices.SortFunc(renames, func(a, b migration) int {
+		return strings.Compare(a.message, b.message)
+	})
+	// the file is written with all the renames applied
+	for i := range renames {
+		renames[i].rewrite = rewritten
+	}
+	return append(migrations, renames...)
+}
+
+// Return the migrations that apply to the given file. Static files in the src dir are left alone.
+func fileMigrations(config *config.Config, path string, content []byte) []migration {
+	isSrc := strings.HasPrefix(path, config.SrcDir+string(filepath.Separator))
+	frontMatter, isTemplate := parseFrontMatter(content)
+	if isSrc && !isTemplate {
+		return nil
+	}
+	ext := filepath.Ext(path)
+	var migrations []migration
+
+	rewritten := content
+	if config.BaseUrl != "" && (ext == ".html" || ext == ".xml") && rootRelativeUrl.Match(rewritten) {
+		rewritten = rootRelativeUrl.ReplaceAll(rewritten, []byte(`$1="{{ "$2" | relative_url }}"`))
+		migrations = append(migrations, migration{path, "prefix root-relative urls with the base url using relative_url", nil})
+	}
+	if cdataOutput.Match(rewritten) {
+		rewritten = cdataOutput.ReplaceAll(rewritten, []byte(`{{ $1 | cdata }}`))
+		migrations = append(migrations, migration{path, "replace CDATA sections with the cdata filter", nil})
+	}
+	// the file is written with all the rewrites applied
+	for i := range migrations {
+		migrations[i].rewrite = rewritten
+	}
+
+	if _, found := frontMatter["auto_escape"]; isSrc && !found && (ext == ".xml" || ext == ".json") {
+		migrations = append(migrations, migration{path,
+			"xml and json output is now validated, consider setting auto_escape: true and removing explicit escape filters", nil})
+	}
+	if _, found := frontMatter["layout"]; isSrc && !found && (ext == ".md" || ext == ".org") && config.LayoutFallback && hasFallbackLayout(config) {
+		migrations = append(migrations, migration{path,
+			"with layout_fallback, pages without layout use the collection, post, page or default layout, set layout: null to render it without one", nil})
+	}
+	return migrations
+}
+
+// Return the front matter of the given template content, or false if it's not a template.
+// The content is split as the build does, so both agree on what files are templates.
+func parseFrontMatter(content []byte) (map[string]interface{}, bool) {
+	yamlContent, _, err := markup.SplitFrontMatter(content)
+	if err != nil {
+		return nil, false
+	}
+	frontMatter := make(map[string]interface{})
+	yaml.Unmarshal(yamlContent, &frontMatter)
+	return frontMatter, true
+}
+
+// Return true if the project has layouts that can be used for pages that don't declare one.
+func hasFallbackLayout(config *config.Config) bool {
+	entries, err := os.ReadDir(config.LayoutsDir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name, _, _ := strings.Cut(entry.Name(), ".")
+		if name == "default" || name == "page" || name == "post" {
+			return true
+		}
+		// collection layouts, named after a top-level src dir
+		if info, err := os.Stat(filepath.Join(config.SrcDir, name)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/facundoolano/jorge/config"
+)
+
+func TestFileMigrations(t *testing.T) {
+	projectDir := t.TempDir()
+	config := &config.Config{
+		RootDir:    projectDir,
+		SrcDir:     filepath.Join(projectDir, "src"),
+		LayoutsDir: filepath.Join(projectDir, "layouts"),
+		BaseUrl:    "/blog",
+	}
+
+	tests := []struct {
+		path     string
+		content  string
+		rewrite  string
+		messages []string
+	}{
+		{
+			path:     "layouts/base.html",
+			content:  `<a href="/">home</a><link href="/assets/main.css"><a href="https://olano.dev/about">`,
+			rewrite:  `<a href="{{ "/" | relative_url }}">home</a><link href="{{ "/assets/main.css" | relative_url }}"><a href="https://olano.dev/about">`,
+			messages: []string{"prefix root-relative urls"},
+		},
+		{
+			// already migrated urls, and those built with liquid, are left alone
+			path:    "layouts/base.html",
+			content: `<a href="{{ "/" | relative_url }}">home</a><img src="{{ page.image }}"><a href="{% link about.md %}">`,
+		},
+		{
+			path:     "src/feed.xml",
+			content:  "---\nauto_escape: true\n---\n<title><![CDATA[{{ post.title }}]]></title><link href=\"/\"/>",
+			rewrite:  "---\nauto_escape: true\n---\n<title>{{ post.title | cdata }}</title><link href=\"{{ \"/\" | relative_url }}\"/>",
+			messages: []string{"prefix root-relative urls", "replace CDATA sections"},
+		},
+		{
+			path:     "src/feed.json",
+			content:  "---\n---\n{}",
+			messages: []string{"consider setting auto_escape: true"},
+		},
+		{
+			// the front matter is parsed as the build does, e.g. with windows line endings
+			path:     "src/data.json",
+			content:  "---\r\ntitle: data\r\n---\r\n{}",
+			messages: []string{"consider setting auto_escape: true"},
+		},
+		{
+			path:    "src/escaped.json",
+			content: "---\r\nauto_escape: true\r\n---\r\n{}",
+		},
+		{
+			// static files are copied as is
+			path:    "src/static.html",
+			content: `<a href="/">home</a>`,
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(projectDir, filepath.FromSlash(test.path))
+		migrations := fileMigrations(config, path, []byte(test.content))
+		assertEqual(t, len(migrations), len(test.messages))
+		for i, migration := range migrations {
+			assertEqual(t, migration.path, path)
+			assert(t, strings.Contains(migration.message, test.messages[i]))
+			if test.rewrite != "" {
+				assertEqual(t, string(migration.rewrite), test.rewrite)
+			}
+		}
+
+		// applying the rewrites is idempotent
+		if test.rewrite != "" {
+			for _, migration := range fileMigrations(config, path, []byte(test.rewrite)) {
+				assert(t, migration.rewrite == nil)
+			}
+		}
+	}
+}
+
+func TestConfigMigrations(t *testing.T) {
+	projectDir := t.TempDir()
+	os.WriteFile(filepath.Join(projectDir, "config.yml"), []byte("permalink: pretty\nhighlight_theme: github\n"), FILE_RW_MODE)
+	conf, err := config.Load(projectDir)
+	assertEqual(t, err, nil)
+
+	migrations := configMigrations(conf)
+	assertEqual(t, len(migrations), 1)
+	assertEqual(t, migrations[0].path, filepath.Join(projectDir, "config.yml"))
+	assert(t, strings.HasPrefix(migrations[0].message, "unsupported permalink key"))
+	assert(t, migrations[0].rewrite == nil)
+
+	// custom filters and tags are renamed
+	os.WriteFile(filepath.Join(projectDir, "config.yml"), []byte(`filters:
+  shout: "{{ input | upcase }}"
+tags:
+  badge: "<span>{{ args }}</span>"
+page_defaults:
+  tags: [blog]
+`), FILE_RW_MODE)
+	conf, err = config.Load(projectDir)
+	assertEqual(t, err, nil)
+	assertEqual(t, len(conf.CustomFilters), 0)
+
+	migrations = configMigrations(conf)
+	assertEqual(t, len(migrations), 2)
+	assertEqual(t, migrations[0].message, "rename the filters key to liquid_filters")
+	assertEqual(t, migrations[1].message, "rename the tags key to liquid_tags")
+	assertEqual(t, string(migrations[0].rewrite), `liquid_filters:
+  shout: "{{ input | upcase }}"
+liquid_tags:
+  badge: "<span>{{ args }}</span>"
+page_defaults:
+  tags: [blog]
+`)
+	os.WriteFile(filepath.Join(projectDir, "config.yml"), migrations[0].rewrite, FILE_RW_MODE)
+	conf, err = config.Load(projectDir)
+	assertEqual(t, err, nil)
+	assertEqual(t, len(conf.CustomFilters), 1)
+	assertEqual(t, len(conf.CustomTags), 1)
+	assertEqual(t, len(configMigrations(conf)), 0)
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Keeps track of the paths requested to the dev server that didn't match any file,
+// to report them as likely broken links when the server stops.
+type missingPages struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+func newMissingPages() *missingPages {
+	return &missingPages{counts: make(map[string]int)}
+}
+
+func (missing *missingPages) add(path string) {
+	missing.mutex.Lock()
+	defer missing.mutex.Unlock()
+	missing.counts[path]++
+}
+
+// Print the missing paths, sorted, with the amount of times each was requested.
+func (missing *missingPages) report() {
+	missing.mutex.Lock()
+	defer missing.mutex.Unlock()
+	if len(missing.counts) == 0 {
+		return
+	}
+
+	paths := make([]string, 0, len(missing.counts))
+	for path := range missing.counts {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	fmt.Println("\nmissing pages requested during this session:")
+	for _, path := range paths {
+		fmt.Printf("  %s (%d)\n", path, missing.counts[path])
+	}
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Return a function to notify build failures and recoveries, with a desktop notification and/or
+// a POST request to a webhook url, or nil if no notification method is enabled.
+func makeBuildNotifier(siteUrl string, desktop bool, webhook string) func(err error) {
+	if !desktop && webhook == "" {
+		return nil
+	}
+
+	return func(err error) {
+		message := "build fixed"
+		if err != nil {
+			message = "build failed: " + err.Error()
+		}
+
+		if desktop {
+			if err := desktopNotification("jorge", message); err != nil {
+				fmt.Println("couldn't send notification:", err)
+			}
+		}
+		if webhook != "" {
+			if err := postWebhook(webhook, siteUrl, err); err != nil {
+				fmt.Println("couldn't send notification:", err)
+			}
+		}
+	}
+}
+
+// Show a notification with the given title and message using the operating system facilities.
+func desktopNotification(title string, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", message, title)
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		// there's no native command line notification tool, so show a balloon tip through powershell
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms;`+
+			`$n = New-Object System.Windows.Forms.NotifyIcon;`+
+			`$n.Icon = [System.Drawing.SystemIcons]::Information; $n.Visible = $true;`+
+			`$n.ShowBalloonTip(5000, '%s', '%s', 'None'); Start-Sleep 5; $n.Dispose()`,
+			strings.ReplaceAll(title, "'", "''"), strings.ReplaceAll(message, "'", "''"))
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+	default:
+		cmd = exec.Command("notify-send", title, message)
+	}
+	return cmd.Run()
+}
+
+// Send the build state as json to the given webhook url.
+func postWebhook(webhook string, siteUrl string, buildErr error) error {
+	payload := map[string]string{"site": siteUrl, "state": BUILD_OK}
+	if buildErr != nil {
+		payload["state"] = BUILD_FAILED
+		payload["error"] = buildErr.Error()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", res.Status)
+	}
+	return nil
+}
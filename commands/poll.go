@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/fsnotify/fsnotify"
+)
+
+const DEFAULT_POLL_INTERVAL = time.Second
+
+// The --poll flag, which can be used alone, to poll every DEFAULT_POLL_INTERVAL, or with a duration, e.g. --poll=2s.
+type pollFlag time.Duration
+
+func (poll *pollFlag) Decode(ctx *kong.DecodeContext) error {
+	if ctx.Scan.Peek().Type != kong.FlagValueToken {
+		*poll = pollFlag(DEFAULT_POLL_INTERVAL)
+		return nil
+	}
+
+	token := ctx.Scan.Pop()
+	value, ok := token.Value.(string)
+	if !ok {
+		return fmt.Errorf("expected duration but got %q", token.Value)
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("expected positive duration but got %q", value)
+	}
+	*poll = pollFlag(interval)
+	return nil
+}
+
+func (poll *pollFlag) IsBool() bool {
+	return true
+}
+
+// The subset of fsnotify.Watcher used by the serve command, so it can be replaced by a pollWatcher.
+type projectWatcher interface {
+	Add(path string) error
+	Close() error
+}
+
+// A watcher that checks the modification time of the files in the watched directories periodically,
+// for file systems where fsnotify doesn't receive events, like docker bind mounts and network volumes.
+// As with fsnotify, directories are watched non recursively, and events are sent to the Events channel.
+type pollWatcher struct {
+	Events chan fsnotify.Event
+
+	mutex sync.Mutex
+	dirs  map[string]bool
+	files map[string]fileState
+	done  chan struct{}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func newPollWatcher(interval time.Duration) *pollWatcher {
+	watcher := &pollWatcher{
+		Events: make(chan fsnotify.Event),
+		dirs:   make(map[string]bool),
+		files:  make(map[string]fileState),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(watcher.Events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-watcher.done:
+				return
+			case <-ticker.C:
+				for _, event := range watcher.poll() {
+					select {
+					case watcher.Events <- event:
+					case <-watcher.done:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return watcher
+}
+
+// Start watching the files in the given directory. Adding an already watched directory is a noop.
+func (watcher *pollWatcher) Add(dir string) error {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	if watcher.dirs[dir] {
+		return nil
+	}
+
+	current, err := readDirState(dir)
+	if err != nil {
+		return err
+	}
+	watcher.dirs[dir] = true
+	for path, state := range current {
+		watcher.files[path] = state
+	}
+	return nil
+}
+
+func (watcher *pollWatcher) Close() error {
+	close(watcher.done)
+	return nil
+}
+
+// Compare the current state of the watched directories with the one from the previous poll,
+// returning events for the created, modified and removed files.
+func (watcher *pollWatcher) poll() []fsnotify.Event {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	var events []fsnotify.Event
+	seen := make(map[string]bool)
+	for dir := range watcher.dirs {
+		current, err := readDirState(dir)
+		if err != nil {
+			// the directory was removed, its files will be reported below
+			delete(watcher.dirs, dir)
+			continue
+		}
+		for path, state := range current {
+			seen[path] = true
+			previous, found := watcher.files[path]
+			if !found {
+				events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+			} else if previous != state {
+				events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+			}
+			watcher.files[path] = state
+		}
+	}
+
+	for path := range watcher.files {
+		if !seen[path] {
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+			delete(watcher.files, path)
+		}
+	}
+	return events
+}
+
+// Return the modification time and size of the entries of the given directory, by path.
+func readDirState(dir string) (map[string]fileState, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]fileState)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err == nil && entry.Type()&fs.ModeSymlink != 0 {
+			// compare the linked file, which is the one edited
+			info, err = os.Stat(path)
+		}
+		if err != nil {
+			// removed since listing the dir, or a broken link
+			continue
+		}
+		states[path] = fileState{info.ModTime(), info.Size()}
+	}
+	return states, nil
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+
+	"github.com/facundoolano/jorge/config"
+	"github.com/facundoolano/jorge/site"
+)
+
+// The number of pages listed in the memory profile report.
+const PROFILE_TOP_PAGES = 10
+
+// The memory usage of a build phase, as reported by the go runtime.
+type phaseMemory struct {
+	name string
+	// the bytes and objects allocated during the phase, including the ones already garbage collected
+	allocated uint64
+	objects   uint64
+	// the live heap at the end of the phase
+	heapInUse uint64
+	gcCycles  uint32
+}
+
+// Build the site like site.Build, but sampling the memory stats after loading and after rendering,
+// and print a report of the allocations by phase, the peak RSS of the process and the largest pages.
+func profileBuild(config *config.Config) error {
+	var phases []phaseMemory
+	var previous runtime.MemStats
+	runtime.ReadMemStats(&previous)
+	endPhase := func(name string) {
+		var current runtime.MemStats
+		runtime.ReadMemStats(&current)
+		phases = append(phases, phaseMemory{
+			name:      name,
+			allocated: current.TotalAlloc - previous.TotalAlloc,
+			objects:   current.Mallocs - previous.Mallocs,
+			heapInUse: current.HeapInuse,
+			gcCycles:  current.NumGC - previous.NumGC,
+		})
+		previous = current
+	}
+
+	website, err := site.Load(*config)
+	endPhase("load")
+	if err == nil {
+		err = website.Build()
+		endPhase("build")
+	}
+	printMemoryReport(phases, website)
+	return err
+}
+
+func printMemoryReport(phases []phaseMemory, website *site.Site) {
+	fmt.Println("\nmemory profile:")
+	fmt.Printf("  %-8s %12s %12s %12s %6s\n", "phase", "allocated", "objects", "heap in use", "gcs")
+	for _, phase := range phases {
+		fmt.Printf("  %-8s %12s %12d %12s %6d\n", phase.name, formatBytes(phase.allocated), phase.objects, formatBytes(phase.heapInUse), phase.gcCycles)
+	}
+	if peak, ok := peakRSS(); ok {
+		fmt.Printf("  peak rss: %s\n", formatBytes(peak))
+	}
+
+	if website == nil {
+		return
+	}
+	sizes := website.PageSizes()
+	if len(sizes) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(sizes))
+	for path := range sizes {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if sizes[paths[i]] != sizes[paths[j]] {
+			return sizes[paths[i]] > sizes[paths[j]]
+		}
+		return paths[i] < paths[j]
+	})
+	if len(paths) > PROFILE_TOP_PAGES {
+		paths = paths[:PROFILE_TOP_PAGES]
+	}
+	fmt.Println("  largest pages:")
+	for _, path := range paths {
+		fmt.Printf("  %12s  %s\n", formatBytes(uint64(sizes[path])), path)
+	}
+}
+
+func formatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value := float64(size) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if value < unit || suffix == "GB" {
+			return fmt.Sprintf("%.1f%s", value, suffix)
+		}
+		value /= unit
+	}
+	return ""
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package commands
+
+// The peak RSS is not available on this platform.
+func peakRSS() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package commands
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// Return the maximum resident set size of the process so far, in bytes.
+func peakRSS() (uint64, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	// reported in bytes on macOS and in kilobytes elsewhere
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return uint64(usage.Maxrss), true
+	}
+	return uint64(usage.Maxrss) * 1024, true
+}
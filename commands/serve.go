@@ -1,62 +1,397 @@
 package commands
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/facundoolano/jorge/config"
+	"github.com/facundoolano/jorge/markup"
 	"github.com/facundoolano/jorge/site"
 	"github.com/fsnotify/fsnotify"
 )
 
+const SSE_HEARTBEAT_INTERVAL = 15 * time.Second
+
+// How long to wait for open connections to finish when the server is interrupted, before closing them.
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
+// How many ports after the configured one to try when it's already in use.
+const PORT_FALLBACK_ATTEMPTS = 10
+
 type Serve struct {
-	ProjectDir string `arg:"" name:"path" optional:"" default:"." help:"Path to the website project to serve."`
-	Host       string `short:"H" default:"localhost" help:"Host to run the server on."`
-	Port       int    `short:"p" default:"4001" help:"Port to run the server on."`
-	NoReload   bool   `help:"Disable live reloading."`
+	ProjectDir string        `arg:"" name:"path" optional:"" default:"." help:"Path to the website project to serve."`
+	Host       string        `short:"H" default:"localhost" help:"Host to run the server on. Use 0.0.0.0 to make the site reachable from the local network."`
+	Port       int           `short:"p" default:"4001" help:"Port to run the server on."`
+	Env        string        `placeholder:"ENV" help:"Load the config.<env>.yml overlay of the given environment instead of the dev one. Defaults to the JORGE_ENV variable."`
+	Set        []string      `placeholder:"KEY=VALUE" sep:"none" help:"Override a config key, e.g. --set highlight_theme=monokai. Can be repeated."`
+	NoReload   bool          `help:"Disable live reloading."`
+	Debounce   time.Duration `help:"Time to wait for further changes before rebuilding, e.g. 500ms. Defaults to the watch_debounce config."`
+	MaxWait    time.Duration `help:"Rebuild at least this often under continuous changes, e.g. 5s. Defaults to the watch_max_wait config."`
+	TLS        bool          `name:"tls" help:"Serve over HTTPS, with a self-signed certificate unless --cert and --key are given."`
+	Cert       string        `type:"existingfile" help:"Certificate file to serve over HTTPS, e.g. generated with mkcert. Implies --tls."`
+	Key        string        `type:"existingfile" help:"Private key file of the --cert certificate."`
+	Open       bool          `help:"Open the site in the default browser after the initial build."`
+	Notify     bool          `help:"Show a desktop notification when a build fails or recovers."`
+	Poll       pollFlag      `placeholder:"INTERVAL" help:"Poll for file changes, every second or the given interval, e.g. --poll=2s. For file systems that don't report changes, like docker bind mounts."`
+	StrictPort bool          `help:"Fail if the port is already in use, instead of trying the next ones."`
+	Auth       string        `env:"JORGE_SERVE_AUTH" placeholder:"USER:PASSWORD" help:"Require HTTP basic authentication with the given credentials."`
+	Proxy      []string      `placeholder:"PATH=URL" help:"Forward requests under a path to a backend server, e.g. /api=http://localhost:8080. Can be repeated."`
+	Verbose    bool          `short:"V" help:"Log the method, path, status and duration of each request."`
 }
 
 func (cmd *Serve) Run(ctx *kong.Context) error {
-	config, err := config.LoadDev(cmd.ProjectDir, cmd.Host, cmd.Port, !cmd.NoReload)
+	// bind the port before loading the config, since the site url depends on the port actually used
+	listener, port, err := listenPort(cmd.Host, cmd.Port, cmd.StrictPort)
 	if err != nil {
 		return err
 	}
+	defer listener.Close()
 
+	if (cmd.Cert == "") != (cmd.Key == "") {
+		return fmt.Errorf("--cert and --key must be used together")
+	}
+	useTLS := cmd.TLS || cmd.Cert != ""
+	config, host, err := cmd.loadConfig(port, useTLS)
+	if err != nil {
+		return err
+	}
 	if _, err := os.Stat(config.SrcDir); os.IsNotExist(err) {
 		return fmt.Errorf("missing src directory")
 	}
 
+	var certificate tls.Certificate
+	if useTLS {
+		if certificate, err = loadCertificate(host, cmd.Cert, cmd.Key); err != nil {
+			return err
+		}
+	}
+
+	// forward requests to backend servers, e.g. for API routes
+	for _, proxy := range cmd.Proxy {
+		prefix, handler, err := makeProxyHandler(proxy)
+		if err != nil {
+			return err
+		}
+		http.Handle(prefix, handler)
+		http.Handle(prefix+"/", handler)
+		fmt.Println("proxying", proxy)
+	}
+
 	// watch for changes in src and layouts, and trigger a rebuild
 	broker := newEventBroker()
-	watcher, err := runWatcher(config, broker)
+	status := &buildStatus{State: BUILD_BUILDING}
+	status.onChange = makeBuildNotifier(config.SiteUrl, config.NotifyDesktop || cmd.Notify, config.NotifyWebhook)
+	if cmd.Open {
+		// subscribe before the watcher starts, so the initial build event isn't missed
+		openOnFirstBuild(broker, config.SiteUrl+config.BaseUrl+"/")
+	}
+	stopWatcher, err := runWatcher(config, cmd.configLoader(port, useTLS), broker, status, time.Duration(cmd.Poll))
 	if err != nil {
 		return err
 	}
-	defer watcher.Close()
+	defer stopWatcher()
 
 	// serve the target dir with a file server
-	fs := http.FileServer(http.Dir(config.TargetDir))
-	http.Handle("/", fs)
+	for ext, mimeType := range config.MimeTypes {
+		if err := mime.AddExtensionType(ext, mimeType); err != nil {
+			return fmt.Errorf("invalid mime type for %s: %w", ext, err)
+		}
+	}
+	missing := newMissingPages()
+	fs := serveNotFoundPage(config.TargetDir, missing, http.FileServer(http.Dir(config.TargetDir)))
+	if config.LiveReload {
+		fs = injectLiveReload(fs)
+	}
+	if config.BaseUrl != "" {
+		// serve under the base url, as the site is expected to be published
+		http.Handle(config.BaseUrl+"/", http.StripPrefix(config.BaseUrl, fs))
+		http.Handle("/", http.RedirectHandler(config.BaseUrl+"/", http.StatusFound))
+	} else {
+		http.Handle("/", fs)
+	}
+
+	http.Handle("/_status", makeStatusHandler(status))
 
 	if config.LiveReload {
 		// handle client requests to listen to server-sent events
 		http.Handle("/_events/", makeServerEventsHandler(broker))
 	}
 
-	addr := fmt.Sprintf("%s:%d", config.ServerHost, config.ServerPort)
-	return http.ListenAndServe(addr, nil)
+	var handler http.Handler = http.DefaultServeMux
+	if config.ProxyRemoteAssets {
+		handler = serveRemoteAssets(handler)
+	}
+	if cmd.Auth != "" {
+		user, password, found := strings.Cut(cmd.Auth, ":")
+		if !found || user == "" {
+			return fmt.Errorf("invalid auth credentials, expected USER:PASSWORD")
+		}
+		handler = requireBasicAuth(user, password, handler)
+	}
+	if cmd.Verbose {
+		handler = logRequests(handler)
+	}
+	server := &http.Server{Handler: handler}
+	serverErrors := make(chan error, 1)
+	go func() {
+		if useTLS {
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+			serverErrors <- server.ServeTLS(listener, "", "")
+		} else {
+			serverErrors <- server.Serve(listener)
+		}
+	}()
+
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-serverErrors:
+		return err
+	case <-interrupted.Done():
+	}
+	// a second interrupt kills the process right away
+	stop()
+	fmt.Println("\nshutting down")
+
+	// let the build in progress clean up, and the live reload clients know they should reconnect later
+	stopWatcher()
+	broker.shutdown()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("timed out waiting for connections to close")
+		server.Close()
+	}
+
+	// on exit, report the requests to missing files
+	missing.report()
+	return nil
+}
+
+// Load the project config with the serve defaults and the command line overrides, for the given port.
+// Returns the config and the host the site urls point to.
+func (cmd *Serve) loadConfig(port int, useTLS bool) (*config.Config, string, error) {
+	config, err := config.LoadDev(cmd.ProjectDir, cmd.Env, cmd.Set, cmd.Host, port, !cmd.NoReload)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cmd.Debounce != 0 {
+		config.WatchDebounce = cmd.Debounce
+	}
+	if cmd.MaxWait != 0 {
+		config.WatchMaxWait = cmd.MaxWait
+	}
+
+	// when listening on all interfaces, the site urls need to point to an address reachable by
+	// other devices, e.g. to test the site on a phone
+	host := cmd.Host
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		if lanHost, err := lanAddress(); err != nil {
+			fmt.Println("couldn't determine the local network url:", err)
+		} else {
+			host = lanHost
+			config.SiteUrl = fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+	}
+	if useTLS {
+		config.SiteUrl = strings.Replace(config.SiteUrl, "http://", "https://", 1)
+	}
+	return config, host, nil
+}
+
+// Return a function to reload the config, e.g. after config.yml changes.
+func (cmd *Serve) configLoader(port int, useTLS bool) func() (*config.Config, error) {
+	return func() (*config.Config, error) {
+		config, _, err := cmd.loadConfig(port, useTLS)
+		return config, err
+	}
+}
+
+// Listen on the given host and port. If the port is already in use, and strict is false,
+// try the following ones, printing a notice of the one used. Returns the listener and its port.
+func listenPort(host string, port int, strict bool) (net.Listener, int, error) {
+	attempts := PORT_FALLBACK_ATTEMPTS
+	if strict {
+		attempts = 0
+	}
+
+	for i := 0; ; i++ {
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port+i)))
+		if err == nil {
+			if i > 0 {
+				fmt.Printf("port %d is in use, using %d instead\n", port, port+i)
+			}
+			return listener, port + i, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) || i >= attempts {
+			return nil, 0, err
+		}
+	}
+}
+
+// Return the IPv4 address of this machine in the local network, preferring private addresses.
+func lanAddress() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	var found net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil || !ipnet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ipnet.IP.IsPrivate() {
+			return ipnet.IP.String(), nil
+		} else if found == nil {
+			found = ipnet.IP
+		}
+	}
+	if found == nil {
+		return "", fmt.Errorf("couldn't find a local network address")
+	}
+	return found.String(), nil
+}
+
+// Open the given url in the browser once the result of the first site build is published to the broker.
+func openOnFirstBuild(broker *EventBroker, url string) {
+	id, events, _ := broker.subscribe()
+	go func() {
+		<-events
+		broker.unsubscribe(id)
+		if err := openBrowser(url); err != nil {
+			fmt.Println("couldn't open browser:", err)
+		}
+	}()
+}
+
+// Wrap the given handler to reject requests that don't include the given basic auth credentials.
+func requireBasicAuth(user string, password string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		reqUser, reqPassword, ok := req.BasicAuth()
+		userMatch := subtle.ConstantTimeCompare([]byte(reqUser), []byte(user)) == 1
+		passwordMatch := subtle.ConstantTimeCompare([]byte(reqPassword), []byte(password)) == 1
+		if !ok || !userMatch || !passwordMatch {
+			res.Header().Set("WWW-Authenticate", `Basic realm="jorge", charset="UTF-8"`)
+			http.Error(res, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// Parse a PATH=URL proxy definition and return the path prefix and a reverse proxy handler
+// that forwards the requests under it, with their full path, to the backend at the url.
+func makeProxyHandler(proxy string) (string, http.Handler, error) {
+	prefix, target, found := strings.Cut(proxy, "=")
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !found || !strings.HasPrefix(prefix, "/") || target == "" {
+		return "", nil, fmt.Errorf("invalid proxy %s, expected PATH=URL, e.g. /api=http://localhost:8080", proxy)
+	}
+	if strings.HasPrefix(prefix, "/_") {
+		return "", nil, fmt.Errorf("invalid proxy %s, paths starting with /_ are reserved", proxy)
+	}
+
+	backend, err := url.Parse(target)
+	if err != nil || backend.Scheme == "" || backend.Host == "" {
+		return "", nil, fmt.Errorf("invalid proxy url %s", target)
+	}
+	return prefix, httputil.NewSingleHostReverseProxy(backend), nil
+}
+
+// Wrap the given handler to respond to requests under the remote proxy path, e.g.
+// /_proxy/https://example.com/photo.jpg, with the asset at the url, fetched through the build cache.
+// The raw request uri is used since the remote url wouldn't survive the path cleaning of the mux.
+// Only the urls rewritten by the site build are served, the rest respond with not found.
+func serveRemoteAssets(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assetUrl, found := strings.CutPrefix(req.RequestURI, site.REMOTE_PROXY_PATH)
+		if !found {
+			handler.ServeHTTP(res, req)
+			return
+		}
+		if !site.IsProxiedAsset(assetUrl) {
+			// only proxy the urls found in the site, otherwise the server could fetch arbitrary urls
+			http.NotFound(res, req)
+			return
+		}
+
+		cachePath, contentType, err := markup.FetchRemoteAsset(assetUrl)
+		if err != nil {
+			fmt.Printf("couldn't fetch %s: %s\n", assetUrl, err)
+			http.Error(res, err.Error(), http.StatusBadGateway)
+			return
+		}
+		file, err := os.Open(cachePath)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", contentType)
+		res.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(markup.REMOTE_ASSET_MAX_AGE.Seconds())))
+		http.ServeContent(res, req, "", info.ModTime(), file)
+	})
+}
+
+// Wrap the file server handler to respond to requests for missing files with the site's
+// own 404 page, if there is one, so it can be previewed as it will be served in production.
+// The missing paths are recorded to report them later.
+func serveNotFoundPage(targetDir string, missing *missingPages, fileServer http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requested := filepath.Join(targetDir, filepath.FromSlash(path.Clean("/"+req.URL.Path)))
+		if _, err := os.Stat(requested); !os.IsNotExist(err) {
+			fileServer.ServeHTTP(res, req)
+			return
+		}
+		missing.add(req.URL.Path)
+
+		// the page can be written as 404.html or, with pretty paths, 404/index.html
+		for _, page := range []string{"404.html", filepath.Join("404", "index.html")} {
+			if content, err := os.ReadFile(filepath.Join(targetDir, page)); err == nil {
+				res.Header().Set("Content-Type", "text/html; charset=utf-8")
+				res.WriteHeader(http.StatusNotFound)
+				res.Write(content)
+				return
+			}
+		}
+		http.NotFound(res, req)
+	})
 }
 
 // Return an http.HandlerFunc that establishes a server-sent event stream with clients,
 // subscribes to site rebuild events received through the given event broker
 // and forwards them to the client.
+// Clients that reconnect with the id of an event older than the last one, e.g. after the computer
+// was suspended, receive a reload event right away, so they don't miss rebuilds.
 func makeServerEventsHandler(broker *EventBroker) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		res.Header().Set("Content-Type", "text/event-stream")
@@ -64,65 +399,207 @@ func makeServerEventsHandler(broker *EventBroker) http.HandlerFunc {
 		res.Header().Set("Cache-Control", "no-cache")
 		res.Header().Set("Access-Control-Allow-Origin", "*")
 
-		id, events := broker.subscribe()
+		// the live reload script passes the id as a query param, since it recreates the EventSource
+		// on errors and the browser only sends the header on its own reconnections
+		seenId := req.Header.Get("Last-Event-ID")
+		if seenId == "" {
+			seenId = req.URL.Query().Get("lastEventId")
+		}
+
+		id, events, lastEventId := broker.subscribe()
+		defer broker.unsubscribe(id)
+
+		if seenId != "" && seenId != strconv.FormatUint(lastEventId, 10) {
+			sendReloadEvent(res, lastEventId)
+		} else {
+			// let the client know the current event id, to send it back when reconnecting
+			fmt.Fprintf(res, "event: connected\ndata: %d\n\n", lastEventId)
+			res.(http.Flusher).Flush()
+		}
+
+		heartbeat := time.NewTicker(SSE_HEARTBEAT_INTERVAL)
+		defer heartbeat.Stop()
 		for {
 			select {
-			case <-events:
-				// send an event to the connected client.
-				// data\n\n just means send an empty, unnamed event
-				// since we only need to support the single reload operation.
-				fmt.Fprint(res, "retry: 1000\n")
-				fmt.Fprint(res, "data\n\n")
+			case event := <-events:
+				if event.buildError != "" {
+					sendBuildErrorEvent(res, event.buildError)
+				} else if event.cssOnly {
+					sendCssEvent(res, event.id)
+				} else {
+					sendReloadEvent(res, event.id)
+				}
+			case <-heartbeat.C:
+				// comment lines are ignored by clients, but keep proxies from closing idle connections
+				fmt.Fprint(res, ": heartbeat\n\n")
 				res.(http.Flusher).Flush()
+			case <-broker.done:
+				sendShutdownEvent(res)
+				return
 			case <-req.Context().Done():
-				broker.unsubscribe(id)
 				return
 			}
 		}
 	}
 }
 
+// Send an event to the connected client.
+// The data is empty since we only need to support the single reload operation.
+func sendReloadEvent(res http.ResponseWriter, eventId uint64) {
+	fmt.Fprint(res, "retry: 1000\n")
+	fmt.Fprintf(res, "id: %d\n", eventId)
+	fmt.Fprint(res, "data\n\n")
+	res.(http.Flusher).Flush()
+}
+
+// Send an event for the client to reload its stylesheets, without reloading the page.
+func sendCssEvent(res http.ResponseWriter, eventId uint64) {
+	fmt.Fprint(res, "event: css\n")
+	fmt.Fprintf(res, "id: %d\n", eventId)
+	fmt.Fprint(res, "data\n\n")
+	res.(http.Flusher).Flush()
+}
+
+// Let the client know the server is stopping, so it retries the connection instead of reporting an error.
+func sendShutdownEvent(res http.ResponseWriter) {
+	fmt.Fprint(res, "event: shutdown\ndata\n\n")
+	res.(http.Flusher).Flush()
+}
+
+// Send the error of a failed build to the client, so it can be displayed on the page.
+// Since build errors don't change the served files, the event has no id.
+func sendBuildErrorEvent(res http.ResponseWriter, data string) {
+	fmt.Fprint(res, "event: build-error\n")
+	fmt.Fprintf(res, "data: %s\n\n", data)
+	res.(http.Flusher).Flush()
+}
+
 // Sets up a watcher that will publish changes in the site source files
-// to the returned event broker.
-func runWatcher(config *config.Config, broker *EventBroker) (*fsnotify.Watcher, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, err
+// to the returned event broker. If pollInterval is non zero, file changes
+// are polled instead of received from the file system.
+func runWatcher(config *config.Config, reloadConfig func() (*config.Config, error), broker *EventBroker, status *buildStatus, pollInterval time.Duration) (func(), error) {
+	var watcher projectWatcher
+	var events <-chan fsnotify.Event
+	if pollInterval > 0 {
+		poller := newPollWatcher(pollInterval)
+		watcher, events = poller, poller.Events
+	} else {
+		notifier, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		watcher, events = notifier, notifier.Events
 	}
 
+	// keep track of the files changed since the last build, to decide if a full rebuild is necessary
+	var website *site.Site
+	var changedPaths []string
+	var changedMutex sync.Mutex
+	// when the first of the changes waiting for a rebuild happened
+	var pendingSince time.Time
+	// cancels the build in progress, if any, when new changes arrive
+	cancelBuild := func() {}
+	// builds are serialized so a canceled build finishes cleaning up before the next one starts
+	var buildMutex sync.Mutex
+	// set when the watcher is stopped, so no more builds are started
+	stopped := false
+
 	// the rebuild is handled after some delay to prevent bursts of events to trigger repeated rebuilds
 	// which can cause the browser to refresh while another unfinished build is in progress (refreshing to
 	// a missing file). The initial build is done immediately.
 	rebuildAfter := time.AfterFunc(0, func() {
-		rebuildSite(config, watcher, broker)
+		changedMutex.Lock()
+		if stopped {
+			changedMutex.Unlock()
+			return
+		}
+		paths := changedPaths
+		changedPaths = nil
+		pendingSince = time.Time{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelBuild = cancel
+		changedMutex.Unlock()
+		defer cancel()
+
+		buildMutex.Lock()
+		defer buildMutex.Unlock()
+		if slices.ContainsFunc(paths, func(path string) bool { return isConfigFile(config.RootDir, path) }) {
+			reloaded, err := reloadConfig()
+			if err != nil {
+				fmt.Println("config error:", err)
+				status.finish(status.start(), err)
+				broker.publishBuildError(err)
+				return
+			}
+			// the event loop reads the config too
+			changedMutex.Lock()
+			*config = *reloaded
+			changedMutex.Unlock()
+			// settings like the base url or the port are used by the server and require a restart
+			fmt.Println("config reloaded")
+		}
+		website = rebuildSite(ctx, config, watcher, broker, status, website, paths)
 	})
 
 	go func() {
-		for event := range watcher.Events {
+		for event := range events {
 			// chmod events are noisy, ignore them. But not if they are also a write event.
 			isChmod := event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write)
+			info, err := os.Stat(event.Name)
+			isDir := err == nil && info.IsDir()
+			changedMutex.Lock()
 			// Also ignore dot file events, which are usually spurious (e.g .DS_Store, emacs temp files)
-			isDotFile := strings.HasPrefix(filepath.Base(event.Name), ".")
-			if isChmod || isDotFile {
+			isDotFile := strings.HasPrefix(filepath.Base(event.Name), ".") &&
+				!isConfigFile(config.RootDir, event.Name) && !config.IsIncluded(event.Name, isDir)
+			if isChmod || isDotFile || !isProjectChange(config, event) || isWatchIgnored(config, event.Name, isDir) {
+				changedMutex.Unlock()
 				continue
 			}
 
 			// Schedule a rebuild to trigger after a delay. If there was another one pending
-			// it will be canceled.
+			// it will be canceled, unless changes have been pending for longer than the max wait.
 			fmt.Printf("\nfile %s changed\n", event.Name)
+			// a build started before this change would publish outdated results
+			cancelBuild()
+			changedPaths = append(changedPaths, event.Name)
+			if pendingSince.IsZero() {
+				pendingSince = time.Now()
+			}
+			delay := config.WatchDebounce
+			if config.WatchMaxWait > 0 {
+				delay = max(0, min(delay, time.Until(pendingSince.Add(config.WatchMaxWait))))
+			}
+			changedMutex.Unlock()
 			rebuildAfter.Stop()
-			rebuildAfter.Reset(100 * time.Millisecond)
+			rebuildAfter.Reset(delay)
 		}
 	}()
 
-	return watcher, err
+	// stop watching and wait for the build in progress, if any, to be canceled
+	var stopOnce sync.Once
+	stopWatcher := func() {
+		stopOnce.Do(func() {
+			watcher.Close()
+			rebuildAfter.Stop()
+			changedMutex.Lock()
+			stopped = true
+			cancelBuild()
+			changedMutex.Unlock()
+			buildMutex.Lock()
+			buildMutex.Unlock()
+		})
+	}
+	return stopWatcher, nil
 }
 
 // React to source file change events by re-watching the source directories,
 // rebuilding the site and publishing a rebuild event to clients.
-func rebuildSite(config *config.Config, watcher *fsnotify.Watcher, broker *EventBroker) {
+// If the changes only affect layouts or includes, the previously loaded site is reused
+// to render just the affected pages. Returns the site instance to use in the next rebuild.
+// If the context is canceled the build is aborted and no rebuild event is published.
+func rebuildSite(ctx context.Context, config *config.Config, watcher projectWatcher, broker *EventBroker, status *buildStatus, website *site.Site, changedPaths []string) *site.Site {
 	fmt.Printf("building site\n")
-	start := time.Now()
+	start := status.start()
 
 	// since new nested directories could be triggering this change, and we need to watch those too
 	// and since re-watching files is a noop, I just re-add the entire src everytime there's a change
@@ -130,52 +607,211 @@ func rebuildSite(config *config.Config, watcher *fsnotify.Watcher, broker *Event
 		fmt.Println("couldn't add watchers:", err)
 	}
 
-	if err := site.Build(*config); err != nil {
+	// when possible, only render again the outputs affected by the changes
+	var err error
+	reloadAll := website == nil || len(changedPaths) == 0
+	if !reloadAll && onlyLayoutChanges(config, changedPaths) {
+		err = website.ReloadLayouts(ctx, changedPaths)
+	} else if !reloadAll {
+		err = website.ReloadFiles(ctx, changedPaths)
+		reloadAll = errors.Is(err, site.ErrReloadAll)
+	}
+	if reloadAll {
+		website, err = site.LoadContext(ctx, *config)
+		if err == nil {
+			err = website.BuildContext(ctx)
+		}
+	}
+	if ctx.Err() != nil {
+		// a new build is scheduled, and since this one may have been partial, it will start from scratch
+		fmt.Println("build canceled")
+		return nil
+	} else if err != nil {
 		fmt.Println("build error:", err)
-		return
+		status.finish(start, err)
+		broker.publishBuildError(err)
+		return nil
 	}
+	status.finish(start, nil)
 
-	broker.publish("rebuild")
+	// stylesheet changes can be applied without losing the page state, unless the whole site was
+	// rebuilt, e.g. after a failed or canceled build, in which case the lost changes need a page reload
+	broker.publishReload(!reloadAll && onlyStyleChanges(changedPaths))
 
 	elapsed := time.Since(start)
-	fmt.Printf("done in %.2fs\nserving at %s\n", elapsed.Seconds(), config.SiteUrl)
+	fmt.Printf("done in %.2fs\n", elapsed.Seconds())
+	if config.ServerPort != 0 {
+		fmt.Printf("serving at %s%s/\n", config.SiteUrl, config.BaseUrl)
+	}
+	return website
+}
+
+// Return true if all the given paths are css files.
+func onlyStyleChanges(changedPaths []string) bool {
+	if len(changedPaths) == 0 {
+		return false
+	}
+	for _, path := range changedPaths {
+		if filepath.Ext(path) != ".css" {
+			return false
+		}
+	}
+	return true
+}
+
+// Return true if all the given paths are layout, include or shortcode files.
+func onlyLayoutChanges(config *config.Config, changedPaths []string) bool {
+	if len(changedPaths) == 0 {
+		return false
+	}
+	for _, path := range changedPaths {
+		dir := filepath.Dir(path)
+		if dir != filepath.Clean(config.LayoutsDir) && dir != filepath.Clean(config.IncludesDir) && dir != filepath.Clean(config.ShortcodesDir) {
+			return false
+		}
+	}
+	return true
 }
 
 // Configure the given watcher to notify for changes in the project source files
-func watchProjectFiles(watcher *fsnotify.Watcher, config *config.Config) error {
+func watchProjectFiles(watcher projectWatcher, config *config.Config) error {
+	// the root is watched for changes to config.yml and to create the watches of new project dirs
+	watcher.Add(config.RootDir)
 	watcher.Add(config.LayoutsDir)
 	watcher.Add(config.DataDir)
 	watcher.Add(config.IncludesDir)
+	watcher.Add(config.ShortcodesDir)
 	// fsnotify watches all files within a dir, but non recursively
-	// this walks through the src dir and adds watches for each found directory
-	return filepath.WalkDir(config.SrcDir, func(path string, entry fs.DirEntry, err error) error {
+	// this walks through the src and static dirs and adds watches for each found directory
+	if err := watchDirTree(watcher, config, config.SrcDir); err != nil {
+		return err
+	}
+	if config.StaticDir == "" {
+		return nil
+	}
+	return watchDirTree(watcher, config, config.StaticDir)
+}
+
+func watchDirTree(watcher projectWatcher, config *config.Config, root string) error {
+	return site.WalkSource(config, root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 		if entry.IsDir() {
+			if isWatchIgnored(config, path, true) {
+				return filepath.SkipDir
+			}
 			watcher.Add(path)
+		} else if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			// changes to linked files are notified in the directory of their target
+			if target, err := filepath.EvalSymlinks(path); err == nil {
+				watcher.Add(filepath.Dir(target))
+			}
 		}
 		return nil
 	})
 }
 
+// Return true if the given path is one of the files the project config is loaded from,
+// including the environment overlays, e.g. config.dev.yml.
+func isConfigFile(rootDir string, path string) bool {
+	if filepath.Dir(path) != filepath.Clean(rootDir) {
+		return false
+	}
+	name := filepath.Base(path)
+	isOverlay := strings.HasPrefix(name, "config.") && strings.HasSuffix(name, ".yml")
+	return name == "config.yml" || isOverlay || name == config.IGNORE_FILE
+}
+
+// Return false for changes directly under the project root other than to config files or the creation
+// of the project dirs, e.g. to the target dir, which are only incidentally watched.
+func isProjectChange(config *config.Config, event fsnotify.Event) bool {
+	if filepath.Dir(event.Name) != filepath.Clean(config.RootDir) {
+		return true
+	}
+	if isConfigFile(config.RootDir, event.Name) {
+		return true
+	}
+	projectDirs := []string{config.SrcDir, config.LayoutsDir, config.IncludesDir, config.DataDir, config.ShortcodesDir, config.StaticDir}
+	return event.Has(fsnotify.Create) && slices.Contains(projectDirs, event.Name)
+}
+
+// Return true if the given path, relative to the project root, matches one of the configured
+// watch ignore patterns. Patterns without a slash, like *.swp, are matched against each component
+// of the path; those with a slash, like src/drafts/*, against the start of the path. A trailing slash,
+// as in node_modules/, makes the pattern match only directories.
+// Files excluded from the build by .jorgeignore are ignored too.
+func isWatchIgnored(config *config.Config, path string, isDir bool) bool {
+	if config.IsIgnored(path, isDir) {
+		return true
+	}
+	relPath, err := filepath.Rel(config.RootDir, path)
+	if err != nil {
+		relPath = path
+	}
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for _, pattern := range config.WatchIgnore {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.Trim(pattern, "/")
+		for i, part := range parts {
+			// only the last component of the path can be a file
+			if dirOnly && !isDir && i == len(parts)-1 {
+				continue
+			}
+			candidate := part
+			if strings.Contains(pattern, "/") {
+				candidate = strings.Join(parts[:i+1], "/")
+			}
+			if matched, _ := filepath.Match(pattern, candidate); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // The event broker mediates between the file watcher
 // that publishes site rebuild events
 // and the clients listening for them to refresh the browser
 type EventBroker struct {
-	inEvents        chan string
+	inEvents        chan serverEvent
 	inSubscriptions chan Subscription
-	subscribers     map[uint64]chan string
+	subscribers     map[uint64]chan serverEvent
 	idgen           atomic.Uint64
+	// the id of the last published reload event, increasing with each one
+	lastEventId atomic.Uint64
+	// the data of the last build error event, if the site is currently failing to build
+	buildError string
+	// closed when the server is shutting down, for subscribers to stop listening
+	done chan struct{}
+}
+
+// Subscribers receive either reload events, with their id, or build error events, with the error data.
+// Reloads of css only changes are flagged, so clients can replace their stylesheets instead of the whole page.
+type serverEvent struct {
+	id         uint64
+	cssOnly    bool
+	buildError string
 }
 
 type Subscription struct {
 	id        uint64
-	outEvents chan string
+	outEvents chan serverEvent
+}
+
+// The json data of a build error event.
+type buildErrorData struct {
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
 }
 
 func newEventBroker() *EventBroker {
 	broker := EventBroker{
-		inEvents:        make(chan string),
+		inEvents:        make(chan serverEvent),
 		inSubscriptions: make(chan Subscription),
-		subscribers:     map[uint64]chan string{},
+		subscribers:     map[uint64]chan serverEvent{},
+		done:            make(chan struct{}),
 	}
 
 	go func() {
@@ -183,17 +819,40 @@ func newEventBroker() *EventBroker {
 			select {
 			case msg := <-broker.inSubscriptions:
 				if msg.outEvents != nil {
-					// subscribe
+					// subscribe, letting the client know right away if the site is broken
 					broker.subscribers[msg.id] = msg.outEvents
+					if broker.buildError != "" {
+						msg.outEvents <- serverEvent{buildError: broker.buildError}
+					}
 				} else {
 					// unsubscribe
 					close(broker.subscribers[msg.id])
 					delete(broker.subscribers, msg.id)
 				}
-			case msg := <-broker.inEvents:
+			case event := <-broker.inEvents:
+				if event.buildError == "" {
+					event.id = broker.lastEventId.Add(1)
+				}
+				broker.buildError = event.buildError
+
 				// send the event to all the subscribers
 				for _, outEvents := range broker.subscribers {
-					outEvents <- msg
+					select {
+					case outEvents <- event:
+					default:
+						// the subscriber has an event pending already, replace it since only the
+						// latest site state matters. Only the broker sends, so there's room after draining
+						replacement := event
+						select {
+						case pending := <-outEvents:
+							if event.cssOnly && pending.buildError == "" && !pending.cssOnly {
+								// don't lose the pending page reload
+								replacement.cssOnly = false
+							}
+						default:
+						}
+						outEvents <- replacement
+					}
 				}
 			}
 		}
@@ -202,12 +861,13 @@ func newEventBroker() *EventBroker {
 }
 
 // Adds a subscription to this broker events, returning a subscriber id
-// (useful for unsubscribing later) and a channel where events will be delivered.
-func (broker *EventBroker) subscribe() (uint64, <-chan string) {
+// (useful for unsubscribing later), a channel where events will be delivered
+// and the id of the last reload event published before subscribing.
+func (broker *EventBroker) subscribe() (uint64, <-chan serverEvent, uint64) {
 	id := broker.idgen.Add(1)
-	outEvents := make(chan string)
+	outEvents := make(chan serverEvent, 1)
 	broker.inSubscriptions <- Subscription{id, outEvents}
-	return id, outEvents
+	return id, outEvents, broker.lastEventId.Load()
 }
 
 // Remove the subscriber with the given id from the broker,
@@ -216,7 +876,26 @@ func (broker *EventBroker) unsubscribe(id uint64) {
 	broker.inSubscriptions <- Subscription{id: id, outEvents: nil}
 }
 
-// Publish an event to all the broker subscribers.
-func (broker *EventBroker) publish(event string) {
-	broker.inEvents <- event
+// Notify the broker subscribers that the server is shutting down.
+func (broker *EventBroker) shutdown() {
+	close(broker.done)
+}
+
+// Publish a reload event to all the broker subscribers,
+// flagging if only stylesheets need to be reloaded.
+func (broker *EventBroker) publishReload(cssOnly bool) {
+	broker.inEvents <- serverEvent{cssOnly: cssOnly}
+}
+
+// Publish the given build error to all the broker subscribers,
+// including the template file and line where it happened, if known.
+func (broker *EventBroker) publishBuildError(err error) {
+	data := buildErrorData{Message: err.Error()}
+	var templErr *markup.TemplateError
+	if errors.As(err, &templErr) {
+		data.File = templErr.Path
+		data.Line = templErr.Line
+	}
+	encoded, _ := json.Marshal(data)
+	broker.inEvents <- serverEvent{buildError: string(encoded)}
 }
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/facundoolano/jorge/config"
+	"github.com/facundoolano/jorge/site"
+)
+
+type noopWatcher struct{}
+
+func (watcher noopWatcher) Add(path string) error { return nil }
+func (watcher noopWatcher) Close() error          { return nil }
+
+func TestRebuildStyleChanges(t *testing.T) {
+	projectDir := t.TempDir()
+	srcDir := filepath.Join(projectDir, "src")
+	os.Mkdir(srcDir, DIR_RWE_MODE)
+	os.WriteFile(filepath.Join(srcDir, "index.html"), []byte("<p>hello</p>"), FILE_RW_MODE)
+	cssPath := filepath.Join(srcDir, "main.css")
+	os.WriteFile(cssPath, []byte("p {}"), FILE_RW_MODE)
+	config, err := config.Load(projectDir)
+	assertEqual(t, err, nil)
+
+	broker := newEventBroker()
+	_, events, _ := broker.subscribe()
+	status := &buildStatus{}
+	rebuild := func(website *site.Site, changedPaths []string) (*site.Site, serverEvent) {
+		website = rebuildSite(context.Background(), config, noopWatcher{}, broker, status, website, changedPaths)
+		return website, <-events
+	}
+
+	website, event := rebuild(nil, nil)
+	assert(t, website != nil)
+	assert(t, !event.cssOnly)
+
+	// an incremental build of stylesheets doesn't need a page reload
+	website, event = rebuild(website, []string{cssPath})
+	assert(t, website != nil)
+	assert(t, event.cssOnly)
+
+	// after a failed or canceled build the whole site is rebuilt, and pages may have changed
+	_, event = rebuild(nil, []string{cssPath})
+	assert(t, !event.cssOnly)
+}
+
+func assert(t *testing.T, cond bool) {
+	t.Helper()
+	if !cond {
+		t.Fatalf("%v is false", cond)
+	}
+}
+
+func assertEqual(t *testing.T, a interface{}, b interface{}) {
+	t.Helper()
+	if a != b {
+		t.Fatalf("%v != %v", a, b)
+	}
+}
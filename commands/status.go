@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	BUILD_BUILDING = "building"
+	BUILD_OK       = "ok"
+	BUILD_FAILED   = "failed"
+)
+
+// The state of the latest serve build, exposed at /_status for editor plugins and other tools to poll.
+type buildStatus struct {
+	mutex sync.Mutex
+	State string `json:"state"`
+	// the error message of the last build, if it failed
+	Error string `json:"error,omitempty"`
+	// when the last finished build started and ended, and how long it took in seconds
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Duration   float64   `json:"duration"`
+
+	// called when a build fails after a successful one, or the other way around
+	onChange func(err error)
+}
+
+func (status *buildStatus) start() time.Time {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.State = BUILD_BUILDING
+	return time.Now()
+}
+
+func (status *buildStatus) finish(start time.Time, err error) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	previouslyFailed := status.Error != ""
+	status.StartedAt = start
+	status.FinishedAt = time.Now()
+	status.Duration = status.FinishedAt.Sub(start).Seconds()
+	if err != nil {
+		status.State = BUILD_FAILED
+		status.Error = err.Error()
+	} else {
+		status.State = BUILD_OK
+		status.Error = ""
+	}
+
+	if status.onChange != nil && previouslyFailed != (err != nil) {
+		go status.onChange(err)
+	}
+}
+
+// Return an http.HandlerFunc that responds with the build status as json.
+func makeStatusHandler(status *buildStatus) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		status.mutex.Lock()
+		body, err := json.Marshal(status)
+		status.mutex.Unlock()
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.Write(body)
+	}
+}
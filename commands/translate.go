@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// How long to wait for a translation before giving up, since long texts can take a while.
+const TRANSLATE_TIMEOUT = 60 * time.Second
+
+// A machine translation service, used to pre-fill scaffolded translations.
+type translator interface {
+	Translate(text string, source string, target string) (string, error)
+}
+
+// Return the translator for the given provider name, configured from environment variables:
+// DEEPL_API_KEY for deepl, LIBRETRANSLATE_URL and optionally LIBRETRANSLATE_API_KEY for libretranslate.
+func newTranslator(provider string) (translator, error) {
+	switch provider {
+	case "deepl":
+		key := os.Getenv("DEEPL_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("the DEEPL_API_KEY environment variable is required to translate with deepl")
+		}
+		// free plan keys use a different API host
+		url := "https://api.deepl.com/v2/translate"
+		if strings.HasSuffix(key, ":fx") {
+			url = "https://api-free.deepl.com/v2/translate"
+		}
+		return &deepl{url: url, key: key}, nil
+	case "libretranslate":
+		url := os.Getenv("LIBRETRANSLATE_URL")
+		if url == "" {
+			return nil, fmt.Errorf("the LIBRETRANSLATE_URL environment variable is required to translate with libretranslate")
+		}
+		return &libreTranslate{url: strings.TrimSuffix(url, "/") + "/translate", key: os.Getenv("LIBRETRANSLATE_API_KEY")}, nil
+	}
+	return nil, fmt.Errorf("unknown translation provider '%s'", provider)
+}
+
+type deepl struct {
+	url string
+	key string
+}
+
+func (client *deepl) Translate(text string, source string, target string) (string, error) {
+	request := map[string]interface{}{
+		"text":        []string{text},
+		"source_lang": strings.ToUpper(source),
+		"target_lang": strings.ToUpper(target),
+	}
+	var response struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	headers := map[string]string{"Authorization": "DeepL-Auth-Key " + client.key}
+	if err := postJson(client.url, headers, request, &response); err != nil {
+		return "", err
+	}
+	if len(response.Translations) == 0 {
+		return "", fmt.Errorf("empty response from deepl")
+	}
+	return response.Translations[0].Text, nil
+}
+
+type libreTranslate struct {
+	url string
+	key string
+}
+
+func (client *libreTranslate) Translate(text string, source string, target string) (string, error) {
+	request := map[string]interface{}{
+		"q":      text,
+		"source": source,
+		"target": target,
+		"format": "text",
+	}
+	if client.key != "" {
+		request["api_key"] = client.key
+	}
+	var response struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := postJson(client.url, nil, request, &response); err != nil {
+		return "", err
+	}
+	return response.TranslatedText, nil
+}
+
+// Send the given request as JSON to the url and decode the JSON response into the given value.
+func postJson(url string, headers map[string]string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := http.Client{Timeout: TRANSLATE_TIMEOUT}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("translation request failed with status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
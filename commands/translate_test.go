@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeeplTranslate(t *testing.T) {
+	var request map[string]interface{}
+	var auth, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, contentType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"translations": [{"detected_source_language": "EN", "text": "hola mundo"}]}`))
+	}))
+	defer server.Close()
+
+	client := &deepl{url: server.URL, key: "secret:fx"}
+	text, err := client.Translate("hello world", "en", "es")
+	assertEqual(t, err, nil)
+	assertEqual(t, text, "hola mundo")
+	assertEqual(t, auth, "DeepL-Auth-Key secret:fx")
+	assertEqual(t, contentType, "application/json")
+	assertEqual(t, request["text"].([]interface{})[0], "hello world")
+	assertEqual(t, request["source_lang"], "EN")
+	assertEqual(t, request["target_lang"], "ES")
+}
+
+func TestLibreTranslate(t *testing.T) {
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"translatedText": "hola mundo"}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("LIBRETRANSLATE_URL", server.URL+"/")
+	t.Setenv("LIBRETRANSLATE_API_KEY", "")
+	client, err := newTranslator("libretranslate")
+	assertEqual(t, err, nil)
+	assertEqual(t, client.(*libreTranslate).url, server.URL+"/translate")
+	text, err := client.Translate("hello world", "en", "es")
+	assertEqual(t, err, nil)
+	assertEqual(t, text, "hola mundo")
+	assertEqual(t, request["q"], "hello world")
+	assertEqual(t, request["source"], "en")
+	assertEqual(t, request["target"], "es")
+	assertEqual(t, request["format"], "text")
+	_, found := request["api_key"]
+	assert(t, !found)
+}
+
+func TestTranslateErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/empty") {
+			w.Write([]byte(`{"translations": []}`))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := (&deepl{url: server.URL + "/forbidden", key: "key"}).Translate("hello", "en", "es")
+	assert(t, err != nil)
+	assertEqual(t, err.Error(), "translation request failed with status 403 Forbidden")
+	_, err = (&deepl{url: server.URL + "/empty", key: "key"}).Translate("hello", "en", "es")
+	assert(t, err != nil)
+
+	t.Setenv("DEEPL_API_KEY", "")
+	_, err = newTranslator("deepl")
+	assert(t, err != nil)
+	_, err = newTranslator("other")
+	assert(t, err != nil)
+}
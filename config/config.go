@@ -1,13 +1,16 @@
 package config
 
 import (
-	"errors"
 	"fmt"
 	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/facundoolano/jorge/markup"
 )
 
 // The properties that are depended upon in the source code are declared explicitly in the config struct.
@@ -15,103 +18,371 @@ import (
 // Depending on the command, different defaults will be used (serve is assumed to be a "dev" environment
 // while build is assumed to be prod)
 // Some defaults could be overridden by cli flags (eg disable live reload on serve).
-// The user can override some of those via config yaml.
+// The user can override some of those via config yaml, and per environment with config.<env>.yml overlays.
 // The non declared values found in config yaml will just be passed as site.config values
 
+// Content types of newer or less common file formats, which may be missing from the system mime tables.
+var DEFAULT_MIME_TYPES = map[string]string{
+	".avif":        "image/avif",
+	".gmi":         "text/gemini; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+}
+
+// Classes of the scrollable wrappers of wide tables and code blocks, when scroll_wrappers is set to true.
+var DEFAULT_SCROLL_WRAPPERS = map[string]string{
+	"table": "table-wrapper",
+	"pre":   "code-wrapper",
+}
+
+// Version control and tooling directories, and editor backup, lock and swap files.
+var DEFAULT_WATCH_IGNORE = []string{".git", "node_modules", ".#*", "#*#", "*~", "*.swp", "*.swx", ".DS_Store"}
+
 type Config struct {
+	// the environment the config was loaded for, e.g. prod or dev, which selects the config.<env>.yml overlay
+	Env string
+
 	RootDir     string
 	SrcDir      string
 	TargetDir   string
 	LayoutsDir  string
 	IncludesDir string
 	DataDir     string
+	// parameterized snippets available through the shortcode tag
+	ShortcodesDir string
+	// files copied as is to the target, without looking for front matter, e.g. large binary assets.
+	// Only used when set with the static_dir key
+	StaticDir string
 
-	SiteUrl        string
+	SiteUrl string
+	// the path the site is served under, e.g. /myrepo, or empty if it's served at the root
+	BaseUrl        string
 	PostFormat     string
 	Lang           string
 	HighlightTheme string
+	// when set, code blocks switch to this theme if the browser prefers a dark color scheme
+	HighlightThemeDark string
+	// use css classes instead of inline styles for syntax highlighting
+	HighlightClasses bool
+
+	// the languages of a multilingual site, each expected to have a top-level dir in src/
+	Languages        []string
+	LanguageRedirect bool
+
+	// external commands to render diagram code blocks to svg, by language
+	DiagramCommands map[string]string
+	// external commands to render latex math to svg, for inline and display mode
+	MathCommands map[string]string
+
+	// how long the external commands, e.g. diagram renderers and custom filters, can run before being killed
+	CommandTimeout time.Duration
+	// the names of the environment variables passed to external commands, besides the default ones
+	CommandEnv []string
+
+	// user-defined liquid filters and tags, either as template strings or external commands
+	CustomFilters map[string]interface{}
+	CustomTags    map[string]interface{}
+
+	// default export settings for org files, which can be overridden in their front matter
+	OrgOptions map[string]interface{}
+
+	SmartPunctuation bool
+	// with smart punctuation, convert the quotes and dashes of markdown pages with goldmark's typographer
+	// instead of processing the html output, so they follow the commonmark rules
+	MarkdownTypographer bool
+	ImageAttributes     bool
+	// render org and markdown pages without a layout key with the layout of their collection, post or page, or default
+	LayoutFallback bool
+
+	// render ruby annotations like {漢字|かんじ} in org and markdown files
+	Ruby bool
+	// if set, truncate the post excerpts taken from their first paragraph to this amount of words
+	ExcerptWords int
+
+	// attributes added to links pointing to other sites
+	ExternalLinkRel    string
+	ExternalLinkNewTab bool
+	// add <link rel="alternate"> entries with the page aliases to the head of html pages
+	AliasLinks bool
+	// classes of the divs wrapping wide elements, by tag name, e.g. table and pre,
+	// for the site stylesheet to make them scroll horizontally
+	ScrollWrappers map[string]string
+	// the rules to replace link and resource urls in the html output, see UrlRewrite
+	UrlRewrites []UrlRewrite
+	// download the remote images and media embedded in html pages to the target dir and reference the local copies
+	LocalizeRemoteAssets bool
+	// when serving, load the remote images and media embedded in html pages through the dev server,
+	// which caches them so the preview works offline
+	ProxyRemoteAssets bool
 
 	Minify           bool
 	MinifyExclusions []string
 	LiveReload       bool
 	LinkStatic       bool
 	IncludeDrafts    bool
+	// follow symbolic links in the src directory, instead of skipping them
+	FollowSymlinks bool
+	// exclude posts whose source files aren't committed to the git repository
+	CommittedOnly bool
+	// set the updated date of posts from the last commit that changed their content
+	UpdatedFromGit bool
+	// write a site.json file describing the site pages, for external tools
+	Manifest bool
+	// append an entry to .jorge/history.jsonl after each build, see the history command
+	BuildHistory bool
+	// fail the build when templates output undefined variables
+	StrictVariables bool
 
 	ServerHost string
 	ServerPort int
+	// file name globs of changes that shouldn't trigger a rebuild on serve
+	WatchIgnore []string
+	// how long to wait for more changes before rebuilding on serve
+	WatchDebounce time.Duration
+	// if non zero, rebuild at least this often while changes keep coming in
+	WatchMaxWait time.Duration
+	// content types to serve files with, by extension
+	MimeTypes map[string]string
+	// show a desktop notification when a serve build fails or recovers
+	NotifyDesktop bool
+	// if set, post the build state to this url when a serve build fails or recovers
+	NotifyWebhook string
 
 	pageDefaults map[string]interface{}
 
+	// the patterns of the .jorgeignore file and of the exclude and include config keys, see IsIgnored
+	ignorePatterns  []ignorePattern
+	excludePatterns []ignorePattern
+	includePatterns []ignorePattern
+
 	// the user provided overrides, as found in config.yml
 	// these will passed as found as template context
 	overrides map[string]interface{}
+	// the config keys with interpolated secrets, which are left out of the template context
+	secretKeys []string
 }
 
+// The variable that selects the config environment when not given explicitly.
+const ENV_VARIABLE = "JORGE_ENV"
+
+// The default environments of the build and serve commands, respectively.
+const (
+	PROD_ENV = "prod"
+	DEV_ENV  = "dev"
+)
+
+var envNamePattern = regexp.MustCompile(`^[\w-]+$`)
+
+// Load the project config for the production environment, or the one set in JORGE_ENV.
 func Load(rootDir string) (*Config, error) {
-	// TODO allow to disable minify
+	return LoadEnv(rootDir, "", nil)
+}
+
+// Load the project config.yml and the overlay file of the given environment, if it exists, e.g.
+// config.staging.yml, whose values replace those of config.yml, merging the maps present in both.
+// If env is empty, the JORGE_ENV variable is used, or else the prod environment. The overlay file
+// is only required when the environment is set explicitly.
+// The values of the files are then overridden by JORGE_CONFIG_ environment variables and by the given
+// KEY=VALUE assignments, e.g. from --set flags.
+func LoadEnv(rootDir string, env string, assignments []string) (*Config, error) {
+	return loadEnv(rootDir, env, PROD_ENV, assignments)
+}
+
+func loadEnv(rootDir string, env string, defaultEnv string, assignments []string) (*Config, error) {
+	if env == "" {
+		env = os.Getenv(ENV_VARIABLE)
+	}
+	explicitEnv := env != ""
+	if !explicitEnv {
+		env = defaultEnv
+	}
+	if !envNamePattern.MatchString(env) {
+		return nil, fmt.Errorf("invalid environment name %s", env)
+	}
 
 	config := &Config{
 		RootDir:          rootDir,
+		Env:              env,
 		SrcDir:           filepath.Join(rootDir, "src"),
 		TargetDir:        filepath.Join(rootDir, "target"),
 		LayoutsDir:       filepath.Join(rootDir, "layouts"),
 		IncludesDir:      filepath.Join(rootDir, "includes"),
 		DataDir:          filepath.Join(rootDir, "data"),
+		ShortcodesDir:    filepath.Join(rootDir, "shortcodes"),
 		PostFormat:       "blog/:title.org",
 		Lang:             "en",
 		HighlightTheme:   "github",
+		DiagramCommands:  map[string]string{},
+		MathCommands:     map[string]string{},
+		SmartPunctuation: true,
 		Minify:           true,
 		MinifyExclusions: make([]string, 0),
+		Languages:        make([]string, 0),
 		LiveReload:       false,
 		LinkStatic:       false,
 		IncludeDrafts:    false,
+		FollowSymlinks:   true,
+		WatchIgnore:      DEFAULT_WATCH_IGNORE,
+		WatchDebounce:    100 * time.Millisecond,
+		MimeTypes:        maps.Clone(DEFAULT_MIME_TYPES),
+		CommandTimeout:   markup.DEFAULT_COMMAND_TIMEOUT,
+		CommandEnv:       make([]string, 0),
 		pageDefaults:     map[string]interface{}{},
 	}
 
-	// load overrides from config.yml
-	configPath := filepath.Join(rootDir, "config.yml")
-	yamlContent, err := os.ReadFile(configPath)
+	ignorePatterns, err := loadIgnorePatterns(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	config.ignorePatterns = ignorePatterns
 
-	if errors.Is(err, os.ErrNotExist) {
-		// config file is not mandatory
+	// load overrides from config.yml and the environment overlay
+	overrides, err := loadOptionalConfigFile(filepath.Join(rootDir, "config.yml"))
+	if err != nil {
+		return nil, err
+	}
+	envPath := filepath.Join(rootDir, "config."+env+".yml")
+	envOverrides, err := loadOptionalConfigFile(envPath)
+	if err != nil {
+		return nil, err
+	}
+	if envOverrides == nil && explicitEnv {
+		return nil, fmt.Errorf("missing config file for the %s environment: %s", env, envPath)
+	}
+	assignments = append(envAssignments(), assignments...)
+	if overrides == nil && envOverrides == nil && len(assignments) == 0 {
+		// config files are not mandatory
 		return config, nil
-	} else if err != nil {
+	}
+	config.overrides, err = applyAssignments(mergeConfig(overrides, envOverrides), assignments)
+	if err != nil {
 		return nil, err
 	}
 
-	err = yaml.Unmarshal(yamlContent, &config.overrides)
-	if err != nil {
-		return nil, fmt.Errorf("invalid yaml format: File '%s', %w", configPath, err)
+	// the command settings are needed to decrypt the secrets, so they are read before interpolating them
+	values := &overrideReader{overrides: config.overrides}
+	var commandTimeout string
+	if values.String("command_timeout", &commandTimeout) {
+		if config.CommandTimeout, err = time.ParseDuration(commandTimeout); err != nil || config.CommandTimeout <= 0 {
+			return nil, fmt.Errorf("invalid command_timeout %s, expected a positive duration like 30s", commandTimeout)
+		}
+	}
+	values.StringList("command_env", &config.CommandEnv)
+	if values.err != nil {
+		return nil, values.err
+	}
+	if config.secretKeys, err = interpolateSecrets(config.CommandRunner(), config.overrides); err != nil {
+		return nil, err
 	}
 
 	// set user-provided overrides of declared config keys
-	// FIXME less copypasty way of declaring config overrides
-	if url, found := config.overrides["url"]; found {
-		config.SiteUrl = url.(string)
+	values.String("url", &config.SiteUrl)
+	if values.String("baseurl", &config.BaseUrl) {
+		config.BaseUrl = normalizeBaseUrl(config.BaseUrl)
+	}
+	var staticDir string
+	if values.String("static_dir", &staticDir) && staticDir != "" {
+		config.StaticDir = staticDir
+		if !filepath.IsAbs(staticDir) {
+			config.StaticDir = filepath.Join(rootDir, staticDir)
+		}
 	}
-	if format, found := config.overrides["post_format"]; found {
-		config.PostFormat = format.(string)
+	values.String("post_format", &config.PostFormat)
+	values.String("lang", &config.Lang)
+	values.StringList("languages", &config.Languages)
+	values.Bool("language_redirect", &config.LanguageRedirect)
+	values.String("highlight_theme", &config.HighlightTheme)
+	values.Bool("highlight_classes", &config.HighlightClasses)
+	if values.String("highlight_theme_dark", &config.HighlightThemeDark) {
+		// switching themes with a media query requires class based highlighting
+		config.HighlightClasses = true
 	}
-	if lang, found := config.overrides["lang"]; found {
-		config.Lang = lang.(string)
+	values.Bool("ruby", &config.Ruby)
+	values.Int("excerpt_words", &config.ExcerptWords)
+	values.Bool("smart_punctuation", &config.SmartPunctuation)
+	values.Bool("markdown_typographer", &config.MarkdownTypographer)
+	values.Bool("layout_fallback", &config.LayoutFallback)
+	values.Bool("image_attributes", &config.ImageAttributes)
+	values.String("external_link_rel", &config.ExternalLinkRel)
+	values.Bool("external_link_new_tab", &config.ExternalLinkNewTab)
+	if exclude, found := config.overrides["exclude"]; found {
+		if config.excludePatterns, err = parseGlobList("exclude", exclude); err != nil {
+			return nil, err
+		}
 	}
-	if theme, found := config.overrides["highlight_theme"]; found {
-		config.HighlightTheme = theme.(string)
+	if include, found := config.overrides["include"]; found {
+		if config.includePatterns, err = parseGlobList("include", include); err != nil {
+			return nil, err
+		}
 	}
-	if exclusions, found := config.overrides["minify_exclusions"]; found {
-		for _, exclusion := range exclusions.([]interface{}) {
-			config.MinifyExclusions = append(config.MinifyExclusions, exclusion.(string))
+	values.Bool("alias_links", &config.AliasLinks)
+	if wrappers, found := config.overrides["scroll_wrappers"]; found {
+		switch wrappers := wrappers.(type) {
+		case bool:
+			if wrappers {
+				config.ScrollWrappers = maps.Clone(DEFAULT_SCROLL_WRAPPERS)
+			}
+		case map[string]interface{}:
+			config.ScrollWrappers = make(map[string]string)
+			values.StringMap("scroll_wrappers", config.ScrollWrappers)
+		default:
+			return nil, fmt.Errorf("invalid scroll_wrappers, expected true or a map of tag names to classes")
 		}
 	}
-
+	values.StringMap("diagrams", config.DiagramCommands)
+	values.StringMap("math", config.MathCommands)
+	values.Bool("committed_only", &config.CommittedOnly)
+	if rewrites, found := config.overrides["url_rewrites"]; found {
+		if config.UrlRewrites, err = parseUrlRewrites(rewrites); err != nil {
+			return nil, err
+		}
+	}
+	values.Bool("localize_remote_assets", &config.LocalizeRemoteAssets)
+	values.Bool("follow_symlinks", &config.FollowSymlinks)
+	values.Bool("updated_from_git", &config.UpdatedFromGit)
+	values.Bool("manifest", &config.Manifest)
+	values.Bool("build_history", &config.BuildHistory)
+	values.Bool("strict_variables", &config.StrictVariables)
+	values.Map("liquid_filters", &config.CustomFilters)
+	values.Map("liquid_tags", &config.CustomTags)
+	values.Map("org", &config.OrgOptions)
+	if _, found := config.overrides["watch_ignore"]; found {
+		config.WatchIgnore = make([]string, 0)
+		values.StringList("watch_ignore", &config.WatchIgnore)
+	}
+	var debounce, maxWait string
+	if values.String("watch_debounce", &debounce) {
+		if config.WatchDebounce, err = time.ParseDuration(debounce); err != nil {
+			return nil, fmt.Errorf("invalid watch_debounce: %w", err)
+		}
+	}
+	if values.String("watch_max_wait", &maxWait) {
+		if config.WatchMaxWait, err = time.ParseDuration(maxWait); err != nil {
+			return nil, fmt.Errorf("invalid watch_max_wait: %w", err)
+		}
+	}
+	mimeTypes := make(map[string]string)
+	values.StringMap("mime_types", mimeTypes)
+	for ext, mimeType := range mimeTypes {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		config.MimeTypes[ext] = mimeType
+	}
+	values.Bool("notify_desktop", &config.NotifyDesktop)
+	values.String("notify_webhook", &config.NotifyWebhook)
+	values.StringList("minify_exclusions", &config.MinifyExclusions)
+	if values.err != nil {
+		return nil, values.err
+	}
 	return config, nil
 }
 
-func LoadDev(rootDir string, host string, port int, reload bool) (*Config, error) {
+func LoadDev(rootDir string, env string, assignments []string, host string, port int, reload bool) (*Config, error) {
 	// TODO revisit is this Load vs LoadDevServer is the best way to handle both modes
 	// TODO some of the options need to be overridable: host, port, live reload at least
 
-	config, err := Load(rootDir)
+	config, err := loadEnv(rootDir, env, DEV_ENV, assignments)
 	if err != nil {
 		return nil, err
 	}
@@ -124,14 +395,60 @@ func LoadDev(rootDir string, host string, port int, reload bool) (*Config, error
 	config.LinkStatic = true
 	config.IncludeDrafts = true
 	config.SiteUrl = fmt.Sprintf("http://%s:%d", config.ServerHost, config.ServerPort)
+	values := &overrideReader{overrides: config.overrides}
+	values.Bool("proxy_remote_assets", &config.ProxyRemoteAssets)
+	if values.err != nil {
+		return nil, values.err
+	}
 
 	return config, nil
 }
 
+// Replace the site url from config.yml with the given one, e.g. to build a staging version of the site.
+// If the url has a path, e.g. https://pr-12.example.io/preview, it replaces the base url, as if
+// it was set with the baseurl key, otherwise the configured base url is kept.
+func (config *Config) OverrideSiteUrl(siteUrl string) error {
+	parsed, err := url.Parse(siteUrl)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("invalid site url %s, expected an absolute url like https://example.com", siteUrl)
+	}
+	if config.overrides == nil {
+		config.overrides = make(map[string]interface{})
+	}
+	config.SiteUrl = parsed.Scheme + "://" + parsed.Host
+	config.overrides["url"] = config.SiteUrl
+	if baseUrl := normalizeBaseUrl(parsed.Path); baseUrl != "" {
+		config.BaseUrl = baseUrl
+		config.overrides["baseurl"] = baseUrl
+	}
+	return nil
+}
+
+// Return the given base url with a leading slash and without a trailing one, or empty for the root.
+func normalizeBaseUrl(baseUrl string) string {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+	if baseUrl != "" && !strings.HasPrefix(baseUrl, "/") {
+		baseUrl = "/" + baseUrl
+	}
+	return baseUrl
+}
+
+// Return a runner for the external commands of the project, with the configured timeout and
+// environment variables, run from the project root.
+func (config Config) CommandRunner() *markup.CommandRunner {
+	return &markup.CommandRunner{Timeout: config.CommandTimeout, Env: config.CommandEnv, Dir: config.RootDir}
+}
+
 func (config Config) AsContext() map[string]interface{} {
 	context := map[string]interface{}{
 		"url": config.SiteUrl,
+		"env": config.Env,
 	}
 	maps.Copy(context, config.overrides)
+	// keep credentials out of the rendered pages
+	delete(context, "secrets")
+	for _, key := range config.secretKeys {
+		delete(context, key)
+	}
 	return context
 }
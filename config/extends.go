@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parse the yaml config file at the given path. If it has an `extends` key with the path of another
+// config file, relative to this one, the values of that base config are used as defaults:
+//
+//	extends: ../shared/config.yml
+//
+// Maps are merged recursively, other values in this file replace those of the base config.
+// Base configs can extend other ones.
+func loadConfigFile(path string, seen ...string) (map[string]interface{}, error) {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	if slices.Contains(seen, path) {
+		return nil, fmt.Errorf("config extends cycle: %s -> %s", strings.Join(seen, " -> "), path)
+	}
+
+	yamlContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(yamlContent, &values); err != nil {
+		return nil, fmt.Errorf("invalid yaml format: File '%s', %w", path, err)
+	}
+
+	extends, found := values["extends"]
+	if !found {
+		return values, nil
+	}
+	delete(values, "extends")
+	basePath, ok := extends.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid extends value in %s, expected a file path", path)
+	}
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(filepath.Dir(path), basePath)
+	}
+
+	base, err := loadConfigFile(filepath.Clean(basePath), append(seen, path)...)
+	if err != nil {
+		return nil, err
+	}
+	return mergeConfig(base, values), nil
+}
+
+// Like loadConfigFile, but returns nil if the file doesn't exist.
+func loadOptionalConfigFile(path string) (map[string]interface{}, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return loadConfigFile(path)
+}
+
+// Return the base map with the values of the overrides map, merging the nested maps present in both.
+func mergeConfig(base map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		base = make(map[string]interface{})
+	}
+	for key, value := range overrides {
+		baseMap, baseIsMap := base[key].(map[string]interface{})
+		valueMap, valueIsMap := value.(map[string]interface{})
+		if baseIsMap && valueIsMap {
+			base[key] = mergeConfig(baseMap, valueMap)
+		} else {
+			base[key] = value
+		}
+	}
+	return base
+}
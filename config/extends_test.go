@@ -0,0 +1,115 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtendsChain(t *testing.T) {
+	rootDir := t.TempDir()
+	sharedDir := filepath.Join(rootDir, "shared")
+	os.MkdirAll(filepath.Join(sharedDir, "base"), 0777)
+	os.MkdirAll(filepath.Join(rootDir, "site"), 0777)
+
+	// paths are relative to the file that extends, not to the project
+	writeFile(filepath.Join(sharedDir, "base"), "config.yml", `
+lang: es
+highlight_theme: monokai
+author:
+  name: base
+  email: base@example.com
+  social:
+    mastodon: "@base"
+`)
+	writeFile(sharedDir, "config.yml", `
+extends: base/config.yml
+lang: en
+author:
+  name: shared
+  social:
+    github: shared
+`)
+	writeFile(filepath.Join(rootDir, "site"), "config.yml", `
+extends: ../shared/config.yml
+url: https://olano.dev
+author:
+  email: site@example.com
+`)
+
+	config, err := Load(filepath.Join(rootDir, "site"))
+	assertEqual(t, err, nil)
+	assertEqual(t, config.SiteUrl, "https://olano.dev")
+	assertEqual(t, config.Lang, "en")
+	assertEqual(t, config.HighlightTheme, "monokai")
+
+	// nested maps are merged at every level
+	context := config.AsContext()
+	author := context["author"].(map[string]interface{})
+	assertEqual(t, author["name"], "shared")
+	assertEqual(t, author["email"], "site@example.com")
+	social := author["social"].(map[string]interface{})
+	assertEqual(t, social["mastodon"], "@base")
+	assertEqual(t, social["github"], "shared")
+	_, found := context["extends"]
+	assert(t, !found)
+}
+
+func TestExtendsCycle(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFile(rootDir, "config.yml", "extends: a.yml\n")
+	writeFile(rootDir, "a.yml", "extends: b.yml\n")
+	writeFile(rootDir, "b.yml", "extends: ./a.yml\n")
+
+	_, err := Load(rootDir)
+	assert(t, err != nil)
+	aPath := filepath.Join(rootDir, "a.yml")
+	assert(t, strings.HasPrefix(err.Error(), "config extends cycle: "))
+	assert(t, strings.HasSuffix(err.Error(), filepath.Join(rootDir, "b.yml")+" -> "+aPath))
+
+	writeFile(rootDir, "config.yml", "extends: config.yml\n")
+	_, err = Load(rootDir)
+	assert(t, err != nil)
+	assert(t, strings.HasPrefix(err.Error(), "config extends cycle: "))
+}
+
+func TestExtendsErrors(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFile(rootDir, "config.yml", "extends: missing.yml\n")
+	_, err := Load(rootDir)
+	assert(t, err != nil)
+
+	writeFile(rootDir, "config.yml", "extends: [a.yml, b.yml]\n")
+	_, err = Load(rootDir)
+	assert(t, err != nil)
+	assert(t, strings.HasPrefix(err.Error(), "invalid extends value"))
+}
+
+func TestMergeConfig(t *testing.T) {
+	base := map[string]interface{}{
+		"title": "base",
+		"tags":  []interface{}{"a"},
+		"nav":   map[string]interface{}{"home": "/", "about": "/about"},
+		"other": map[string]interface{}{"key": "value"},
+	}
+	overrides := map[string]interface{}{
+		"tags":  []interface{}{"b"},
+		"nav":   map[string]interface{}{"about": "/me", "blog": "/blog"},
+		"other": "replaced",
+	}
+
+	merged := mergeConfig(base, overrides)
+	assertEqual(t, merged["title"], "base")
+	// lists and values of different types are replaced, not merged
+	assertEqual(t, len(merged["tags"].([]interface{})), 1)
+	assertEqual(t, merged["tags"].([]interface{})[0], "b")
+	assertEqual(t, merged["other"], "replaced")
+	nav := merged["nav"].(map[string]interface{})
+	assertEqual(t, nav["home"], "/")
+	assertEqual(t, nav["about"], "/me")
+	assertEqual(t, nav["blog"], "/blog")
+
+	merged = mergeConfig(nil, overrides)
+	assertEqual(t, merged["other"], "replaced")
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The file at the project root listing, in gitignore syntax, the source files to leave out
+// of the build and the watcher, e.g. scratch notes kept next to the content.
+const IGNORE_FILE = ".jorgeignore"
+
+type ignorePattern struct {
+	glob string
+	// the pattern started with !, re-including the paths excluded by previous patterns
+	negate bool
+	// the pattern ended with /, matching only directories
+	dirOnly bool
+	// the pattern had a slash at the start or middle, matching paths relative to the project root
+	// instead of file names at any level
+	anchored bool
+}
+
+// Parse the ignore file at the given project root, if any.
+func loadIgnorePatterns(rootDir string) ([]ignorePattern, error) {
+	file, err := os.Open(filepath.Join(rootDir, IGNORE_FILE))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, err := parseIgnorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in %s: %w", IGNORE_FILE, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
+
+// Parse the given gitignore-style pattern.
+func parseIgnorePattern(line string) (ignorePattern, error) {
+	var pattern ignorePattern
+	if line, pattern.negate = strings.CutPrefix(line, "!"); !pattern.negate {
+		// \! and \# escape a literal leading character
+		line = strings.TrimPrefix(line, `\`)
+	}
+	line, pattern.dirOnly = strings.CutSuffix(line, "/")
+	pattern.anchored = strings.Contains(line, "/")
+	pattern.glob = strings.TrimPrefix(line, "/")
+	if _, err := path.Match(pattern.glob, ""); err != nil {
+		return pattern, fmt.Errorf("%s: %w", line, err)
+	}
+	return pattern, nil
+}
+
+// Parse the patterns of the exclude or include config keys.
+func parseGlobList(key string, value interface{}) ([]ignorePattern, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s, expected a list of patterns", key)
+	}
+	var patterns []ignorePattern
+	for _, value := range values {
+		line, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s, expected a list of patterns", key)
+		}
+		pattern, err := parseIgnorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %w", key, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Return true if the given project file or directory is excluded by the .jorgeignore patterns or
+// the exclude config, either directly or because one of its parent directories is, and not forced
+// back by the include config.
+func (config *Config) IsIgnored(filePath string, isDir bool) bool {
+	if config.IsIncluded(filePath, isDir) {
+		return false
+	}
+	return isExcluded(config.ignorePatterns, relativeParts(config.RootDir, filePath), isDir) ||
+		isExcluded(config.excludePatterns, relativeParts(config.SrcDir, filePath), isDir)
+}
+
+// Return true if the given src file matches the include config patterns, and thus should be
+// processed even if it's a dot file or otherwise excluded. Directories are considered included
+// if they could contain included files, e.g. .well-known for .well-known/**.
+func (config *Config) IsIncluded(filePath string, isDir bool) bool {
+	parts := relativeParts(config.SrcDir, filePath)
+	if parts == nil {
+		return false
+	}
+	for _, pattern := range config.includePatterns {
+		if matchesPattern(pattern, parts, isDir) || (isDir && pattern.anchored && globPrefix(strings.Split(pattern.glob, "/"), parts)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the components of the given path relative to the given dir, or nil if it's outside of it.
+func relativeParts(dir string, filePath string) []string {
+	relPath, err := filepath.Rel(dir, filePath)
+	if err != nil || relPath == "." || !filepath.IsLocal(relPath) {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(relPath), "/")
+}
+
+// Return true if the patterns exclude the given path or one of its parent directories.
+func isExcluded(patterns []ignorePattern, parts []string, isDir bool) bool {
+	if len(patterns) == 0 || parts == nil {
+		return false
+	}
+	// as in git, files can't be re-included if their directory is excluded
+	for i := 1; i < len(parts); i++ {
+		if matchesIgnore(patterns, parts[:i], true) {
+			return true
+		}
+	}
+	return matchesIgnore(patterns, parts, isDir)
+}
+
+// Return true if the last pattern matching the given path excludes it.
+func matchesIgnore(patterns []ignorePattern, parts []string, isDir bool) bool {
+	ignored := false
+	for _, pattern := range patterns {
+		if matchesPattern(pattern, parts, isDir) {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
+
+func matchesPattern(pattern ignorePattern, parts []string, isDir bool) bool {
+	if pattern.dirOnly && !isDir {
+		return false
+	}
+	if pattern.anchored {
+		return globMatch(strings.Split(pattern.glob, "/"), parts)
+	}
+	matched, _ := path.Match(pattern.glob, parts[len(parts)-1])
+	return matched
+}
+
+// Return true if the path components could be the start of a path matching the glob ones.
+func globPrefix(glob []string, parts []string) bool {
+	if len(parts) == 0 {
+		return true
+	}
+	if len(glob) == 0 {
+		return false
+	}
+	if glob[0] == "**" {
+		return true
+	}
+	if matched, _ := path.Match(glob[0], parts[0]); !matched {
+		return false
+	}
+	return globPrefix(glob[1:], parts[1:])
+}
+
+// Match the path components against the glob ones, where ** matches any number of directories.
+func globMatch(glob []string, parts []string) bool {
+	if len(glob) == 0 {
+		return len(parts) == 0
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if globMatch(glob[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(glob[0], parts[0]); !matched {
+		return false
+	}
+	return globMatch(glob[1:], parts[1:])
+}
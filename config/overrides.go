@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The prefix of the environment variables that override config keys. It's distinct from the one of
+// the variables that configure the command line tool, e.g. JORGE_ENV and JORGE_URL, so these are
+// never mistaken for config keys.
+const ENV_OVERRIDE_PREFIX = "JORGE_CONFIG_"
+
+// Return the config assignments set with environment variables, as KEY=VALUE strings. The key is the
+// lowercased variable name without the JORGE_CONFIG_ prefix, and double underscores separate the keys of
+// nested maps, e.g. JORGE_CONFIG_HIGHLIGHT_THEME=monokai sets highlight_theme and
+// JORGE_CONFIG_ANALYTICS__ID=abc sets the id of the analytics map.
+func envAssignments() []string {
+	var assignments []string
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		key, found := strings.CutPrefix(name, ENV_OVERRIDE_PREFIX)
+		if !found || key == "" {
+			continue
+		}
+		key = strings.ToLower(strings.ReplaceAll(key, "__", "."))
+		assignments = append(assignments, key+"="+value)
+	}
+	slices.Sort(assignments)
+	return assignments
+}
+
+// Set the values of the given KEY=VALUE assignments in the config overrides, where dots in the key
+// separate nested maps, e.g. analytics.id=abc. Values are parsed as yaml, so booleans, numbers and
+// lists get the same types as in config.yml.
+func applyAssignments(overrides map[string]interface{}, assignments []string) (map[string]interface{}, error) {
+	if overrides == nil {
+		overrides = make(map[string]interface{})
+	}
+	for _, assignment := range assignments {
+		key, rawValue, found := strings.Cut(assignment, "=")
+		parts := strings.Split(key, ".")
+		if !found || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("invalid config override %s, expected KEY=VALUE", assignment)
+		}
+
+		var value interface{} = rawValue
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(rawValue), &parsed); err == nil && parsed != nil {
+			value = parsed
+		}
+
+		values := overrides
+		for _, part := range parts[:len(parts)-1] {
+			nested, ok := values[part].(map[string]interface{})
+			if !ok {
+				nested = make(map[string]interface{})
+				values[part] = nested
+			}
+			values = nested
+		}
+		values[parts[len(parts)-1]] = value
+	}
+	return overrides, nil
+}
+
+// Reads the values of declared config keys from the overrides, checking their types. The first
+// type error, e.g. from a mistyped --set flag, is kept in err, so the keys can be read one after another.
+type overrideReader struct {
+	overrides map[string]interface{}
+	err       error
+}
+
+// Return the value of the given key, if present and no error was found before.
+func (reader *overrideReader) get(key string) (interface{}, bool) {
+	if reader.err != nil {
+		return nil, false
+	}
+	value, found := reader.overrides[key]
+	return value, found
+}
+
+func (reader *overrideReader) fail(key string, value interface{}, expected string) bool {
+	reader.err = fmt.Errorf("invalid %s value %v, expected %s", key, value, expected)
+	return false
+}
+
+// Set the target to the string value of the key, if present. Returns true if it was set.
+func (reader *overrideReader) String(key string, target *string) bool {
+	value, found := reader.get(key)
+	if !found {
+		return false
+	}
+	str, ok := value.(string)
+	if !ok {
+		return reader.fail(key, value, "a string")
+	}
+	*target = str
+	return true
+}
+
+// Set the target to the boolean value of the key, if present. Returns true if it was set.
+func (reader *overrideReader) Bool(key string, target *bool) bool {
+	value, found := reader.get(key)
+	if !found {
+		return false
+	}
+	boolean, ok := value.(bool)
+	if !ok {
+		return reader.fail(key, value, "true or false")
+	}
+	*target = boolean
+	return true
+}
+
+// Set the target to the integer value of the key, if present. Returns true if it was set.
+func (reader *overrideReader) Int(key string, target *int) bool {
+	value, found := reader.get(key)
+	if !found {
+		return false
+	}
+	number, ok := value.(int)
+	if !ok {
+		return reader.fail(key, value, "an integer")
+	}
+	*target = number
+	return true
+}
+
+// Set the target to the map value of the key, if present. Returns true if it was set.
+func (reader *overrideReader) Map(key string, target *map[string]interface{}) bool {
+	value, found := reader.get(key)
+	if !found {
+		return false
+	}
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return reader.fail(key, value, "a map")
+	}
+	*target = valueMap
+	return true
+}
+
+// Set the target to the list of strings of the key, if present. Returns true if it was set.
+func (reader *overrideReader) StringList(key string, target *[]string) bool {
+	value, found := reader.get(key)
+	if !found {
+		return false
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		return reader.fail(key, value, "a list of strings")
+	}
+	list := make([]string, 0, len(values))
+	for _, item := range values {
+		str, ok := item.(string)
+		if !ok {
+			return reader.fail(key, value, "a list of strings")
+		}
+		list = append(list, str)
+	}
+	*target = list
+	return true
+}
+
+// Add the entries of the string map of the key, if present, to the target. Returns true if it was found.
+func (reader *overrideReader) StringMap(key string, target map[string]string) bool {
+	value, found := reader.get(key)
+	if !found {
+		return false
+	}
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		return reader.fail(key, value, "a map of strings")
+	}
+	for name, item := range values {
+		str, ok := item.(string)
+		if !ok {
+			return reader.fail(key, value, "a map of strings")
+		}
+		target[name] = str
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFile(rootDir, "config.yml", `
+url: https://olano.dev
+excerpt_words: 50
+analytics:
+  id: main
+  enabled: false
+`)
+
+	t.Setenv("JORGE_CONFIG_ANALYTICS__ID", "ci")
+	t.Setenv("JORGE_CONFIG_EXCERPT_WORDS", "10")
+	// variables that configure the command line tool aren't config keys
+	t.Setenv("JORGE_URL", "https://preview.olano.dev")
+	t.Setenv("JORGE_CACHE_DIR", t.TempDir())
+
+	config, err := Load(rootDir)
+	assertEqual(t, err, nil)
+	assertEqual(t, config.ExcerptWords, 10)
+	assertEqual(t, config.SiteUrl, "https://olano.dev")
+	analytics := config.AsContext()["analytics"].(map[string]interface{})
+	assertEqual(t, analytics["id"], "ci")
+	assertEqual(t, analytics["enabled"], false)
+	_, found := config.AsContext()["cache_dir"]
+	assert(t, !found)
+}
+
+func TestSetOverrides(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFile(rootDir, "config.yml", `
+url: https://olano.dev
+analytics:
+  id: main
+`)
+
+	// flag assignments take precedence over environment variables
+	t.Setenv("JORGE_CONFIG_URL", "https://ci.olano.dev")
+	config, err := LoadEnv(rootDir, "", []string{"analytics.enabled=true", "url=https://preview.olano.dev", "languages=[en, es]"})
+	assertEqual(t, err, nil)
+	assertEqual(t, config.SiteUrl, "https://preview.olano.dev")
+	assertEqual(t, strings.Join(config.Languages, ","), "en,es")
+	analytics := config.AsContext()["analytics"].(map[string]interface{})
+	assertEqual(t, analytics["id"], "main")
+	assertEqual(t, analytics["enabled"], true)
+
+	_, err = LoadEnv(rootDir, "", []string{"no value"})
+	assert(t, err != nil)
+	_, err = LoadEnv(rootDir, "", []string{"analytics..id=x"})
+	assert(t, err != nil)
+
+	// values of the wrong type are reported instead of panicking
+	_, err = LoadEnv(rootDir, "", []string{"smart_punctuation=yes please"})
+	assert(t, err != nil)
+	assertEqual(t, err.Error(), "invalid smart_punctuation value yes please, expected true or false")
+	_, err = LoadDev(rootDir, "", []string{"proxy_remote_assets=1"}, "localhost", 4001, false)
+	assert(t, err != nil)
+}
+
+func TestOverrideSiteUrl(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFile(rootDir, "config.yml", `
+url: https://olano.dev
+baseurl: /blog
+`)
+
+	config, err := Load(rootDir)
+	assertEqual(t, err, nil)
+	err = config.OverrideSiteUrl("https://staging.olano.dev/")
+	assertEqual(t, err, nil)
+	assertEqual(t, config.SiteUrl, "https://staging.olano.dev")
+	assertEqual(t, config.BaseUrl, "/blog")
+
+	// the path of the url replaces the base url
+	err = config.OverrideSiteUrl("https://pr-12.example.io/preview/")
+	assertEqual(t, err, nil)
+	assertEqual(t, config.SiteUrl, "https://pr-12.example.io")
+	assertEqual(t, config.BaseUrl, "/preview")
+	assertEqual(t, config.AsContext()["url"], "https://pr-12.example.io")
+	assertEqual(t, config.AsContext()["baseurl"], "/preview")
+
+	assert(t, config.OverrideSiteUrl("pr-12.example.io") != nil)
+	assert(t, config.OverrideSiteUrl("https://pr-12.example.io/?preview=1") != nil)
+}
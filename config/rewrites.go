@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A rule of the url_rewrites config, which replaces the urls in the html output that start with
+// a prefix or match a regular expression, e.g. to serve media files from a CDN:
+//
+//	url_rewrites:
+//	  - prefix: /media/
+//	    replace: https://cdn.example.com/media/
+//	  - pattern: ^/downloads/(.+)\.zip$
+//	    replace: https://dl.example.com/$1.zip
+//
+// The first matching rule is applied. Rules can be limited to production builds by declaring
+// them in config.prod.yml.
+type UrlRewrite struct {
+	prefix  string
+	pattern *regexp.Regexp
+	replace string
+}
+
+// Parse the rules of the url_rewrites config key.
+func parseUrlRewrites(value interface{}) ([]UrlRewrite, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid url_rewrites, expected a list of rules")
+	}
+
+	var rules []UrlRewrite
+	for _, value := range values {
+		options, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid url_rewrites rule %v, expected prefix or pattern and replace keys", value)
+		}
+		var rule UrlRewrite
+		rule.prefix, _ = options["prefix"].(string)
+		pattern, _ := options["pattern"].(string)
+		replace, hasReplace := options["replace"].(string)
+		if (rule.prefix == "") == (pattern == "") || !hasReplace {
+			return nil, fmt.Errorf("invalid url_rewrites rule %v, expected prefix or pattern and replace keys", value)
+		}
+		rule.replace = replace
+		if pattern != "" {
+			var err error
+			if rule.pattern, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid url_rewrites pattern %s: %w", pattern, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Return the given url with the first matching url_rewrites rule applied, if any.
+func (config *Config) RewriteUrl(url string) string {
+	for _, rule := range config.UrlRewrites {
+		if rule.pattern != nil {
+			if rule.pattern.MatchString(url) {
+				return rule.pattern.ReplaceAllString(url, rule.replace)
+			}
+		} else if rest, found := strings.CutPrefix(url, rule.prefix); found {
+			return rule.replace + rest
+		}
+	}
+	return url
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/facundoolano/jorge/markup"
+	"gopkg.in/yaml.v3"
+)
+
+// The command used to decrypt the secrets file, if not configured otherwise.
+// The path of the file is passed as its last argument.
+const DEFAULT_SECRETS_COMMAND = "sops --decrypt"
+
+// Matches ${NAME} references, and $${NAME} escapes of a literal ${NAME}.
+var secretPattern = regexp.MustCompile(`\$?\$\{(\w+)\}`)
+
+// Replace `${NAME}` references in the string values of the config keys listed in `secrets.keys`
+// with the value of the NAME environment variable or, if it's not set, with the NAME key of the
+// secrets file. Use `$${NAME}` for a literal `${NAME}`. The secrets are configured as:
+//
+//	secrets:
+//	  keys: [notify_webhook, deploy]
+//	  file: secrets.enc.yml
+//	  command: sops --decrypt
+//
+// where the file is expected to decrypt to a yaml map. This way credentials can be kept out of config.yml.
+// Returns the interpolated keys, which are left out of the template context.
+func interpolateSecrets(runner *markup.CommandRunner, overrides map[string]interface{}) ([]string, error) {
+	settings, _ := overrides["secrets"].(map[string]interface{})
+	values := &overrideReader{overrides: settings}
+	var keys []string
+	values.StringList("keys", &keys)
+	if values.err != nil {
+		return nil, fmt.Errorf("invalid secrets config: %w", values.err)
+	}
+
+	var secrets map[string]interface{}
+	loadedSecrets := false
+	lookup := func(name string) (string, error) {
+		if value, found := os.LookupEnv(name); found {
+			return value, nil
+		}
+		// only decrypt the file if there's a reference not found in the environment
+		if !loadedSecrets {
+			var err error
+			if secrets, err = decryptSecrets(runner, settings); err != nil {
+				return "", err
+			}
+			loadedSecrets = true
+		}
+		if value, found := secrets[name]; found {
+			return fmt.Sprint(value), nil
+		}
+		return "", fmt.Errorf("undefined secret ${%s}", name)
+	}
+
+	for _, key := range keys {
+		value, found := overrides[key]
+		if !found || key == "secrets" {
+			continue
+		}
+		interpolated, err := interpolate(value, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config value for %s: %w", key, err)
+		}
+		overrides[key] = interpolated
+	}
+	return keys, nil
+}
+
+// Recursively replace secret references in the strings found in the given yaml value.
+func interpolate(value interface{}, lookup func(string) (string, error)) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		var err error
+		result := secretPattern.ReplaceAllStringFunc(value, func(match string) string {
+			if strings.HasPrefix(match, "$$") {
+				return match[1:]
+			}
+			secret, lookupErr := lookup(secretPattern.FindStringSubmatch(match)[1])
+			if lookupErr != nil && err == nil {
+				err = lookupErr
+			}
+			return secret
+		})
+		return result, err
+	case map[string]interface{}:
+		for key, item := range value {
+			interpolated, err := interpolate(item, lookup)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = interpolated
+		}
+	case []interface{}:
+		for i, item := range value {
+			interpolated, err := interpolate(item, lookup)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = interpolated
+		}
+	}
+	return value, nil
+}
+
+// Run the configured command to decrypt the secrets file, returning its yaml contents.
+// Returns an empty map if no secrets file is configured.
+func decryptSecrets(runner *markup.CommandRunner, options map[string]interface{}) (map[string]interface{}, error) {
+	secrets := make(map[string]interface{})
+	file, _ := options["file"].(string)
+	if file == "" {
+		return secrets, nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(runner.Dir, file)
+	}
+	command, _ := options["command"].(string)
+	if command == "" {
+		command = DEFAULT_SECRETS_COMMAND
+	}
+
+	output, err := runner.Run(command, "", file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt secrets file %s: %w", file, err)
+	}
+
+	if err := yaml.Unmarshal([]byte(output), &secrets); err != nil {
+		return nil, fmt.Errorf("invalid yaml format in decrypted secrets file %s: %w", file, err)
+	}
+	return secrets, nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretsFromEnv(t *testing.T) {
+	rootDir := t.TempDir()
+	t.Setenv("NOTIFY_TOKEN", "abc123")
+	writeFile(rootDir, "config.yml", `
+notify_webhook: https://example.com/hook?token=${NOTIFY_TOKEN}
+title: costs ${NOTIFY_TOKEN}
+secrets:
+  keys: [notify_webhook]
+`)
+
+	config, err := Load(rootDir)
+	assertEqual(t, err, nil)
+	assertEqual(t, config.NotifyWebhook, "https://example.com/hook?token=abc123")
+
+	// keys that don't opt in aren't interpolated, and secrets don't reach the templates
+	context := config.AsContext()
+	assertEqual(t, context["title"], "costs ${NOTIFY_TOKEN}")
+	_, found := context["notify_webhook"]
+	assert(t, !found)
+	_, found = context["secrets"]
+	assert(t, !found)
+}
+
+func TestSecretsFile(t *testing.T) {
+	rootDir := t.TempDir()
+	t.Setenv("DEPLOY_USER", "jorge")
+	os.Mkdir(filepath.Join(rootDir, "secrets"), 0777)
+	writeFile(filepath.Join(rootDir, "secrets"), "deploy.yml", "DEPLOY_USER: ignored\nDEPLOY_KEY: s3cr3t\n")
+	// the path of the secrets file is relative to the project root
+	writeFile(rootDir, "config.yml", `
+deploy:
+  user: ${DEPLOY_USER}
+  keys: ["${DEPLOY_KEY}"]
+secrets:
+  keys: [deploy]
+  file: secrets/deploy.yml
+  command: cat
+`)
+
+	config, err := Load(rootDir)
+	assertEqual(t, err, nil)
+	deploy := config.overrides["deploy"].(map[string]interface{})
+	// the environment takes precedence over the file
+	assertEqual(t, deploy["user"], "jorge")
+	assertEqual(t, deploy["keys"].([]interface{})[0], "s3cr3t")
+
+	// the file isn't decrypted if all references are found in the environment
+	writeFile(rootDir, "config.yml", `
+deploy: ${DEPLOY_USER}
+secrets:
+  keys: [deploy]
+  file: secrets/missing.yml
+  command: cat
+`)
+	config, err = Load(rootDir)
+	assertEqual(t, err, nil)
+	assertEqual(t, config.overrides["deploy"], "jorge")
+
+	writeFile(rootDir, "config.yml", `
+deploy: ${DEPLOY_KEY}
+secrets:
+  keys: [deploy]
+  file: secrets/missing.yml
+  command: cat
+`)
+	_, err = Load(rootDir)
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "couldn't decrypt secrets file"))
+}
+
+func TestUndefinedSecret(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFile(rootDir, "config.yml", `
+notify_webhook: https://example.com/${JORGE_TEST_UNDEFINED}
+secrets:
+  keys: [notify_webhook]
+`)
+
+	_, err := Load(rootDir)
+	assert(t, err != nil)
+	assertEqual(t, err.Error(), "invalid config value for notify_webhook: undefined secret ${JORGE_TEST_UNDEFINED}")
+
+	writeFile(rootDir, "config.yml", `
+secrets:
+  keys: notify_webhook
+`)
+	_, err = Load(rootDir)
+	assert(t, err != nil)
+}
+
+func TestEscapedSecret(t *testing.T) {
+	rootDir := t.TempDir()
+	t.Setenv("NOTIFY_TOKEN", "abc123")
+	writeFile(rootDir, "config.yml", `
+notify_webhook: https://example.com/$${NOTIFY_TOKEN}/${NOTIFY_TOKEN}
+secrets:
+  keys: [notify_webhook]
+`)
+
+	config, err := Load(rootDir)
+	assertEqual(t, err, nil)
+	assertEqual(t, config.NotifyWebhook, "https://example.com/${NOTIFY_TOKEN}/abc123")
+}
+
+func writeFile(dir string, filename string, contents string) {
+	if err := os.WriteFile(filepath.Join(dir, filename), []byte(contents), 0666); err != nil {
+		panic(err)
+	}
+}
+
+func assert(t *testing.T, cond bool) {
+	t.Helper()
+	if !cond {
+		t.Fatalf("%v is false", cond)
+	}
+}
+
+func assertEqual(t *testing.T, a interface{}, b interface{}) {
+	t.Helper()
+	if a != b {
+		t.Fatalf("%v != %v", a, b)
+	}
+}
@@ -0,0 +1,304 @@
+package markup
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// A converter for a subset of AsciiMath (http://asciimath.org/) to MathML, covering the
+// usual symbols, fractions, sub and superscripts, roots, accents, text and grouping brackets.
+func AsciiMathToMathML(input string) string {
+	parser := asciiMathParser{tokens: tokenizeAsciiMath(input)}
+	var buf strings.Builder
+	buf.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow>`)
+	for _, node := range parser.parseAll() {
+		buf.WriteString(node.render())
+	}
+	buf.WriteString("</mrow></math>")
+	return buf.String()
+}
+
+type mathSymbolKind int
+
+const (
+	mathConst mathSymbolKind = iota
+	mathUnary
+	mathBinary
+	mathLeftBracket
+	mathRightBracket
+	mathUnderOver
+)
+
+type mathSymbol struct {
+	kind   mathSymbolKind
+	tag    string
+	output string
+}
+
+var asciiMathSymbols = map[string]mathSymbol{
+	// greek letters
+	"alpha": {mathConst, "mi", "α"}, "beta": {mathConst, "mi", "β"}, "gamma": {mathConst, "mi", "γ"},
+	"Gamma": {mathConst, "mi", "Γ"}, "delta": {mathConst, "mi", "δ"}, "Delta": {mathConst, "mi", "Δ"},
+	"epsilon": {mathConst, "mi", "ε"}, "zeta": {mathConst, "mi", "ζ"}, "eta": {mathConst, "mi", "η"},
+	"theta": {mathConst, "mi", "θ"}, "Theta": {mathConst, "mi", "Θ"}, "iota": {mathConst, "mi", "ι"},
+	"kappa": {mathConst, "mi", "κ"}, "lambda": {mathConst, "mi", "λ"}, "Lambda": {mathConst, "mi", "Λ"},
+	"mu": {mathConst, "mi", "μ"}, "nu": {mathConst, "mi", "ν"}, "xi": {mathConst, "mi", "ξ"},
+	"Xi": {mathConst, "mi", "Ξ"}, "pi": {mathConst, "mi", "π"}, "Pi": {mathConst, "mi", "Π"},
+	"rho": {mathConst, "mi", "ρ"}, "sigma": {mathConst, "mi", "σ"}, "Sigma": {mathConst, "mi", "Σ"},
+	"tau": {mathConst, "mi", "τ"}, "upsilon": {mathConst, "mi", "υ"}, "phi": {mathConst, "mi", "φ"},
+	"Phi": {mathConst, "mi", "Φ"}, "chi": {mathConst, "mi", "χ"}, "psi": {mathConst, "mi", "ψ"},
+	"Psi": {mathConst, "mi", "Ψ"}, "omega": {mathConst, "mi", "ω"}, "Omega": {mathConst, "mi", "Ω"},
+
+	// operators and relations
+	"+": {mathConst, "mo", "+"}, "-": {mathConst, "mo", "−"}, "*": {mathConst, "mo", "⋅"},
+	"**": {mathConst, "mo", "∗"}, "xx": {mathConst, "mo", "×"}, "-:": {mathConst, "mo", "÷"},
+	"//": {mathConst, "mo", "/"}, "+-": {mathConst, "mo", "±"}, "o+": {mathConst, "mo", "⊕"},
+	"ox": {mathConst, "mo", "⊗"}, "=": {mathConst, "mo", "="}, "!=": {mathConst, "mo", "≠"},
+	"<": {mathConst, "mo", "&lt;"}, ">": {mathConst, "mo", "&gt;"}, "<=": {mathConst, "mo", "≤"},
+	">=": {mathConst, "mo", "≥"}, "-=": {mathConst, "mo", "≡"}, "~~": {mathConst, "mo", "≈"},
+	"~=": {mathConst, "mo", "≅"}, "prop": {mathConst, "mo", "∝"}, "in": {mathConst, "mo", "∈"},
+	"!in": {mathConst, "mo", "∉"}, "sub": {mathConst, "mo", "⊂"}, "sup": {mathConst, "mo", "⊃"},
+	"sube": {mathConst, "mo", "⊆"}, "supe": {mathConst, "mo", "⊇"}, "cup": {mathConst, "mo", "∪"},
+	"cap": {mathConst, "mo", "∩"}, "and": {mathConst, "mtext", "and"}, "or": {mathConst, "mtext", "or"},
+	"not": {mathConst, "mo", "¬"}, "=>": {mathConst, "mo", "⇒"}, "<=>": {mathConst, "mo", "⇔"},
+	"->": {mathConst, "mo", "→"}, "|->": {mathConst, "mo", "↦"}, "AA": {mathConst, "mo", "∀"},
+	"EE": {mathConst, "mo", "∃"}, "del": {mathConst, "mo", "∂"}, "grad": {mathConst, "mo", "∇"},
+	"oo": {mathConst, "mn", "∞"}, "O/": {mathConst, "mo", "∅"}, "...": {mathConst, "mo", "…"},
+	"cdots": {mathConst, "mo", "⋯"}, ",": {mathConst, "mo", ","}, "|": {mathConst, "mo", "|"},
+	"int": {mathConst, "mo", "∫"}, "oint": {mathConst, "mo", "∮"},
+	"RR": {mathConst, "mi", "ℝ"}, "NN": {mathConst, "mi", "ℕ"}, "ZZ": {mathConst, "mi", "ℤ"},
+	"QQ": {mathConst, "mi", "ℚ"}, "CC": {mathConst, "mi", "ℂ"},
+
+	// functions
+	"sin": {mathConst, "mi", "sin"}, "cos": {mathConst, "mi", "cos"}, "tan": {mathConst, "mi", "tan"},
+	"log": {mathConst, "mi", "log"}, "ln": {mathConst, "mi", "ln"}, "exp": {mathConst, "mi", "exp"},
+	"min": {mathConst, "mi", "min"}, "max": {mathConst, "mi", "max"}, "det": {mathConst, "mi", "det"},
+
+	// big operators take their limits under and over
+	"sum": {mathUnderOver, "mo", "∑"}, "prod": {mathUnderOver, "mo", "∏"}, "lim": {mathUnderOver, "mo", "lim"},
+
+	// brackets
+	"(": {mathLeftBracket, "mo", "("}, ")": {mathRightBracket, "mo", ")"},
+	"[": {mathLeftBracket, "mo", "["}, "]": {mathRightBracket, "mo", "]"},
+	"{": {mathLeftBracket, "mo", "{"}, "}": {mathRightBracket, "mo", "}"},
+	"(:": {mathLeftBracket, "mo", "⟨"}, ":)": {mathRightBracket, "mo", "⟩"},
+
+	// functions of one or two arguments
+	"sqrt": {mathUnary, "msqrt", ""},
+	"hat":  {mathUnary, "mover", "^"}, "bar": {mathUnary, "mover", "¯"},
+	"vec": {mathUnary, "mover", "→"}, "dot": {mathUnary, "mover", "."},
+	"frac": {mathBinary, "mfrac", ""}, "root": {mathBinary, "mroot", ""},
+}
+
+const asciiMathMaxSymbolLength = 7
+
+type mathToken struct {
+	text   string
+	symbol *mathSymbol
+	quoted bool
+}
+
+func tokenizeAsciiMath(input string) []mathToken {
+	var tokens []mathToken
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		char := runes[i]
+		switch {
+		case unicode.IsSpace(char):
+			i++
+		case unicode.IsDigit(char):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || (runes[i] == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]))) {
+				i++
+			}
+			tokens = append(tokens, mathToken{text: string(runes[start:i])})
+		case char == '"' || strings.HasPrefix(string(runes[i:]), "text("):
+			// quoted and text(...) contents are taken verbatim
+			closing := '"'
+			if char != '"' {
+				i += len("text")
+				closing = ')'
+			}
+			end := i + 1
+			for end < len(runes) && runes[end] != closing {
+				end++
+			}
+			tokens = append(tokens, mathToken{text: string(runes[i+1 : min(end, len(runes))]), quoted: true})
+			i = end + 1
+		default:
+			// take the longest symbol starting at this position, otherwise a single character
+			length := 1
+			var symbol *mathSymbol
+			for l := min(asciiMathMaxSymbolLength, len(runes)-i); l > 0; l-- {
+				if s, ok := asciiMathSymbols[string(runes[i:i+l])]; ok {
+					length, symbol = l, &s
+					break
+				}
+			}
+			tokens = append(tokens, mathToken{text: string(runes[i : i+length]), symbol: symbol})
+			i += length
+		}
+	}
+	return tokens
+}
+
+type mathNode struct {
+	tag      string
+	text     string
+	children []*mathNode
+	// the brackets of a grouping, dropped when used as an argument, e.g. in sqrt(x) or (a+b)/2
+	brackets bool
+}
+
+func (node *mathNode) render() string {
+	if node.children == nil {
+		return "<" + node.tag + ">" + node.text + "</" + node.tag + ">"
+	}
+	var buf strings.Builder
+	buf.WriteString("<" + node.tag + ">")
+	for _, child := range node.children {
+		buf.WriteString(child.render())
+	}
+	buf.WriteString("</" + node.tag + ">")
+	return buf.String()
+}
+
+// Return the contents of a bracket group, or the node itself.
+func (node *mathNode) withoutBrackets() *mathNode {
+	if node.brackets && len(node.children) == 3 {
+		return node.children[1]
+	}
+	if node.brackets && len(node.children) > 3 {
+		return &mathNode{tag: "mrow", children: node.children[1 : len(node.children)-1]}
+	}
+	return node
+}
+
+type asciiMathParser struct {
+	tokens []mathToken
+	pos    int
+}
+
+func (p *asciiMathParser) peek() *mathToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *asciiMathParser) next() *mathToken {
+	token := p.peek()
+	if token != nil {
+		p.pos++
+	}
+	return token
+}
+
+// Parse the whole input. Unmatched closing brackets are output as operators, instead of ending the expression.
+func (p *asciiMathParser) parseAll() []*mathNode {
+	nodes := p.parseExpression()
+	for token := p.next(); token != nil; token = p.next() {
+		nodes = append(nodes, &mathNode{tag: "mo", text: token.symbol.output})
+		nodes = append(nodes, p.parseExpression()...)
+	}
+	return nodes
+}
+
+// Parse a sequence of expressions, until the end of the input or a closing bracket.
+func (p *asciiMathParser) parseExpression() []*mathNode {
+	var nodes []*mathNode
+	for {
+		token := p.peek()
+		if token == nil || (token.symbol != nil && token.symbol.kind == mathRightBracket) {
+			return nodes
+		}
+		node := p.parseIntermediate()
+		if token := p.peek(); token != nil && token.text == "/" && !token.quoted {
+			p.next()
+			denominator := p.parseIntermediate()
+			node = &mathNode{tag: "mfrac", children: []*mathNode{node.withoutBrackets(), denominator.withoutBrackets()}}
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// Parse a simple expression with optional subscript and superscript.
+func (p *asciiMathParser) parseIntermediate() *mathNode {
+	token := p.peek()
+	underOver := token != nil && token.symbol != nil && token.symbol.kind == mathUnderOver
+	node := p.parseSimple()
+
+	var sub, sup *mathNode
+	if token := p.peek(); token != nil && token.text == "_" && !token.quoted {
+		p.next()
+		sub = p.parseSimple().withoutBrackets()
+	}
+	if token := p.peek(); token != nil && token.text == "^" && !token.quoted {
+		p.next()
+		sup = p.parseSimple().withoutBrackets()
+	}
+
+	switch {
+	case sub != nil && sup != nil && underOver:
+		return &mathNode{tag: "munderover", children: []*mathNode{node, sub, sup}}
+	case sub != nil && sup != nil:
+		return &mathNode{tag: "msubsup", children: []*mathNode{node, sub, sup}}
+	case sub != nil && underOver:
+		return &mathNode{tag: "munder", children: []*mathNode{node, sub}}
+	case sub != nil:
+		return &mathNode{tag: "msub", children: []*mathNode{node, sub}}
+	case sup != nil && underOver:
+		return &mathNode{tag: "mover", children: []*mathNode{node, sup}}
+	case sup != nil:
+		return &mathNode{tag: "msup", children: []*mathNode{node, sup}}
+	}
+	return node
+}
+
+func (p *asciiMathParser) parseSimple() *mathNode {
+	token := p.next()
+	if token == nil {
+		return &mathNode{tag: "mrow", children: []*mathNode{}}
+	}
+	if token.quoted {
+		return &mathNode{tag: "mtext", text: html.EscapeString(token.text)}
+	}
+	if token.symbol == nil {
+		switch char := []rune(token.text)[0]; {
+		case unicode.IsDigit(char):
+			return &mathNode{tag: "mn", text: token.text}
+		case unicode.IsLetter(char):
+			return &mathNode{tag: "mi", text: html.EscapeString(token.text)}
+		}
+		return &mathNode{tag: "mo", text: html.EscapeString(token.text)}
+	}
+
+	symbol := token.symbol
+	switch symbol.kind {
+	case mathLeftBracket:
+		children := []*mathNode{{tag: "mo", text: symbol.output}}
+		children = append(children, p.parseExpression()...)
+		if closing := p.next(); closing != nil {
+			children = append(children, &mathNode{tag: "mo", text: closing.symbol.output})
+		}
+		return &mathNode{tag: "mrow", children: children, brackets: true}
+	case mathRightBracket:
+		return &mathNode{tag: "mo", text: symbol.output}
+	case mathUnary:
+		arg := p.parseSimple().withoutBrackets()
+		if symbol.tag == "mover" {
+			return &mathNode{tag: "mover", children: []*mathNode{arg, {tag: "mo", text: symbol.output}}}
+		}
+		return &mathNode{tag: symbol.tag, children: []*mathNode{arg}}
+	case mathBinary:
+		first := p.parseSimple().withoutBrackets()
+		second := p.parseSimple().withoutBrackets()
+		if symbol.tag == "mroot" {
+			// root(n)(x) is the n-th root of x
+			first, second = second, first
+		}
+		return &mathNode{tag: symbol.tag, children: []*mathNode{first, second}}
+	}
+	return &mathNode{tag: symbol.tag, text: symbol.output}
+}
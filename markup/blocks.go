@@ -0,0 +1,66 @@
+package markup
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/osteele/liquid"
+	"github.com/osteele/liquid/render"
+)
+
+// The template context key where the layout inheritance state is stored during rendering.
+const INHERITANCE_KEY = "__inheritance"
+
+// Keeps track of the {% extends %} and {% block %} tags found while rendering
+// a template and its chain of parent layouts. Since templates are rendered from the innermost
+// outwards, a block defined by a template overrides the same block in all of its parent layouts.
+type Inheritance struct {
+	// The name of the layout extended by the template currently being rendered, if any.
+	// It's initialized from the `layout` front matter key and can be set by the {% extends %} tag.
+	Parent string
+	blocks map[string]string
+}
+
+func NewInheritance() *Inheritance {
+	return &Inheritance{blocks: make(map[string]string)}
+}
+
+func loadInheritanceTags(e *liquid.Engine) {
+	// {% extends "base" %} is equivalent to `layout: base` in the template front matter
+	e.RegisterTag("extends", func(rc render.Context) (string, error) {
+		arg, err := rc.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		if inheritance, ok := rc.Get(INHERITANCE_KEY).(*Inheritance); ok {
+			name := strings.Trim(arg, " \"'")
+			inheritance.Parent = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		return "", nil
+	})
+
+	e.RegisterBlock("block", func(rc render.Context) (string, error) {
+		inheritance, ok := rc.Get(INHERITANCE_KEY).(*Inheritance)
+		if !ok {
+			// not rendering as part of a layout chain, just output the block contents
+			return rc.InnerString()
+		}
+
+		name := strings.TrimSpace(rc.TagArgs())
+		content, overridden := inheritance.blocks[name]
+		if !overridden {
+			var err error
+			content, err = rc.InnerString()
+			if err != nil {
+				return "", err
+			}
+			inheritance.blocks[name] = content
+		}
+
+		// if this template extends a layout, the block will be output by the parent instead
+		if inheritance.Parent != "" {
+			return "", nil
+		}
+		return content, nil
+	})
+}
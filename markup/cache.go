@@ -0,0 +1,41 @@
+package markup
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Return the directory where slow to compute outputs, like rendered math and remote includes, are cached
+// across builds. It can be set with the JORGE_CACHE_DIR environment variable, e.g. to keep it in CI runners,
+// and defaults to a jorge directory in the user cache dir.
+func CacheDir() (string, error) {
+	if dir := os.Getenv("JORGE_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "jorge"), nil
+}
+
+// Write the given contents to a file in the cache dir, creating its directory and replacing it atomically, so other
+// goroutines or processes reading it never find it partially written.
+func WriteCacheFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
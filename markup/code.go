@@ -0,0 +1,123 @@
+package markup
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/osteele/liquid"
+	"github.com/osteele/liquid/render"
+)
+
+// The context key where the RenderOptions.OnFileRead hook is passed to the tags that read files.
+const FILE_READ_KEY = "__on_file_read"
+
+// Register a tag to embed the contents of a project file in a code block, e.g.:
+//
+//	{% code "snippets/example.go" lang="go" lines="10-30" %}
+//
+// The path is relative to the project root. The language defaults to the file extension and
+// the lines range, which can be open ended like "10-", to the whole file.
+// The block is emitted in the syntax of the template being rendered, so it's highlighted
+// along with the rest of the org or markdown code blocks.
+func loadCodeTag(e *liquid.Engine, rootDir string) {
+	e.RegisterTag("code", func(rc render.Context) (string, error) {
+		argsline, err := rc.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		args := splitAttributes(argsline)
+		if len(args) == 0 {
+			return "", fmt.Errorf("code tag expects a file path")
+		}
+
+		path := strings.Trim(args[0], `"'`)
+		options := make(map[string]string)
+		for _, arg := range args[1:] {
+			key, value, _ := strings.Cut(arg, "=")
+			options[key] = strings.Trim(value, `"'`)
+		}
+
+		filename := filepath.Join(rootDir, path)
+		if onRead, ok := rc.Get(FILE_READ_KEY).(func(string)); ok {
+			onRead(filename)
+		}
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		code, err := selectLines(string(content), options["lines"])
+		if err != nil {
+			return "", fmt.Errorf("invalid lines in code tag: %w", err)
+		}
+
+		lang := options["lang"]
+		if lang == "" {
+			lang = strings.TrimPrefix(filepath.Ext(path), ".")
+		}
+		return codeBlock(filepath.Ext(rc.SourceFile()), lang, code), nil
+	})
+}
+
+// Return the given line range of the content, e.g. "10-30", "10-" or "10", removing
+// the indentation common to all of them.
+func selectLines(content string, lines string) (string, error) {
+	all := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	start, end := 1, len(all)
+	if lines != "" {
+		from, to, isRange := strings.Cut(lines, "-")
+		var err error
+		if start, err = strconv.Atoi(strings.TrimSpace(from)); err != nil {
+			return "", err
+		}
+		end = start
+		if isRange {
+			end = len(all)
+			if to = strings.TrimSpace(to); to != "" {
+				if end, err = strconv.Atoi(to); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	if start < 1 || start > end || end > len(all) {
+		return "", fmt.Errorf("lines %d-%d out of range (the file has %d lines)", start, end, len(all))
+	}
+	selected := all[start-1 : end]
+
+	indent := -1
+	for _, line := range selected {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == -1 || lineIndent < indent {
+			indent = lineIndent
+		}
+	}
+	for i, line := range selected {
+		if len(line) >= indent && indent > 0 {
+			selected[i] = line[indent:]
+		}
+	}
+	return strings.Join(selected, "\n"), nil
+}
+
+// Return the code block markup for a template with the given extension.
+func codeBlock(ext string, lang string, code string) string {
+	switch ext {
+	case ".md":
+		// the fence should be longer than any backtick sequence in the code
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + lang + "\n" + code + "\n" + fence
+	case ".org":
+		return "#+begin_src " + lang + "\n" + code + "\n#+end_src"
+	}
+	return `<pre><code class="language-` + html.EscapeString(lang) + `">` + html.EscapeString(code) + "</code></pre>"
+}
@@ -0,0 +1,158 @@
+package markup
+
+import (
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gm_highlight "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// A goldmark extension that parses the attributes in the info string of fenced code blocks,
+// e.g. ```go {linenos=true, hl_lines=[3,5-7]} or ```go title="main.go", and sets them on the code
+// block node so they are honored by the syntax highlighter. Goldmark's own attribute parsing is stricter,
+// requiring braces and line ranges to be quoted.
+type codeBlockAttributes struct{}
+
+func (e *codeBlockAttributes) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 100)))
+}
+
+func (e *codeBlockAttributes) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		block, ok := node.(*ast.FencedCodeBlock)
+		if !ok || !entering || block.Info == nil {
+			return ast.WalkContinue, nil
+		}
+
+		// the attributes follow the language, optionally surrounded by braces
+		info := string(block.Info.Segment.Value(source))
+		_, attrs, found := strings.Cut(info, " ")
+		if !found {
+			return ast.WalkContinue, nil
+		}
+		attrs = strings.TrimSpace(attrs)
+		attrs = strings.TrimSuffix(strings.TrimPrefix(attrs, "{"), "}")
+		for key, value := range parseCodeBlockAttributes(attrs) {
+			block.SetAttributeString(key, value)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// Parse a comma or space separated list of key=value pairs, as found in a code block info string.
+// Keys without value are set to true.
+func parseCodeBlockAttributes(attrs string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, pair := range splitAttributes(attrs) {
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found {
+			result[key] = true
+			continue
+		}
+		result[key] = parseAttributeValue(strings.TrimSpace(value))
+	}
+	return result
+}
+
+// Split the attributes string by commas and spaces, except when inside brackets or quotes.
+func splitAttributes(attrs string) []string {
+	var parts []string
+	var current strings.Builder
+	depth := 0
+	var quote rune
+	for _, char := range attrs {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '[':
+			depth++
+		case char == ']':
+			depth--
+		case (char == ',' || char == ' ') && depth == 0:
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(char)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// Convert an attribute value to the types expected by the goldmark highlighting extension:
+// numbers as float64, booleans, arrays as []interface{} and anything else, like line ranges, as []byte.
+func parseAttributeValue(value string) interface{} {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		items := []interface{}{}
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, parseAttributeValue(item))
+			}
+		}
+		return items
+	}
+
+	value = strings.Trim(value, `"'`)
+	if boolean, err := strconv.ParseBool(value); err == nil {
+		return boolean
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number
+	}
+	return []byte(value)
+}
+
+// Wrap the rendered code blocks that have a `title` attribute in a figure, with the title as caption.
+// When the code is not highlighted, the wrapper is also responsible for the <pre> element.
+func codeBlockWrapper(w util.BufWriter, ctx gm_highlight.CodeBlockContext, entering bool) {
+	var title string
+	if attrs := ctx.Attributes(); attrs != nil {
+		if value, ok := attrs.GetString("title"); ok {
+			if bytes, ok := value.([]byte); ok {
+				title = string(bytes)
+			}
+		}
+	}
+
+	if entering {
+		if title != "" {
+			w.WriteString(codeTitleOpening(title))
+		}
+		if !ctx.Highlighted() {
+			w.WriteString("<pre><code")
+			if lang, ok := ctx.Language(); ok {
+				w.WriteString(` class="language-` + html.EscapeString(string(lang)) + `"`)
+			}
+			w.WriteString(">")
+		}
+	} else {
+		if !ctx.Highlighted() {
+			w.WriteString("</code></pre>\n")
+		}
+		if title != "" {
+			w.WriteString(CODE_TITLE_CLOSING)
+		}
+	}
+}
+
+const CODE_TITLE_CLOSING = "</figure>\n"
+
+func codeTitleOpening(title string) string {
+	return `<figure class="code-block">` + "\n" + `<figcaption>` + html.EscapeString(title) + "</figcaption>\n"
+}
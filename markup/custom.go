@@ -0,0 +1,115 @@
+package markup
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/osteele/liquid"
+	"github.com/osteele/liquid/render"
+)
+
+// Register the user-defined filters and tags, as found in the site config.
+// Each one is either a liquid template string, or a map with a `command` key
+// to be run as an external command, eg:
+//
+//	liquid_filters:
+//	  shout: "{{ input | upcase }}!"
+//	  rot13:
+//	    command: tr a-z n-za-m
+//
+// Filter templates receive the filtered value as `input` and the optional filter argument as `arg`.
+// Filter commands receive the value through stdin, and the argument, if any, as an extra command argument.
+// Tag templates are rendered with the current bindings, plus the tag arguments as `args`.
+// Tag commands receive the tag arguments as extra command arguments. Commands are run with the given runner.
+func LoadCustomHelpers(e *Engine, filters map[string]interface{}, tags map[string]interface{}, runner *CommandRunner) error {
+	// templates are parsed after registering all helpers, so they can use each other
+	templates := make(map[string]*liquid.Template)
+	sources := make(map[string]string)
+
+	for name, definition := range filters {
+		source, command, err := parseHelperDefinition("filter", name, definition)
+		if err != nil {
+			return err
+		}
+		if command != "" {
+			e.RegisterFilter(name, commandFilter(runner, command))
+		} else {
+			sources["filter "+name] = source
+			e.RegisterFilter(name, templateFilter(templates, "filter "+name))
+		}
+	}
+
+	for name, definition := range tags {
+		source, command, err := parseHelperDefinition("tag", name, definition)
+		if err != nil {
+			return err
+		}
+		if command != "" {
+			e.RegisterTag(name, commandTag(runner, command))
+		} else {
+			sources["tag "+name] = source
+			e.RegisterTag(name, templateTag(templates, "tag "+name))
+		}
+	}
+
+	for key, source := range sources {
+		templ, err := e.ParseString(source)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		templates[key] = templ
+	}
+	return nil
+}
+
+// Return either the liquid template source or the command of the given filter or tag definition.
+func parseHelperDefinition(kind string, name string, definition interface{}) (string, string, error) {
+	switch value := definition.(type) {
+	case string:
+		return value, "", nil
+	case map[string]interface{}:
+		if command, ok := value["command"].(string); ok && command != "" {
+			return "", command, nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid %s %s: expected a template string or a command", kind, name)
+}
+
+func templateFilter(templates map[string]*liquid.Template, key string) func(interface{}, func(interface{}) interface{}) (string, error) {
+	return func(input interface{}, arg func(interface{}) interface{}) (string, error) {
+		return templates[key].RenderString(map[string]interface{}{"input": input, "arg": arg(nil)})
+	}
+}
+
+func commandFilter(runner *CommandRunner, command string) func(interface{}, func(interface{}) interface{}) (string, error) {
+	return func(input interface{}, arg func(interface{}) interface{}) (string, error) {
+		var extraArgs []string
+		if value := arg(nil); value != nil {
+			extraArgs = append(extraArgs, fmt.Sprint(value))
+		}
+		return runner.Run(command, fmt.Sprint(input), extraArgs...)
+	}
+}
+
+func templateTag(templates map[string]*liquid.Template, key string) func(render.Context) (string, error) {
+	return func(rc render.Context) (string, error) {
+		args, err := rc.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		bindings := maps.Clone(rc.Bindings())
+		bindings["args"] = strings.TrimSpace(args)
+		return templates[key].RenderString(bindings)
+	}
+}
+
+func commandTag(runner *CommandRunner, command string) func(render.Context) (string, error) {
+	return func(rc render.Context) (string, error) {
+		args, err := rc.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		return runner.Run(command, "", strings.Fields(args)...)
+	}
+}
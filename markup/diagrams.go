@@ -0,0 +1,100 @@
+package markup
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Code blocks in these languages are treated as diagram sources instead of being highlighted.
+var DIAGRAM_LANGS = []string{"mermaid", "graphviz", "dot", "plantuml"}
+
+func isDiagram(lang string) bool {
+	return slices.Contains(DIAGRAM_LANGS, strings.ToLower(lang))
+}
+
+// Render the source of a diagram code block.
+// If there's a command configured for the diagram language, the source is piped through it
+// and its output (expected to be SVG) is embedded in the document.
+// Otherwise the source is wrapped in a <pre> element to be rendered client-side, e.g. with mermaid.js.
+func renderDiagram(source string, lang string, commands map[string]string, runner *CommandRunner) string {
+	lang = strings.ToLower(lang)
+	source = strings.TrimRight(source, "\n")
+	if command, ok := commands[lang]; ok {
+		svg, err := runner.Run(command, source)
+		if err == nil {
+			return fmt.Sprintf("<div class=\"diagram %s\">\n%s\n</div>", lang, svg)
+		}
+		// don't abort the build, fallback to client-side rendering
+		fmt.Printf("error rendering %s diagram: %s\n", lang, err)
+	}
+	return fmt.Sprintf("<pre class=\"diagram %s\">\n%s\n</pre>", lang, html.EscapeString(source))
+}
+
+// A goldmark extension that replaces fenced code blocks of diagram languages
+// with the output of renderDiagram.
+type diagramExtension struct {
+	commands map[string]string
+	runner   *CommandRunner
+}
+
+var kindDiagram = ast.NewNodeKind("Diagram")
+
+type diagramNode struct {
+	ast.BaseBlock
+	lang   string
+	source string
+}
+
+func (n *diagramNode) Kind() ast.NodeKind {
+	return kindDiagram
+}
+
+func (n *diagramNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Lang": n.lang}, nil)
+}
+
+func (e *diagramExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 100)))
+}
+
+func (e *diagramExtension) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := node.(*ast.FencedCodeBlock); ok && entering && isDiagram(string(block.Language(source))) {
+			blocks = append(blocks, block)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		var buf bytes.Buffer
+		for i := 0; i < block.Lines().Len(); i++ {
+			line := block.Lines().At(i)
+			buf.Write(line.Value(source))
+		}
+		diagram := &diagramNode{lang: string(block.Language(source)), source: buf.String()}
+		block.Parent().ReplaceChild(block.Parent(), block, diagram)
+	}
+}
+
+func (e *diagramExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindDiagram, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			n := node.(*diagramNode)
+			w.WriteString(renderDiagram(n.source, n.lang, e.commands, e.runner) + "\n")
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
@@ -0,0 +1,18 @@
+package markup
+
+import "strings"
+
+// Languages written from right to left, by their ISO 639-1 code.
+var RTL_LANGUAGES = []string{"ar", "dv", "fa", "he", "iw", "ks", "ku", "ps", "sd", "ug", "ur", "yi"}
+
+// Return "rtl" if the given language, e.g. `ar` or `he-IL`, is written from right to left, "ltr" otherwise.
+func TextDirection(lang string) string {
+	primary, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	primary, _, _ = strings.Cut(primary, "_")
+	for _, rtl := range RTL_LANGUAGES {
+		if primary == rtl {
+			return "rtl"
+		}
+	}
+	return "ltr"
+}
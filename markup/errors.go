@@ -0,0 +1,99 @@
+package markup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/osteele/liquid"
+)
+
+// Amount of source lines shown before and after the line where a template error occurred.
+const ERROR_CONTEXT_LINES = 2
+
+// An error found while parsing or rendering a template, with the location where it happened.
+// When the line is known, the error message includes an excerpt of the surrounding source.
+type TemplateError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	var sb strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "%s:%d: %s", e.Path, e.Line, e.message())
+		sb.WriteString(sourceExcerpt(e.Path, e.Line))
+	} else {
+		fmt.Fprintf(&sb, "%s: %s", e.Path, e.message())
+	}
+	return sb.String()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Return the message of the wrapped error, without the location details already included in the TemplateError.
+func (e *TemplateError) message() string {
+	var sourceErr liquid.SourceError
+	if !errors.As(e.Err, &sourceErr) {
+		return e.Err.Error()
+	}
+	if sourceErr.Cause() != nil {
+		return sourceErr.Cause().Error()
+	}
+	// liquid errors are formatted as "Liquid error (line N): message in path"
+	message := sourceErr.Error()
+	if _, after, found := strings.Cut(message, ": "); found && strings.HasPrefix(message, "Liquid error") {
+		message = after
+	}
+	return strings.TrimSuffix(message, " in "+sourceErr.Path())
+}
+
+// Wrap the given error in a TemplateError. If it's a liquid error, its location is used (which may
+// be an included file), otherwise it's attributed to the template at `path`, without line number.
+func wrapTemplateError(err error, path string) error {
+	if err == nil {
+		return nil
+	}
+	var templErr *TemplateError
+	if errors.As(err, &templErr) {
+		return err
+	}
+
+	var sourceErr liquid.SourceError
+	if errors.As(err, &sourceErr) {
+		if sourceErr.Path() != "" {
+			path = sourceErr.Path()
+		}
+		return &TemplateError{Path: path, Line: sourceErr.LineNumber(), Err: err}
+	}
+	return &TemplateError{Path: path, Err: err}
+}
+
+// Return a few numbered lines from the file at `path` around `line`, marking that line.
+// Returns an empty string if the file can't be read.
+func sourceExcerpt(path string, line int) string {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(source), "\n")
+	if line > len(lines) {
+		return ""
+	}
+
+	start := max(line-ERROR_CONTEXT_LINES, 1)
+	end := min(line+ERROR_CONTEXT_LINES, len(lines))
+	var sb strings.Builder
+	for i := start; i <= end; i++ {
+		marker := "  "
+		if i == line {
+			marker = "> "
+		}
+		fmt.Fprintf(&sb, "\n%s%4d | %s", marker, i, lines[i-1])
+	}
+	return sb.String()
+}
@@ -0,0 +1,98 @@
+package markup
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"regexp"
+	"strings"
+)
+
+// The filter appended to liquid objects of auto-escaped templates, by source extension.
+var AUTO_ESCAPE_FILTERS = map[string]string{
+	".xml":  "xml_escape",
+	".json": "json_escape",
+}
+
+// Objects already ending in one of these filters are not auto-escaped.
+// `raw` can be used to output a value as is.
+var ESCAPING_FILTERS = []string{"xml_escape", "json_escape", "escape", "escape_once", "cdata", "jsonify", "json", "raw"}
+
+var liquidObjectPattern = regexp.MustCompile(`(?s)\{\{(-?)(.*?)(-?)\}\}`)
+var rawBlockPattern = regexp.MustCompile(`(?s)\{%-?\s*raw\s*-?%\}.*?\{%-?\s*endraw\s*-?%\}`)
+var lastFilterPattern = regexp.MustCompile(`\|\s*(\w+)[^|]*$`)
+
+func xmlEscapeFilter(s string) (string, error) {
+	var buf bytes.Buffer
+	err := xml.EscapeText(&buf, []byte(s))
+	return buf.String(), err
+}
+
+// Escape the string so it can be placed inside a json string literal.
+func jsonEscapeFilter(s string) (string, error) {
+	encoded, err := jsonify(s, false)
+	if err != nil {
+		return "", err
+	}
+	return encoded[1 : len(encoded)-1], nil
+}
+
+// Encode the value as json, indented if `pretty` is passed as true.
+func jsonifyFilter(value interface{}, pretty func(bool) bool) (string, error) {
+	return jsonify(value, pretty(false))
+}
+
+func jsonify(value interface{}, pretty bool) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Wrap the string in a CDATA section, splitting any `]]>` it contains so it doesn't close the section early.
+func cdataFilter(s string) string {
+	return "<![CDATA[" + strings.ReplaceAll(s, "]]>", "]]]]><![CDATA[>") + "]]>"
+}
+
+// Append the escaping filter for the given extension to every liquid object in the content,
+// unless it already ends with an escaping filter. Objects inside raw blocks are left untouched.
+// Returns the content unchanged if there's no escaping filter for the extension.
+func autoEscape(content []byte, ext string) []byte {
+	escapeFilter, found := AUTO_ESCAPE_FILTERS[ext]
+	if !found {
+		return content
+	}
+
+	escapeObjects := func(src []byte) []byte {
+		return liquidObjectPattern.ReplaceAllFunc(src, func(object []byte) []byte {
+			groups := liquidObjectPattern.FindSubmatch(object)
+			expression := strings.TrimSpace(string(groups[2]))
+			if expression == "" {
+				return object
+			}
+			if last := lastFilterPattern.FindStringSubmatch(expression); last != nil {
+				for _, filter := range ESCAPING_FILTERS {
+					if last[1] == filter {
+						return object
+					}
+				}
+			}
+			return []byte("{{" + string(groups[1]) + " " + expression + " | " + escapeFilter + " " + string(groups[3]) + "}}")
+		})
+	}
+
+	var result []byte
+	start := 0
+	for _, loc := range rawBlockPattern.FindAllIndex(content, -1) {
+		result = append(result, escapeObjects(content[start:loc[0]])...)
+		result = append(result, content[loc[0]:loc[1]]...)
+		start = loc[1]
+	}
+	return append(result, escapeObjects(content[start:])...)
+}
@@ -0,0 +1,120 @@
+package markup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long external commands can run before being killed, unless configured otherwise.
+const DEFAULT_COMMAND_TIMEOUT = 30 * time.Second
+
+// The environment variables passed to external commands, besides the configured ones. The rest of
+// the environment, e.g. deploy tokens, isn't visible to them.
+var DEFAULT_COMMAND_ENV = []string{"PATH", "HOME", "USER", "LANG", "LC_ALL", "TMPDIR", "TEMP", "TMP", "SYSTEMROOT"}
+
+// Runs the external commands of the site, like diagram and math renderers, custom filters and tags
+// and the secrets decryption command. Commands are killed after a timeout or when the build is
+// canceled, run in a fixed directory and only see the allowed environment variables, so a misbehaving
+// command can't hang the build or read credentials from the environment.
+// A nil runner uses the defaults.
+type CommandRunner struct {
+	Timeout time.Duration
+	// the names of the environment variables passed to the commands, in addition to DEFAULT_COMMAND_ENV
+	Env []string
+	// the working directory of the commands, the project root
+	Dir string
+
+	mutex sync.Mutex
+	ctx   context.Context
+}
+
+// Set the context of the build in progress, whose cancellation kills the running commands.
+func (runner *CommandRunner) SetContext(ctx context.Context) {
+	runner.mutex.Lock()
+	runner.ctx = ctx
+	runner.mutex.Unlock()
+}
+
+func (runner *CommandRunner) context() context.Context {
+	if runner == nil {
+		return context.Background()
+	}
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	if runner.ctx == nil {
+		return context.Background()
+	}
+	return runner.ctx
+}
+
+// Run the given command line, plus any extra arguments, with the given standard input, returning its output.
+// The standard error of the command is printed, or included in the error if it fails, prefixed with its name.
+func (runner *CommandRunner) Run(command string, stdin string, extraArgs ...string) (string, error) {
+	args := append(strings.Fields(command), extraArgs...)
+	if len(args) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+	timeout := DEFAULT_COMMAND_TIMEOUT
+	var env []string
+	var dir string
+	if runner != nil {
+		if runner.Timeout > 0 {
+			timeout = runner.Timeout
+		}
+		env, dir = runner.Env, runner.Dir
+	}
+
+	ctx, cancel := context.WithTimeout(runner.context(), timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = commandEnv(env)
+	cmd.Dir = dir
+	// don't wait for subprocesses holding the output pipes after the command is killed
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	output := prefixLines(args[0], stderr.String())
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("%s timed out after %s%s", args[0], timeout, output)
+	} else if err != nil {
+		return "", fmt.Errorf("%s: %w%s", args[0], err, output)
+	}
+	if output != "" {
+		fmt.Println(strings.TrimPrefix(output, "\n"))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Return the variables of the environment with the default or the given names.
+func commandEnv(names []string) []string {
+	env := []string{}
+	for _, name := range slices.Concat(DEFAULT_COMMAND_ENV, names) {
+		if value, found := os.LookupEnv(name); found {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// Return the lines of the given output prefixed with the command name, each on a new line.
+func prefixLines(name string, output string) string {
+	var result strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line != "" {
+			result.WriteString("\n" + name + ": " + line)
+		}
+	}
+	return result.String()
+}
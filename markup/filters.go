@@ -3,16 +3,21 @@ package markup
 import (
 	"bytes"
 	"fmt"
+	"maps"
+	"math"
 	"net/url"
+	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
-	"encoding/xml"
 	"time"
 
 	"github.com/elliotchance/orderedmap/v2"
+	"github.com/facundoolano/go-org/org"
 	"github.com/osteele/liquid"
 	"github.com/osteele/liquid/evaluator"
 	"github.com/osteele/liquid/expressions"
@@ -32,6 +37,23 @@ func loadJekyllFilters(e *liquid.Engine, siteUrl string, includesDir string) {
 	e.RegisterFilter("keys", keysFilter)
 	e.RegisterFilter("where", whereFilter)
 	e.RegisterFilter("where_exp", whereExpFilter)
+	e.RegisterFilter("find", findFilter)
+	e.RegisterFilter("find_exp", findExpFilter)
+
+	e.RegisterFilter("number_of_words", func(s string) int {
+		// unlike jekyll, CJK characters are always counted as words
+		return CountWords(s)
+	})
+
+	e.RegisterFilter("truncate_words", func(s string, n int) string {
+		return TruncateWords(s, n)
+	})
+
+	e.RegisterFilter("asciimath_to_mathml", AsciiMathToMathML)
+	e.RegisterFilter("si_prefix", siPrefixFilter)
+	e.RegisterFilter("percent", func(n float64, decimals func(int) int) string {
+		return strconv.FormatFloat(n*100, 'f', decimals(0), 64) + "%"
+	})
 
 	e.RegisterFilter("normalize_whitespace", func(s string) string {
 		wsPattern := regexp.MustCompile(`(?s:[\s\n]+)`)
@@ -45,24 +67,24 @@ func loadJekyllFilters(e *liquid.Engine, siteUrl string, includesDir string) {
 		return buf.String(), err
 	})
 
-	e.RegisterFilter("xml_escape", func(s string) (string, error) {
-		// using goldmark here instead of balckfriday, to avoid an extra dependency
-		var buf bytes.Buffer
-		err := xml.EscapeText(&buf, []byte(s))
-		return buf.String(), err
+	e.RegisterFilter("orgify", func(s string) (string, error) {
+		doc := org.New().Parse(strings.NewReader(s), "")
+		htmlWriter := org.NewHTMLWriter()
+		htmlWriter.TopLevelHLevel = 1
+		return doc.Write(htmlWriter)
 	})
 
-	e.RegisterFilter("absolute_url", func(path string) (string, error) {
-		parsed, err := url.Parse(path)
-		if err != nil {
-			return "", err
-		}
-		if parsed.IsAbs() {
-			return path, nil
-		}
-		return url.JoinPath(siteUrl, path)
+	e.RegisterFilter("xml_escape", xmlEscapeFilter)
+	e.RegisterFilter("json_escape", jsonEscapeFilter)
+	e.RegisterFilter("jsonify", jsonifyFilter)
+	e.RegisterFilter("cdata", cdataFilter)
+	e.RegisterFilter("raw", func(value interface{}) interface{} {
+		// no-op, used to skip escaping in auto_escape templates
+		return value
 	})
 
+	loadUrlFilters(e, siteUrl, "")
+
 	e.RegisterFilter("date_to_rfc822", func(date time.Time) string {
 		return date.Format(time.RFC822)
 		// Out: Mon, 07 Nov 2008 13:07:54 -0800
@@ -81,7 +103,20 @@ func loadJekyllFilters(e *liquid.Engine, siteUrl string, includesDir string) {
 	})
 
 	e.RegisterTag("include", func(rc render.Context) (string, error) {
-		return includeFromDir(includesDir, rc)
+		return includeFromDir(e, includesDir, rc, nil)
+	})
+	// the block form of include, see expandIncludeBlocks
+	e.RegisterBlock(INCLUDE_BLOCK_TAG, func(rc render.Context) (string, error) {
+		content, err := rc.InnerString()
+		if err != nil {
+			return "", err
+		}
+		return includeFromDir(e, includesDir, rc, &content)
+	})
+
+	cache := &includeCache{outputs: make(map[string]string)}
+	e.RegisterTag("include_cached", func(rc render.Context) (string, error) {
+		return cache.include(includesDir, rc)
 	})
 }
 
@@ -210,19 +245,178 @@ func whereFilter(array []map[string]interface{}, key string, value interface{})
 	return result
 }
 
-func includeFromDir(dir string, rc render.Context) (string, error) {
-	argsline, err := rc.ExpandTagArg()
+// Register the absolute_url and relative_url filters, which prefix paths with the site base url,
+// to support sites hosted under a subpath, e.g. /myrepo for https://user.github.io/myrepo/.
+// absolute_url also prefixes the site url.
+func loadUrlFilters(e *liquid.Engine, siteUrl string, baseUrl string) {
+	e.RegisterFilter("relative_url", func(path string) (string, error) {
+		return RelativeUrl(baseUrl, path)
+	})
+
+	e.RegisterFilter("absolute_url", func(path string) (string, error) {
+		parsed, err := url.Parse(path)
+		if err != nil {
+			return "", err
+		}
+		if parsed.IsAbs() {
+			return path, nil
+		}
+		return url.JoinPath(siteUrl, baseUrl, path)
+	})
+}
+
+// Set the base url used by the url filters of the engine. See loadUrlFilters.
+func SetBaseUrl(e *Engine, siteUrl string, baseUrl string) {
+	loadUrlFilters(e, siteUrl, baseUrl)
+}
+
+// Prefix the given site path with the base url. Absolute urls are returned unchanged.
+func RelativeUrl(baseUrl string, path string) (string, error) {
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	if parsed.IsAbs() {
+		return path, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return strings.TrimSuffix(baseUrl, "/") + path, nil
+}
+
+// Return the first item of the array with the given key value, or nil if there's none.
+func findFilter(array []map[string]interface{}, key string, value interface{}) interface{} {
+	if result := whereFilter(array, key, value); len(result) > 0 {
+		return result[0]
+	}
+	return nil
+}
+
+// Return the first item of the array for which the expression is truthy, or nil if there's none.
+func findExpFilter(array []interface{}, name string, expr expressions.Closure) (interface{}, error) {
+	for _, item := range array {
+		value, err := expr.Bind(name, item).Evaluate()
+		if err != nil {
+			return nil, err
+		}
+		if value != nil && value != false {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
+// Render the given file from the includes dir, passing the key=value tag parameters as `include.<key>`.
+// When used as a block, the given content is passed as `include.content`.
+func includeFromDir(e *liquid.Engine, dir string, rc render.Context, content *string) (string, error) {
+	name, params, err := ParseTagArgs(rc)
 	if err != nil {
 		return "", err
+	} else if name == "" {
+		return "", fmt.Errorf("include expects a file name")
+	}
+	if content != nil {
+		params["content"] = *content
 	}
-	args := strings.Split(argsline, " ")
+
+	filename := filepath.Join(dir, name)
+	source, err := os.ReadFile(filename)
 	if err != nil {
 		return "", err
 	}
-	if len(args) != 1 {
-		return "", fmt.Errorf("parse error")
+	// includes are parsed here instead of with rc.RenderFile, so they can use include blocks too
+	templ, err := e.ParseTemplateLocation(expandIncludeBlocks(source), filename, 1)
+	if err != nil {
+		return "", err
 	}
+	bindings := maps.Clone(rc.Bindings())
+	bindings["include"] = params
+	return templ.RenderString(bindings)
+}
+
+// Rendered include outputs, kept for the lifetime of the template engine, i.e. for a single build.
+type includeCache struct {
+	mutex   sync.Mutex
+	outputs map[string]string
+}
 
+// Render an include file once per distinct set of parameters, reusing the output on subsequent calls.
+// Parameters are passed as key=value tag arguments and are available as `include.<key>` in the file.
+// The output should only depend on the parameters, not on the page where it's included.
+func (cache *includeCache) include(dir string, rc render.Context) (string, error) {
+	argsline, err := rc.ExpandTagArg()
+	if err != nil {
+		return "", err
+	}
+	args := splitAttributes(argsline)
+	if len(args) == 0 {
+		return "", fmt.Errorf("include_cached expects a file name")
+	}
 	filename := filepath.Join(dir, args[0])
-	return rc.RenderFile(filename, map[string]interface{}{})
+	params, err := evaluateTagParams(rc, args[1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid arguments to include_cached %s: %w", args[0], err)
+	}
+
+	// changes to the file during serve invalidate the cache
+	info, err := os.Stat(filename)
+	if err != nil {
+		return "", err
+	}
+	encodedParams, err := jsonify(params, false)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("%s %d %s", filename, info.ModTime().UnixNano(), encodedParams)
+
+	cache.mutex.Lock()
+	output, found := cache.outputs[key]
+	cache.mutex.Unlock()
+	if found {
+		return output, nil
+	}
+
+	// shortcodes output html directly, since placeholders are specific to the page being rendered
+	output, err = rc.RenderFile(filename, map[string]interface{}{"include": params, SHORTCODES_KEY: nil})
+	if err != nil {
+		return "", err
+	}
+	cache.mutex.Lock()
+	cache.outputs[key] = output
+	cache.mutex.Unlock()
+	return output, nil
+}
+
+var siPrefixes = []string{"q", "r", "y", "z", "a", "f", "p", "n", "µ", "m", "", "k", "M", "G", "T", "P", "E", "Z", "Y", "R", "Q"}
+
+// Format the given number with three significant digits and the corresponding SI prefix,
+// optionally followed by a unit, e.g. 12345 => "12.3 k" and 0.0015, "s" => "1.5 ms".
+func siPrefixFilter(n float64, unit func(string) string) string {
+	exponent := 0
+	if n != 0 {
+		exponent = int(math.Floor(math.Log10(math.Abs(n)) / 3))
+	}
+	// stay within the available prefixes; the middle one is no prefix
+	middle := len(siPrefixes) / 2
+	exponent = max(-middle, min(middle, exponent))
+
+	// rounding to three digits can carry over to the next prefix, e.g. 999.96 => 1000
+	scaled := roundSignificant(n/math.Pow(1000, float64(exponent)), 3)
+	if math.Abs(scaled) >= 1000 && exponent < middle {
+		exponent++
+		scaled = roundSignificant(n/math.Pow(1000, float64(exponent)), 3)
+	}
+
+	number := strconv.FormatFloat(scaled, 'f', -1, 64)
+	suffix := siPrefixes[middle+exponent] + unit("")
+	if suffix == "" {
+		return number
+	}
+	return number + " " + suffix
+}
+
+func roundSignificant(n float64, digits int) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(n, 'g', digits, 64), 64)
+	return rounded
 }
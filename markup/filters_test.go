@@ -0,0 +1,267 @@
+package markup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNumberFilters(t *testing.T) {
+	engine := NewEngine("https://olano.dev", "includes")
+	render := func(template string) string {
+		t.Helper()
+		output, err := engine.ParseAndRenderString(template, map[string]interface{}{})
+		assertEqual(t, err, nil)
+		return output
+	}
+
+	assertEqual(t, render(`{{ 12345 | si_prefix }}`), "12.3 k")
+	assertEqual(t, render(`{{ 999 | si_prefix }}`), "999")
+	assertEqual(t, render(`{{ 999960 | si_prefix }}`), "1 M")
+	assertEqual(t, render(`{{ 0.0015 | si_prefix: "s" }}`), "1.5 ms")
+	assertEqual(t, render(`{{ 0 | si_prefix: "B" }}`), "0 B")
+	assertEqual(t, render(`{{ -2500000000 | si_prefix: "W" }}`), "-2.5 GW")
+
+	assertEqual(t, render(`{{ 0.1234 | percent }}`), "12%")
+	assertEqual(t, render(`{{ 0.1234 | percent: 1 }}`), "12.3%")
+}
+
+func TestAsciiMathToMathML(t *testing.T) {
+	const open = `<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow>`
+	const close = "</mrow></math>"
+
+	assertEqual(t, AsciiMathToMathML("x^2 + 1"), open+"<msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><mn>1</mn>"+close)
+	assertEqual(t, AsciiMathToMathML("(a+b)/2"), open+"<mfrac><mrow><mi>a</mi><mo>+</mo><mi>b</mi></mrow><mn>2</mn></mfrac>"+close)
+	assertEqual(t, AsciiMathToMathML("sqrt(x_1) != alpha"), open+"<msqrt><msub><mi>x</mi><mn>1</mn></msub></msqrt><mo>≠</mo><mi>α</mi>"+close)
+	assertEqual(t, AsciiMathToMathML("sum_(i=1)^n i"), open+"<munderover><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>i</mi>"+close)
+	assertEqual(t, AsciiMathToMathML(`root(3)(x) text(if x < 1)`), open+"<mroot><mi>x</mi><mn>3</mn></mroot><mtext>if x &lt; 1</mtext>"+close)
+	assertEqual(t, AsciiMathToMathML("f(x)"), open+"<mi>f</mi><mrow><mo>(</mo><mi>x</mi><mo>)</mo></mrow>"+close)
+	// unmatched closing brackets don't end the expression
+	assertEqual(t, AsciiMathToMathML("a) + b]"), open+"<mi>a</mi><mo>)</mo><mo>+</mo><mi>b</mi><mo>]</mo>"+close)
+}
+
+func TestEscapeFilters(t *testing.T) {
+	engine := NewEngine("https://olano.dev", "includes")
+	render := func(template string, bindings map[string]interface{}) string {
+		t.Helper()
+		output, err := engine.ParseAndRenderString(template, bindings)
+		assertEqual(t, err, nil)
+		return output
+	}
+	bindings := map[string]interface{}{
+		"title": `Tom & "Jerry" <3`,
+		"post":  map[string]interface{}{"title": "a & b", "tags": []string{"x", "y"}},
+	}
+
+	assertEqual(t, render(`{{ title | xml_escape }}`, bindings), "Tom &amp; &#34;Jerry&#34; &lt;3")
+	assertEqual(t, render(`{{ title | json_escape }}`, bindings), `Tom & \"Jerry\" <3`)
+	assertEqual(t, render(`{{ post | jsonify }}`, bindings), `{"tags":["x","y"],"title":"a & b"}`)
+	assertEqual(t, render(`{{ post.tags | jsonify: true }}`, bindings), "[\n  \"x\",\n  \"y\"\n]")
+	assertEqual(t, render(`{{ "a <b>]]> c" | cdata }}`, bindings), "<![CDATA[a <b>]]]]><![CDATA[> c]]>")
+}
+
+func TestCustomHelpers(t *testing.T) {
+	engine := NewEngine("https://olano.dev", "includes")
+	filters := map[string]interface{}{
+		"shout": "{{ input | upcase }}{{ arg | default: '!' }}",
+		"rot13": map[string]interface{}{"command": "tr a-z n-za-m"},
+	}
+	tags := map[string]interface{}{
+		"badge": `<span class="badge {{ kind }}">{{ args | shout }}</span>`,
+		"echo":  map[string]interface{}{"command": "echo"},
+	}
+	err := LoadCustomHelpers(engine, filters, tags, nil)
+	assertEqual(t, err, nil)
+
+	render := func(template string) string {
+		t.Helper()
+		output, err := engine.ParseAndRenderString(template, map[string]interface{}{"kind": "info", "name": "jorge"})
+		assertEqual(t, err, nil)
+		return output
+	}
+	assertEqual(t, render(`{{ name | shout }}`), "JORGE!")
+	assertEqual(t, render(`{{ name | shout: "?" }}`), "JORGE?")
+	assertEqual(t, render(`{{ "hello" | rot13 }}`), "uryyb")
+	assertEqual(t, render(`{% badge new {{ name }} %}`), `<span class="badge info">NEW JORGE!</span>`)
+	assertEqual(t, render(`{% echo a {{ name }} %}`), "a jorge")
+
+	err = LoadCustomHelpers(engine, map[string]interface{}{"broken": 42}, nil, nil)
+	assert(t, err != nil)
+}
+
+func TestCommandRunner(t *testing.T) {
+	t.Setenv("JORGE_TEST_TOKEN", "secret")
+	t.Setenv("JORGE_TEST_VISIBLE", "visible")
+	dir := t.TempDir()
+	runner := &CommandRunner{Timeout: 100 * time.Millisecond, Env: []string{"JORGE_TEST_VISIBLE"}, Dir: dir}
+
+	// only the allowed variables are passed to the command
+	output, err := runner.Run("sh -c", "", "echo $JORGE_TEST_TOKEN-$JORGE_TEST_VISIBLE")
+	assertEqual(t, err, nil)
+	assertEqual(t, output, "-visible")
+
+	output, err = runner.Run("pwd", "")
+	assertEqual(t, err, nil)
+	resolved, _ := filepath.EvalSymlinks(dir)
+	assertEqual(t, output, resolved)
+
+	_, err = runner.Run("sleep 5", "")
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "sleep timed out after 100ms"))
+
+	_, err = runner.Run("sh -c", "", "echo bad input >&2; exit 1")
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "\nsh: bad input"))
+
+	// canceling the build context kills the running commands
+	ctx, cancel := context.WithCancel(context.Background())
+	runner = &CommandRunner{Timeout: time.Minute}
+	runner.SetContext(ctx)
+	cancel()
+	_, err = runner.Run("sleep 5", "")
+	assert(t, err != nil)
+}
+
+func TestIncludeRemote(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	snippet := `<p>{{ title }}</p>`
+	hash := sha256.Sum256([]byte(snippet))
+	notModified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(snippet))
+	}))
+
+	engine := NewEngine("https://olano.dev", "includes")
+	render := func(template string) (string, error) {
+		return engine.ParseAndRenderString(template, map[string]interface{}{"title": "hello"})
+	}
+
+	tag := fmt.Sprintf(`{%% include_remote "%s/footer.html" sha256=%s %%}`, server.URL, hex.EncodeToString(hash[:]))
+	output, err := render(tag)
+	assertEqual(t, err, nil)
+	assertEqual(t, output, "<p>hello</p>")
+	assertEqual(t, notModified, 0)
+
+	// revalidated with the etag
+	output, err = render(tag)
+	assertEqual(t, err, nil)
+	assertEqual(t, output, "<p>hello</p>")
+	assertEqual(t, notModified, 1)
+
+	// wrong hash
+	_, err = render(fmt.Sprintf(`{%% include_remote "%s/footer.html" sha256=abc %%}`, server.URL))
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "sha256 mismatch"))
+
+	// falls back to the cached copy when offline
+	server.Close()
+	output, err = render(tag)
+	assertEqual(t, err, nil)
+	assertEqual(t, output, "<p>hello</p>")
+
+	_, err = render(fmt.Sprintf(`{%% include_remote "%s/other.html" %%}`, server.URL))
+	assert(t, err != nil)
+}
+
+func TestIncludeCached(t *testing.T) {
+	includesDir := t.TempDir()
+	os.WriteFile(filepath.Join(includesDir, "nav.html"), []byte(`<nav>{{ include.depth }} {{ title }}</nav>`), 0666)
+	engine := NewEngine("https://olano.dev", includesDir)
+	render := func(template string, title string) string {
+		t.Helper()
+		output, err := engine.ParseAndRenderString(template, map[string]interface{}{"title": title, "levels": 3})
+		assertEqual(t, err, nil)
+		return output
+	}
+
+	assertEqual(t, render(`{% include_cached nav.html depth=2 %}`, "first"), "<nav>2 first</nav>")
+	// the output for the same parameters is reused, even if the rest of the context changed
+	assertEqual(t, render(`{% include_cached nav.html depth=2 %}`, "second"), "<nav>2 first</nav>")
+	assertEqual(t, render(`{% include_cached nav.html depth=levels %}`, "second"), "<nav>3 second</nav>")
+	assertEqual(t, render(`{% include nav.html %}`, "third"), "<nav> third</nav>")
+
+	// modifying the file invalidates the cache
+	os.WriteFile(filepath.Join(includesDir, "nav.html"), []byte(`<ul>{{ include.depth }}</ul>`), 0666)
+	os.Chtimes(filepath.Join(includesDir, "nav.html"), time.Now(), time.Now().Add(time.Second))
+	assertEqual(t, render(`{% include_cached nav.html depth=2 %}`, "fourth"), "<ul>2</ul>")
+}
+
+func TestIncludeBlock(t *testing.T) {
+	includesDir := t.TempDir()
+	os.WriteFile(filepath.Join(includesDir, "card.html"), []byte(`<div class="{{ include.class }}">{{ include.content }}</div>`), 0666)
+	os.WriteFile(filepath.Join(includesDir, "panel.html"), []byte(`{% include card.html class="panel" %}<b>{{ include.title }}</b>{% endinclude %}`), 0666)
+	engine := NewEngine("https://olano.dev", includesDir)
+	render := func(template string) string {
+		t.Helper()
+		output, err := engine.ParseAndRenderString(string(expandIncludeBlocks([]byte(template))), map[string]interface{}{"title": "hello"})
+		assertEqual(t, err, nil)
+		return output
+	}
+
+	assertEqual(t, render(`{% include card.html class="a" %}<p>{{ title }}</p>{% endinclude %}`), `<div class="a"><p>hello</p></div>`)
+	assertEqual(t, render(`{% include card.html class="a" %}`), `<div class="a"></div>`)
+	// tags and blocks can be mixed and nested, each endinclude closing the nearest open include
+	assertEqual(t,
+		render(`{% include card.html class="a" %}{% include card.html class="b" %}{% include card.html class="c" %}x{% endinclude %}{%- endinclude -%}`),
+		`<div class="a"></div><div class="b"><div class="c">x</div></div>`)
+	// includes can use include blocks too
+	assertEqual(t, render(`{% include panel.html title=title %}`), `<div class="panel"><b>hello</b></div>`)
+}
+
+func TestMarkupFilters(t *testing.T) {
+	engine := NewEngine("https://olano.dev", "includes")
+	bindings := map[string]interface{}{
+		"project": map[string]interface{}{
+			"md":  "A *static* site [generator](https://jorge.olano.dev).",
+			"org": "A /static/ site [[https://jorge.olano.dev][generator]].",
+		},
+	}
+
+	output, err := engine.ParseAndRenderString(`{{ project.md | markdownify }}`, bindings)
+	assertEqual(t, err, nil)
+	assertEqual(t, output, "<p>A <em>static</em> site <a href=\"https://jorge.olano.dev\">generator</a>.</p>\n")
+
+	output, err = engine.ParseAndRenderString(`{{ project.org | orgify }}`, bindings)
+	assertEqual(t, err, nil)
+	assertEqual(t, strings.TrimSpace(output), "<p>A <em>static</em> site <a href=\"https://jorge.olano.dev\">generator</a>.</p>")
+}
+
+func TestCollectionFilters(t *testing.T) {
+	engine := NewEngine("https://olano.dev", "includes")
+	bindings := map[string]interface{}{
+		"posts": []map[string]interface{}{
+			{"title": "banana", "lang": "en", "year": 2023},
+			{"title": "Apple", "lang": "es", "year": 2024},
+			{"title": "cherry", "lang": "en", "year": 2024},
+		},
+	}
+	render := func(template string) string {
+		t.Helper()
+		output, err := engine.ParseAndRenderString(template, bindings)
+		assertEqual(t, err, nil)
+		return output
+	}
+
+	assertEqual(t, render(`{{ posts | where_exp: "post", "post.year > 2023" | map: "title" | join: "," }}`), "Apple,cherry")
+	assertEqual(t, render(`{% assign groups = posts | group_by_exp: "post", "post.lang" %}{% for g in groups %}{{ g.name }}:{{ g.items | size }} {% endfor %}`), "en:2 es:1 ")
+	assertEqual(t, render(`{% assign post = posts | find: "lang", "en" %}{{ post.title }}`), "banana")
+	assertEqual(t, render(`{{ posts | find: "lang", "fr" }}`), "")
+	assertEqual(t, render(`{% assign post = posts | find_exp: "post", "post.year == 2024" %}{{ post.title }}`), "Apple")
+	assertEqual(t, render(`{{ posts | sort: "title" | map: "title" | join: "," }}`), "Apple,banana,cherry")
+	assertEqual(t, render(`{{ posts | map: "title" | sort_natural | join: "," }}`), "Apple,banana,cherry")
+	assertEqual(t, render(`{{ posts | sort_natural: "title" | map: "title" | join: "," }}`), "Apple,banana,cherry")
+}
@@ -2,9 +2,15 @@ package markup
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // Find the first p tag in the given html document and return its text content.
@@ -67,6 +73,345 @@ func InjectScript(htmlReader io.Reader, jsCode string) (io.Reader, error) {
 	return &buf, nil
 }
 
+// Add <link> elements with the given rel and each of the given hrefs to the head of the HTML document.
+func InjectHeadLinks(htmlReader io.Reader, rel string, hrefs []string) (io.Reader, error) {
+	doc, err := html.Parse(htmlReader)
+	if err != nil {
+		return nil, err
+	}
+
+	head := findFirstElement(doc, "head")
+	if head == nil {
+		return nil, fmt.Errorf("missing head element")
+	}
+	for _, href := range hrefs {
+		head.AppendChild(&html.Node{
+			Type:     html.ElementNode,
+			Data:     "link",
+			DataAtom: atom.Link,
+			Attr:     []html.Attribute{{Key: "rel", Val: rel}, {Key: "href", Val: href}},
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// Add the given `rel` values, and optionally `target="_blank"`, to the links in the given
+// HTML document that point to a different host than the site's.
+func MarkExternalLinks(htmlReader io.Reader, siteUrl string, rel string, newTab bool) (io.Reader, error) {
+	doc, err := html.Parse(htmlReader)
+	if err != nil {
+		return nil, err
+	}
+
+	var siteHost string
+	if parsed, err := url.Parse(siteUrl); err == nil {
+		siteHost = parsed.Host
+	}
+
+	for _, link := range findAllElements(doc, "a") {
+		href, err := url.Parse(GetAttribute(link, "href"))
+		if err != nil || href.Host == "" || href.Host == siteHost {
+			continue
+		}
+
+		if rel != "" {
+			values := strings.Fields(GetAttribute(link, "rel"))
+			for _, value := range strings.Fields(rel) {
+				if !slices.Contains(values, value) {
+					values = append(values, value)
+				}
+			}
+			setAttribute(link, "rel", strings.Join(values, " "))
+		}
+		if newTab && GetAttribute(link, "target") == "" {
+			setAttribute(link, "target", "_blank")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// Wrap the elements of the given HTML document with the given tag names, e.g. table or pre, in divs with
+// the corresponding class, for the site stylesheet to make them scroll horizontally, so wide content
+// doesn't break the layout on small screens. Elements that are already inside a wrapper, or inside
+// another wrapped element, e.g. the code blocks of a line numbers table, are left alone.
+func WrapOverflow(htmlReader io.Reader, classes map[string]string) (io.Reader, error) {
+	doc, err := html.Parse(htmlReader)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapperClasses := make(map[string]bool)
+	for _, class := range classes {
+		wrapperClasses[class] = true
+	}
+	isWrapped := func(node *html.Node) bool {
+		for parent := node.Parent; parent != nil; parent = parent.Parent {
+			if parent.Type != html.ElementNode {
+				continue
+			}
+			if _, found := classes[parent.Data]; found {
+				return true
+			}
+			if parent.Data == "div" && slices.ContainsFunc(strings.Fields(GetAttribute(parent, "class")), func(class string) bool {
+				return wrapperClasses[class]
+			}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for tagName, class := range classes {
+		for _, node := range findAllElements(doc, tagName) {
+			if node.Parent == nil || isWrapped(node) {
+				continue
+			}
+			wrapper := &html.Node{
+				Type:     html.ElementNode,
+				Data:     "div",
+				DataAtom: atom.Div,
+				Attr:     []html.Attribute{{Key: "class", Val: class}},
+			}
+			node.Parent.InsertBefore(wrapper, node)
+			node.Parent.RemoveChild(node)
+			wrapper.AppendChild(node)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// The attributes of the elements that embed remote images and media, which can be proxied or localized.
+var REMOTE_ASSET_ATTRIBUTES = map[string][]string{
+	"img":    {"src", "srcset"},
+	"source": {"src", "srcset"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+	"track":  {"src"},
+}
+
+// Replace the urls of the remote images and media embedded in the given HTML document with the ones
+// returned by `rewrite`, e.g. to load them from a local copy. Urls pointing to the site host are left
+// alone, as well as those for which `rewrite` returns false.
+func RewriteRemoteAssets(htmlReader io.Reader, siteUrl string, rewrite func(string) (string, bool)) (io.Reader, error) {
+	doc, err := html.Parse(htmlReader)
+	if err != nil {
+		return nil, err
+	}
+
+	var siteHost string
+	if parsed, err := url.Parse(siteUrl); err == nil {
+		siteHost = parsed.Host
+	}
+	rewriteUrl := func(value string) string {
+		parsed, err := url.Parse(value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == siteHost {
+			return value
+		}
+		if rewritten, ok := rewrite(value); ok {
+			return rewritten
+		}
+		return value
+	}
+
+	for tagName, keys := range REMOTE_ASSET_ATTRIBUTES {
+		for _, element := range findAllElements(doc, tagName) {
+			for _, key := range keys {
+				rewriteUrlAttribute(element, key, rewriteUrl)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// Replace the link and resource urls of the given HTML document, in href, src, srcset and poster
+// attributes, with the ones returned by `rewrite`, e.g. to serve some of the files from a CDN.
+func RewriteUrls(htmlReader io.Reader, rewrite func(string) string) (io.Reader, error) {
+	doc, err := html.Parse(htmlReader)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{"href", "src", "srcset", "poster"} {
+		for _, element := range findElementsWithAttribute(doc, key) {
+			rewriteUrlAttribute(element, key, rewrite)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// Replace the url of the given attribute of the element, or each of the urls if it's a srcset.
+func rewriteUrlAttribute(element *html.Node, key string, rewrite func(string) string) {
+	value := GetAttribute(element, key)
+	if value == "" {
+		return
+	}
+	if key != "srcset" {
+		setAttribute(element, key, rewrite(value))
+		return
+	}
+	// a comma separated list of urls followed by their width or density descriptors
+	candidates := strings.Split(value, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			fields[0] = rewrite(fields[0])
+			candidates[i] = strings.Join(fields, " ")
+		}
+	}
+	setAttribute(element, key, strings.Join(candidates, ", "))
+}
+
+// Resolve the relative urls of links and embedded resources in the given html fragment against the given
+// base url, e.g. photo.jpg to /blog/my-post/photo.jpg, so they work wherever the content is included.
+func ResolveRelativeUrls(content []byte, base string) ([]byte, error) {
+	baseUrl, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(content), body)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		for _, key := range []string{"href", "src", "poster"} {
+			for _, element := range findElementsWithAttribute(node, key) {
+				ref, err := url.Parse(GetAttribute(element, key))
+				if err != nil || ref.Scheme != "" || ref.Host != "" || ref.Path == "" || strings.HasPrefix(ref.Path, "/") {
+					continue
+				}
+				setAttribute(element, key, baseUrl.ResolveReference(ref).String())
+			}
+		}
+		if err := html.Render(&buf, node); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Finds the elements, including the given node, that have the given attribute.
+func findElementsWithAttribute(node *html.Node, key string) []*html.Node {
+	var elements []*html.Node
+	if node.Type == html.ElementNode && slices.ContainsFunc(node.Attr, func(attr html.Attribute) bool { return attr.Key == key }) {
+		elements = append(elements, node)
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		elements = append(elements, findElementsWithAttribute(child, key)...)
+	}
+	return elements
+}
+
+// Return the urls of the social media preview images declared in the meta tags
+// of the given HTML document, i.e. og:image and twitter:image.
+func SocialImages(htmlReader io.Reader) []string {
+	doc, err := html.Parse(htmlReader)
+	if err != nil {
+		return nil
+	}
+
+	var images []string
+	for _, meta := range findAllElements(doc, "meta") {
+		property := GetAttribute(meta, "property")
+		if property == "" {
+			property = GetAttribute(meta, "name")
+		}
+		content := GetAttribute(meta, "content")
+		if (property == "og:image" || property == "twitter:image") && content != "" && !slices.Contains(images, content) {
+			images = append(images, content)
+		}
+	}
+	return images
+}
+
+// An url referenced by an html page or a stylesheet. References to scripts and stylesheets
+// are required, since the page is broken without them.
+type AssetReference struct {
+	Url      string
+	Required bool
+}
+
+// Return the urls of the resources referenced by the given HTML document: links, e.g. to stylesheets
+// and icons, scripts, embedded images and media, and the urls in inline styles.
+func AssetReferences(htmlReader io.Reader) []AssetReference {
+	doc, err := html.Parse(htmlReader)
+	if err != nil {
+		return nil
+	}
+
+	var references []AssetReference
+	for _, key := range []string{"href", "src", "srcset", "poster", "data"} {
+		for _, element := range findElementsWithAttribute(doc, key) {
+			value := GetAttribute(element, key)
+			if key == "data" && element.Data != "object" {
+				continue
+			}
+			required := (element.Data == "script" && key == "src") ||
+				(element.Data == "link" && slices.Contains(strings.Fields(GetAttribute(element, "rel")), "stylesheet"))
+			if key != "srcset" {
+				references = append(references, AssetReference{Url: strings.TrimSpace(value), Required: required})
+				continue
+			}
+			for _, candidate := range strings.Split(value, ",") {
+				if fields := strings.Fields(candidate); len(fields) > 0 {
+					references = append(references, AssetReference{Url: fields[0]})
+				}
+			}
+		}
+	}
+
+	for _, element := range findElementsWithAttribute(doc, "style") {
+		references = append(references, StylesheetReferences(GetAttribute(element, "style"))...)
+	}
+	for _, style := range findAllElements(doc, "style") {
+		references = append(references, StylesheetReferences(getTextContent(style))...)
+	}
+	return references
+}
+
+var cssUrlPattern = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+var cssImportPattern = regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`)
+
+// Return the urls referenced by the given stylesheet, in @import rules, which are required,
+// and url() values, e.g. of fonts and background images.
+func StylesheetReferences(css string) []AssetReference {
+	var references []AssetReference
+	for _, match := range cssImportPattern.FindAllStringSubmatch(css, -1) {
+		references = append(references, AssetReference{Url: match[1], Required: true})
+	}
+	for _, match := range cssUrlPattern.FindAllStringSubmatch(css, -1) {
+		references = append(references, AssetReference{Url: match[1]})
+	}
+	return references
+}
+
 // Finds the first occurrence of the specified element in the HTML document
 func findFirstElement(n *html.Node, tagName string) *html.Node {
 	if n.Type == html.ElementNode && n.Data == tagName {
@@ -80,6 +425,39 @@ func findFirstElement(n *html.Node, tagName string) *html.Node {
 	return nil
 }
 
+// Finds all the occurrences of the specified element in the HTML document
+func findAllElements(n *html.Node, tagName string) []*html.Node {
+	var elements []*html.Node
+	if n.Type == html.ElementNode && n.Data == tagName {
+		elements = append(elements, n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		elements = append(elements, findAllElements(c, tagName)...)
+	}
+	return elements
+}
+
+// Return the value of the given attribute of the node, or an empty string if missing.
+func GetAttribute(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// Set the value of the given node attribute, replacing the previous one if present.
+func setAttribute(node *html.Node, key string, value string) {
+	for i, attr := range node.Attr {
+		if attr.Key == key {
+			node.Attr[i].Val = value
+			return
+		}
+	}
+	node.Attr = append(node.Attr, html.Attribute{Key: key, Val: value})
+}
+
 // Finds the <head> element in the HTML document
 func getTextContent(node *html.Node) string {
 	var textContent string
@@ -0,0 +1,151 @@
+package markup
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMarkExternalLinks(t *testing.T) {
+	input := `<html><head></head><body>
+<a href="/blog/hello">internal</a>
+<a href="https://olano.dev/blog/hello">absolute internal</a>
+<a href="https://github.com/facundoolano/jorge">external</a>
+<a href="https://github.com/facundoolano/feedi" rel="me" target="_self">external with attributes</a>
+</body></html>`
+
+	output, err := MarkExternalLinks(strings.NewReader(input), "https://olano.dev", "noopener noreferrer", true)
+	assertEqual(t, err, nil)
+	buf := new(strings.Builder)
+	_, err = io.Copy(buf, output)
+	assertEqual(t, err, nil)
+
+	assertEqual(t, buf.String(), `<html><head></head><body>
+<a href="/blog/hello">internal</a>
+<a href="https://olano.dev/blog/hello">absolute internal</a>
+<a href="https://github.com/facundoolano/jorge" rel="noopener noreferrer" target="_blank">external</a>
+<a href="https://github.com/facundoolano/feedi" rel="me noopener noreferrer" target="_self">external with attributes</a>
+</body></html>`)
+}
+
+func TestWrapOverflow(t *testing.T) {
+	input := `<html><head></head><body>
+<table><tr><td><table><tr><td>nested</td></tr></table></td></tr></table>
+<pre><code>wide code</code></pre>
+<div class="code-wrapper"><pre>already wrapped</pre></div>
+<div class="highlight"><table><tr><td><pre>1</pre></td><td><pre>line numbers</pre></td></tr></table></div>
+</body></html>`
+
+	output, err := WrapOverflow(strings.NewReader(input), map[string]string{"table": "table-wrapper", "pre": "code-wrapper"})
+	assertEqual(t, err, nil)
+	buf := new(strings.Builder)
+	_, err = io.Copy(buf, output)
+	assertEqual(t, err, nil)
+
+	assertEqual(t, buf.String(), `<html><head></head><body>
+<div class="table-wrapper"><table><tbody><tr><td><table><tbody><tr><td>nested</td></tr></tbody></table></td></tr></tbody></table></div>
+<div class="code-wrapper"><pre><code>wide code</code></pre></div>
+<div class="code-wrapper"><pre>already wrapped</pre></div>
+<div class="highlight"><div class="table-wrapper"><table><tbody><tr><td><pre>1</pre></td><td><pre>line numbers</pre></td></tr></tbody></table></div></div>
+</body></html>`)
+}
+
+func TestRewriteRemoteAssets(t *testing.T) {
+	input := `<html><head></head><body>
+<img src="https://cdn.example.com/photo.jpg" srcset="https://cdn.example.com/photo.jpg 1x, /photo@2x.jpg 2x"/>
+<img src="https://olano.dev/local.jpg"/> <img src="data:image/png;base64,abc"/>
+<video poster="https://cdn.example.com/poster.png"><source src="https://cdn.example.com/clip.mp4"/></video>
+<a href="https://cdn.example.com/photo.jpg">link</a>
+</body></html>`
+
+	output, err := RewriteRemoteAssets(strings.NewReader(input), "https://olano.dev", func(url string) (string, bool) {
+		return "/_proxy/" + url, true
+	})
+	assertEqual(t, err, nil)
+	buf := new(strings.Builder)
+	_, err = io.Copy(buf, output)
+	assertEqual(t, err, nil)
+
+	assertEqual(t, buf.String(), `<html><head></head><body>
+<img src="/_proxy/https://cdn.example.com/photo.jpg" srcset="/_proxy/https://cdn.example.com/photo.jpg 1x, /photo@2x.jpg 2x"/>
+<img src="https://olano.dev/local.jpg"/> <img src="data:image/png;base64,abc"/>
+<video poster="/_proxy/https://cdn.example.com/poster.png"><source src="/_proxy/https://cdn.example.com/clip.mp4"/></video>
+<a href="https://cdn.example.com/photo.jpg">link</a>
+</body></html>`)
+}
+
+func TestAssetReferences(t *testing.T) {
+	input := `<html><head>
+<link rel="stylesheet" href="/assets/css/main.css"/><link rel="icon" href="/favicon.ico"/>
+<script src="app.js"></script><style>@import "base.css"; body { background: url('/assets/bg.png') }</style>
+</head><body>
+<img src="photo.jpg" srcset="photo-2x.jpg 2x, photo-3x.jpg 3x"/><div style="background-image: url(/assets/hero.jpg)"></div>
+</body></html>`
+
+	references := AssetReferences(strings.NewReader(input))
+	assertEqual(t, len(references), 9)
+	required := []string{}
+	optional := []string{}
+	for _, reference := range references {
+		if reference.Required {
+			required = append(required, reference.Url)
+		} else {
+			optional = append(optional, reference.Url)
+		}
+	}
+	slices.Sort(required)
+	slices.Sort(optional)
+	assertEqual(t, strings.Join(required, " "), "/assets/css/main.css app.js base.css")
+	assertEqual(t, strings.Join(optional, " "), "/assets/bg.png /assets/hero.jpg /favicon.ico photo-2x.jpg photo-3x.jpg photo.jpg")
+}
+
+func TestResolveRelativeUrls(t *testing.T) {
+	input := `<p><img src="photo.jpg" alt="photo"/> <a href="../other/">other</a> <a href="/about">about</a>
+<a href="#notes">notes</a> <a href="https://olano.dev">site</a> <a href="slides.pdf?page=2#intro">slides</a></p>`
+
+	output, err := ResolveRelativeUrls([]byte(input), "/blog/my-post/")
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<p><img src="/blog/my-post/photo.jpg" alt="photo"/> <a href="/blog/other/">other</a> <a href="/about">about</a>
+<a href="#notes">notes</a> <a href="https://olano.dev">site</a> <a href="/blog/my-post/slides.pdf?page=2#intro">slides</a></p>`)
+}
+
+func TestSocialImages(t *testing.T) {
+	input := `<html><head>
+<meta property="og:image" content="https://olano.dev/img/card.png">
+<meta name="twitter:image" content="https://olano.dev/img/card.png">
+<meta name="twitter:image" content="/img/other.png">
+<meta name="description" content="not an image">
+</head><body></body></html>`
+
+	images := SocialImages(strings.NewReader(input))
+	assertEqual(t, len(images), 2)
+	assertEqual(t, images[0], "https://olano.dev/img/card.png")
+	assertEqual(t, images[1], "/img/other.png")
+}
+
+func TestExtractSection(t *testing.T) {
+	input := `<h1>Intro</h1>
+<p>hello</p>
+<h2 id="the-sub">Sub section</h2>
+<p>sub text</p>
+<h3>Deeper</h3>
+<p>deeper text</p>
+<h2>About me</h2>
+<p>bio</p>`
+
+	section, err := ExtractSection([]byte(input), "the-sub")
+	assertEqual(t, err, nil)
+	assertEqual(t, string(section), "<p>sub text</p>\n<h3>Deeper</h3>\n<p>deeper text</p>")
+
+	section, err = ExtractSection([]byte(input), "about-me")
+	assertEqual(t, err, nil)
+	assertEqual(t, string(section), "<p>bio</p>")
+
+	section, err = ExtractSection([]byte(input), "intro")
+	assertEqual(t, err, nil)
+	assert(t, strings.HasSuffix(string(section), "<p>bio</p>"))
+
+	_, err = ExtractSection([]byte(input), "missing")
+	assert(t, err != nil)
+}
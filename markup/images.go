@@ -0,0 +1,59 @@
+package markup
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strconv"
+
+	"golang.org/x/net/html"
+)
+
+// Return the width and height of the image at the given path.
+// Supports gif, jpeg and png files.
+func ImageDimensions(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// Add `loading="lazy"` to the img tags of the given HTML document, along with `width` and `height`
+// attributes if the `imageDimensions` function can resolve them from the image src.
+// Attributes already present in the tags are left as is.
+func AddImageAttributes(htmlReader io.Reader, imageDimensions func(src string) (int, int, bool)) (io.Reader, error) {
+	doc, err := html.Parse(htmlReader)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, img := range findAllElements(doc, "img") {
+		if GetAttribute(img, "loading") == "" {
+			setAttribute(img, "loading", "lazy")
+		}
+		if GetAttribute(img, "width") != "" || GetAttribute(img, "height") != "" {
+			continue
+		}
+		if width, height, ok := imageDimensions(GetAttribute(img, "src")); ok {
+			setAttribute(img, "width", strconv.Itoa(width))
+			setAttribute(img, "height", strconv.Itoa(height))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
@@ -0,0 +1,152 @@
+package markup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches org include directives like:
+//
+//	#+INCLUDE: "chapter1.org"
+//	#+INCLUDE: "../main.go" src go :lines "5-10"
+var orgIncludeRegex = regexp.MustCompile(`(?im)^[ \t]*#\+include:[ \t]*"([^"]+)"([^\n]*)$`)
+var orgIncludeLinesRegex = regexp.MustCompile(`:lines[ \t]+"([^"]*)"`)
+
+const MAX_INCLUDE_DEPTH = 10
+
+// The name of the block tag that include tags with a matching endinclude are converted to.
+const INCLUDE_BLOCK_TAG = "include_block"
+
+var includeTagRegex = regexp.MustCompile(`\{%(-?)\s*(end)?include(\s[^%]*?)?\s*(-?)%\}`)
+
+// Replace the #+INCLUDE directives in the given org content with the contents of the referenced
+// files, resolved relative to the given directory. As in org-mode, the contents can be wrapped in a
+// src, example or export block, and restricted to a line range with :lines "5-10" (10 excluded).
+// Org files included without a block are expanded recursively. If not nil, onRead is called
+// with the path of each included file.
+func expandOrgIncludes(content []byte, dir string, depth int, onRead func(string)) ([]byte, error) {
+	if depth > MAX_INCLUDE_DEPTH {
+		return nil, fmt.Errorf("too many nested #+INCLUDE directives")
+	}
+
+	var err error
+	result := orgIncludeRegex.ReplaceAllFunc(content, func(directive []byte) []byte {
+		if err != nil {
+			return directive
+		}
+		groups := orgIncludeRegex.FindSubmatch(directive)
+		path := string(groups[1])
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		options := strings.TrimSpace(string(groups[2]))
+
+		if onRead != nil {
+			onRead(path)
+		}
+		var included []byte
+		if included, err = os.ReadFile(path); err != nil {
+			return directive
+		}
+		if match := orgIncludeLinesRegex.FindStringSubmatch(options); match != nil {
+			if included, err = includeLines(included, match[1]); err != nil {
+				return directive
+			}
+			options = strings.TrimSpace(orgIncludeLinesRegex.ReplaceAllString(options, ""))
+		}
+		included = []byte(strings.TrimSuffix(string(included), "\n"))
+
+		kind, arg, _ := strings.Cut(options, " ")
+		switch strings.ToLower(kind) {
+		case "src", "example", "export":
+			block := strings.ToLower(kind)
+			return []byte(fmt.Sprintf("#+begin_%s %s\n%s\n#+end_%s", block, strings.TrimSpace(arg), included, block))
+		}
+		included, err = expandOrgIncludes(included, filepath.Dir(path), depth+1, onRead)
+		return included
+	})
+	return result, err
+}
+
+// Return the lines of the content in the given range, following the org-mode convention where
+// the end of the range is excluded and either end can be omitted, e.g. "5-10", "-10" or "5-".
+func includeLines(content []byte, lineRange string) ([]byte, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	from, to, _ := strings.Cut(lineRange, "-")
+	start, end := 1, len(lines)+1
+	var err error
+	if from = strings.TrimSpace(from); from != "" {
+		if start, err = strconv.Atoi(from); err != nil {
+			return nil, fmt.Errorf("invalid :lines %q", lineRange)
+		}
+	}
+	if to = strings.TrimSpace(to); to != "" {
+		if end, err = strconv.Atoi(to); err != nil {
+			return nil, fmt.Errorf("invalid :lines %q", lineRange)
+		}
+	}
+	start = max(1, start)
+	end = min(len(lines)+1, end)
+	if start >= end {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(lines[start-1:end-1], "")), nil
+}
+
+// Convert the include tags of the given liquid source that have a matching endinclude to include blocks,
+// so they can be used both as tags and as blocks that pass their content to the included file:
+//
+//	{% include note.html %}
+//	{% include card.html title="Hello" %}<p>card body</p>{% endinclude %}
+//
+// Each endinclude closes the nearest preceding include that isn't closed yet.
+// Liquid requires blocks to be declared upfront, so it can't tell these two cases apart on its own.
+func expandIncludeBlocks(source []byte) []byte {
+	matches := includeTagRegex.FindAllSubmatchIndex(source, -1)
+	blocks := make(map[int]bool)
+	var open []int
+	for i, match := range matches {
+		isEnd := match[4] != -1
+		if !isEnd {
+			open = append(open, i)
+		} else if len(open) > 0 {
+			blocks[open[len(open)-1]] = true
+			blocks[i] = true
+			open = open[:len(open)-1]
+		}
+	}
+	if len(blocks) == 0 {
+		return source
+	}
+
+	var result bytes.Buffer
+	last := 0
+	for i, match := range matches {
+		if !blocks[i] {
+			continue
+		}
+		result.Write(source[last:match[0]])
+		leftTrim, rightTrim := source[match[2]:match[3]], source[match[8]:match[9]]
+		if match[4] != -1 {
+			fmt.Fprintf(&result, "{%%%s end%s %s%%}", leftTrim, INCLUDE_BLOCK_TAG, rightTrim)
+		} else {
+			var args []byte
+			if match[6] != -1 {
+				args = source[match[6]:match[7]]
+			}
+			fmt.Fprintf(&result, "{%%%s %s%s %s%%}", leftTrim, INCLUDE_BLOCK_TAG, args, rightTrim)
+		}
+		last = match[1]
+	}
+	result.Write(source[last:])
+	return result.Bytes()
+}
@@ -0,0 +1,138 @@
+package markup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Render a LaTeX math fragment at build time, by piping it through the command configured
+// for its mode ("inline" or "display"), expected to output SVG, e.g. a wrapper around MathJax's tex2svg.
+// The output is cached in the jorge cache dir, since these tools are usually slow to start.
+// If the command is missing or fails, the fragment is left as is, to be rendered client-side.
+func renderMath(tex string, display bool, commands map[string]string, runner *CommandRunner) string {
+	mode, opening, closing := "inline", `\(`, `\)`
+	if display {
+		mode, opening, closing = "display", `\[`, `\]`
+	}
+
+	if command, ok := commands[mode]; ok {
+		svg, err := cachedMathCommand(runner, command, tex)
+		if err == nil {
+			return fmt.Sprintf(`<span class="math %s">%s</span>`, mode, svg)
+		}
+		fmt.Printf("error rendering math %q: %s\n", tex, err)
+	}
+	return fmt.Sprintf(`<span class="math %s">%s%s%s</span>`, mode, opening, html.EscapeString(tex), closing)
+}
+
+func cachedMathCommand(runner *CommandRunner, command string, tex string) (string, error) {
+	hash := sha256.Sum256([]byte(command + "\x00" + tex))
+	var cachePath string
+	if cacheDir, err := CacheDir(); err == nil {
+		cachePath = filepath.Join(cacheDir, "math", hex.EncodeToString(hash[:])+".svg")
+		if svg, err := os.ReadFile(cachePath); err == nil {
+			return string(svg), nil
+		}
+	}
+
+	svg, err := runner.Run(command, tex)
+	if err != nil {
+		return "", err
+	}
+	if cachePath != "" {
+		// the cache is just an optimization, ignore write errors
+		_ = WriteCacheFile(cachePath, []byte(svg))
+	}
+	return svg, nil
+}
+
+// A goldmark extension that parses $inline$ and $$display$$ math and renders it with renderMath.
+type mathExtension struct {
+	commands map[string]string
+	runner   *CommandRunner
+}
+
+var kindTex = ast.NewNodeKind("Tex")
+
+type texNode struct {
+	ast.BaseInline
+	tex     string
+	display bool
+}
+
+func (n *texNode) Kind() ast.NodeKind {
+	return kindTex
+}
+
+func (n *texNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Tex": n.tex}, nil)
+}
+
+func (e *mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(e, 150)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 150)))
+}
+
+func (e *mathExtension) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (e *mathExtension) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if bytes.HasPrefix(line, []byte("$$")) {
+		// display math can span multiple lines of the paragraph
+		startLine, startPosition := block.Position()
+		var tex []byte
+		rest, _ := block.PeekLine()
+		rest = rest[2:]
+		block.Advance(2)
+		for {
+			if end := bytes.Index(rest, []byte("$$")); end != -1 {
+				tex = append(tex, rest[:end]...)
+				block.Advance(end + 2)
+				return &texNode{tex: string(bytes.TrimSpace(tex)), display: true}
+			}
+			tex = append(tex, rest...)
+			block.AdvanceLine()
+			if rest, _ = block.PeekLine(); rest == nil {
+				// not closed, treat as text
+				block.SetPosition(startLine, startPosition)
+				return nil
+			}
+		}
+	}
+
+	// inline math can't start or end with a space, so amounts like $5 and $10 aren't matched
+	if len(line) < 3 || line[1] == ' ' {
+		return nil
+	}
+	for i := 2; i < len(line); i++ {
+		if line[i] == '$' && line[i-1] != ' ' && line[i-1] != '\\' && (i+1 == len(line) || line[i+1] < '0' || line[i+1] > '9') {
+			block.Advance(i + 1)
+			return &texNode{tex: string(line[1:i])}
+		}
+	}
+	return nil
+}
+
+func (e *mathExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindTex, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			n := node.(*texNode)
+			w.WriteString(renderMath(n.tex, n.display, e.commands, e.runner))
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
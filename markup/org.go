@@ -0,0 +1,286 @@
+package markup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/facundoolano/go-org/org"
+)
+
+// The org export settings that can be set from the site config or the template front matter,
+// e.g. `org: {toc: false, num: 2, top_level: 2}`, by their equivalent #+OPTIONS key.
+// Options not in this list are passed with their key as is.
+var ORG_OPTION_KEYS = map[string]string{
+	"toc":        "toc",
+	"num":        "num",
+	"todo":       "todo",
+	"tags":       "tags",
+	"priorities": "pri",
+	"drawers":    "d",
+	"footnotes":  "f",
+	"entities":   "e",
+	"timestamps": "<",
+	"title":      "title",
+}
+
+// Return the default #+OPTIONS for org documents, overridden with the given export settings.
+// The options set with #+OPTIONS in the documents themselves take precedence over these.
+func orgExportOptions(defaults string, settings map[string]interface{}) string {
+	// section numbering and drawers are handled by orgWriter, default to go-org's behavior
+	fields := strings.Fields(defaults + " num:nil d:t")
+	for key, value := range settings {
+		if key == "top_level" {
+			continue
+		}
+		if optionKey, ok := ORG_OPTION_KEYS[key]; ok {
+			key = optionKey
+		}
+
+		var option string
+		switch value := value.(type) {
+		case bool:
+			option = "nil"
+			if value {
+				option = "t"
+			}
+		default:
+			option = fmt.Sprint(value)
+		}
+
+		fields = append(fields, key+":"+option)
+	}
+
+	// keep the last value of each key, since go-org takes the first
+	seen := make(map[string]bool)
+	var options []string
+	for i := len(fields) - 1; i >= 0; i-- {
+		key, _, _ := strings.Cut(fields[i], ":")
+		if !seen[key] {
+			seen[key] = true
+			options = append([]string{fields[i]}, options...)
+		}
+	}
+	return strings.Join(options, " ")
+}
+
+// Return the html heading level for top level org headlines, 1 unless set with the
+// `top_level` export setting.
+func orgTopLevel(settings map[string]interface{}) int {
+	if level, ok := settings["top_level"].(int); ok && level > 0 {
+		return level
+	}
+	return 1
+}
+
+// An org html writer that extends the go-org one with build-time math rendering,
+// section numbering and drawer exclusion.
+type orgWriter struct {
+	*org.HTMLWriter
+	document     *org.Document
+	mathCommands map[string]string
+	runner       *CommandRunner
+	sections     []int
+	// the directory of the org file, and the attachment dirs of the headlines being written
+	dir string
+	// the document is a directory index, rendered at the same level as the files it links to
+	isIndex    bool
+	attachDirs []string
+	// where to collect the files referenced by attachment links, if not nil
+	attachments map[string]string
+	err         error
+}
+
+// Return the org-attach directory for the given properties, relative to the org file: its DIR property
+// or, if it has an ID, the data/ subdirectory org-attach derives from it. Otherwise return the inherited one.
+func orgAttachDir(properties *org.PropertyDrawer, inherited string) string {
+	if dir, ok := properties.Get("DIR"); ok {
+		return dir
+	}
+	if id, ok := properties.Get("ID"); ok {
+		if len(id) > 2 {
+			return filepath.Join("data", id[:2], id[2:])
+		}
+		return filepath.Join("data", id)
+	}
+	return inherited
+}
+
+// Return the org-attach directories of the given org template, from its document and headline properties,
+// so the files in them are published as attachments of the page instead of as static files.
+func OrgAttachmentDirs(templ *Template) ([]string, error) {
+	content, err := os.ReadFile(templ.SrcPath)
+	if err != nil {
+		return nil, err
+	}
+	_, body, err := SplitFrontMatter(content)
+	if err != nil {
+		return nil, err
+	}
+	doc := org.New().Silent().Parse(bytes.NewReader(body), templ.SrcPath)
+	w := &orgWriter{document: doc}
+	w.setDocumentAttachDir()
+
+	var dirs []string
+	var walk func(nodes []org.Node, inherited string)
+	walk = func(nodes []org.Node, inherited string) {
+		for _, node := range nodes {
+			if headline, ok := node.(org.Headline); ok {
+				dir := orgAttachDir(headline.Properties, inherited)
+				if dir != "" && dir != inherited {
+					dirs = append(dirs, dir)
+				}
+				walk(headline.Children, dir)
+			}
+		}
+	}
+	document := w.currentAttachDir()
+	if document != "" {
+		dirs = append(dirs, document)
+	}
+	walk(doc.Nodes, document)
+
+	for i, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			dirs[i] = filepath.Join(filepath.Dir(templ.SrcPath), dir)
+		}
+	}
+	return dirs, nil
+}
+
+// Set the document level attachment dir, from a property drawer at the top of the file.
+func (w *orgWriter) setDocumentAttachDir() {
+	for _, node := range w.document.Nodes {
+		if drawer, ok := node.(org.PropertyDrawer); ok {
+			w.attachDirs = []string{orgAttachDir(&drawer, "")}
+			return
+		} else if _, ok := node.(org.Headline); ok {
+			return
+		}
+	}
+}
+
+func (w *orgWriter) currentAttachDir() string {
+	if len(w.attachDirs) == 0 {
+		return ""
+	}
+	return w.attachDirs[len(w.attachDirs)-1]
+}
+
+// Rewrite attachment: links to point to a copy of the file next to the page, collecting it in attachments.
+func (w *orgWriter) WriteRegularLink(l org.RegularLink) {
+	if w.isIndex && (l.Protocol == "file" || l.Protocol == "") && !strings.HasPrefix(l.URL, "/") {
+		// pretty links are relative to the page directory, which for index files is the one of the org file
+		linkUrl := strings.TrimPrefix(l.URL, "file:")
+		if strings.HasSuffix(linkUrl, ".org") {
+			linkUrl = strings.TrimSuffix(linkUrl, ".org") + "/"
+		}
+		l.Protocol, l.URL = "", linkUrl
+		w.PrettyRelativeLinks = false
+		w.HTMLWriter.WriteRegularLink(l)
+		w.PrettyRelativeLinks = true
+		return
+	}
+	if l.Protocol != "attachment" {
+		w.HTMLWriter.WriteRegularLink(l)
+		return
+	}
+	name := strings.TrimPrefix(l.URL, "attachment:")
+	dir := w.currentAttachDir()
+	if dir == "" {
+		w.err = fmt.Errorf("attachment link %s outside of a heading with an ID or DIR property", name)
+		return
+	}
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		// the attachment is copied next to the page, so it can't point outside of the attach dir
+		w.err = fmt.Errorf("invalid attachment link %s, expected a path inside the attachment dir", name)
+		return
+	}
+	srcPath := filepath.Join(dir, name)
+	if !filepath.IsAbs(srcPath) {
+		srcPath = filepath.Join(w.dir, srcPath)
+	}
+	if _, err := os.Stat(srcPath); err != nil {
+		w.err = fmt.Errorf("broken attachment link %s: %w", name, err)
+		return
+	}
+	if w.attachments != nil {
+		w.attachments[filepath.ToSlash(name)] = srcPath
+	}
+
+	// the output page is the index.html of its own directory, where the attachment is copied to
+	l.Protocol = "file"
+	l.URL = "file:" + filepath.ToSlash(name)
+	w.PrettyRelativeLinks = false
+	w.HTMLWriter.WriteRegularLink(l)
+	w.PrettyRelativeLinks = true
+}
+
+func (w *orgWriter) WriteHeadline(h org.Headline) {
+	w.attachDirs = append(w.attachDirs, orgAttachDir(h.Properties, w.currentAttachDir()))
+	defer func() { w.attachDirs = w.attachDirs[:len(w.attachDirs)-1] }()
+
+	maxLevel := 0
+	switch num := w.document.GetOption("num"); num {
+	case "nil":
+	case "t":
+		maxLevel = h.Lvl
+	default:
+		maxLevel, _ = strconv.Atoi(num)
+	}
+	if h.Lvl > maxLevel || h.IsExcluded(w.document) {
+		w.HTMLWriter.WriteHeadline(h)
+		return
+	}
+
+	// update the section counters, e.g. 1.2.1 => 1.3 for a new level 2 headline
+	for len(w.sections) < h.Lvl {
+		w.sections = append(w.sections, 0)
+	}
+	w.sections = w.sections[:h.Lvl]
+	w.sections[h.Lvl-1]++
+	numbers := make([]string, len(w.sections))
+	for i, n := range w.sections {
+		numbers[i] = strconv.Itoa(n)
+	}
+
+	// render the headline separately to insert the number after the opening tag
+	original := w.Builder
+	w.Builder = strings.Builder{}
+	w.HTMLWriter.WriteHeadline(h)
+	headline := w.String()
+	w.Builder = original
+
+	opening, rest, _ := strings.Cut(headline, "\n")
+	w.WriteString(fmt.Sprintf("%s\n<span class=\"section-number\">%s</span>\n%s", opening, strings.Join(numbers, "."), rest))
+}
+
+func (w *orgWriter) WriteDrawer(d org.Drawer) {
+	if w.document.GetOption("d") != "nil" {
+		w.HTMLWriter.WriteDrawer(d)
+	}
+}
+
+func (w *orgWriter) WriteLatexFragment(l org.LatexFragment) {
+	if len(w.mathCommands) == 0 {
+		w.HTMLWriter.WriteLatexFragment(l)
+		return
+	}
+	tex := org.String(l.Content...)
+	display := l.OpeningPair == `\[` || l.OpeningPair == `$$`
+	if strings.HasPrefix(l.OpeningPair, `\begin`) {
+		tex, display = l.OpeningPair+tex+l.ClosingPair, true
+	}
+	w.WriteString(renderMath(strings.TrimSpace(tex), display, w.mathCommands, w.runner))
+}
+
+func (w *orgWriter) WriteLatexBlock(b org.LatexBlock) {
+	if len(w.mathCommands) == 0 {
+		w.HTMLWriter.WriteLatexBlock(b)
+		return
+	}
+	w.WriteString(renderMath(strings.TrimSpace(org.String(b.Content...)), true, w.mathCommands, w.runner) + "\n")
+}
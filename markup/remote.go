@@ -0,0 +1,208 @@
+package markup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/osteele/liquid"
+	"github.com/osteele/liquid/render"
+)
+
+const REMOTE_INCLUDE_TIMEOUT = 10 * time.Second
+
+// How long cached remote assets are used without checking for changes, so pages that reload often
+// don't hit the remote hosts on every request.
+const REMOTE_ASSET_MAX_AGE = 24 * time.Hour
+
+// Register the include_remote tag, which renders a snippet fetched from a url, eg:
+//
+//	{% include_remote "https://raw.githubusercontent.com/user/repo/main/footer.html" sha256=abc123... %}
+//
+// Snippets are cached on disk and revalidated with their ETag. When the server can't be reached,
+// the cached version is used. If a sha256 hash is given, the snippet contents must match it.
+func loadRemoteIncludeTag(e *liquid.Engine) {
+	e.RegisterTag("include_remote", func(rc render.Context) (string, error) {
+		argsline, err := rc.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		args := strings.Fields(argsline)
+		if len(args) == 0 || len(args) > 2 {
+			return "", fmt.Errorf("include_remote expects a url and an optional sha256=<hash>")
+		}
+		url := strings.Trim(args[0], `"'`)
+		var expectedHash string
+		if len(args) == 2 {
+			hash, found := strings.CutPrefix(args[1], "sha256=")
+			if !found {
+				return "", fmt.Errorf("unknown include_remote argument %s", args[1])
+			}
+			expectedHash = strings.ToLower(strings.Trim(hash, `"'`))
+		}
+
+		path, err := remoteFetcher.fetch(url, 0)
+		if err != nil {
+			return "", err
+		}
+		if err := checkRemoteHash(path, url, expectedHash); err != nil {
+			return "", err
+		}
+		return rc.RenderFile(path, map[string]interface{}{})
+	})
+}
+
+// Download the image, video or other media file at the given url to the cache dir, unless there's
+// a recent cached copy, and return the path of the cached file and its content type.
+func FetchRemoteAsset(url string) (string, string, error) {
+	path, err := remoteFetcher.fetch(url, REMOTE_ASSET_MAX_AGE)
+	if err != nil {
+		return "", "", err
+	}
+	contentType, err := os.ReadFile(path + ".type")
+	if err != nil || len(contentType) == 0 {
+		return path, "application/octet-stream", nil
+	}
+	return path, string(contentType), nil
+}
+
+// Remote files are requested concurrently by the dev server and by the pages rendered in parallel,
+// so the downloads of the same url are shared while in progress.
+var remoteFetcher = &fetcher{fetches: make(map[string]*remoteFetch)}
+
+// Deduplicates the downloads of remote urls requested concurrently.
+type fetcher struct {
+	mutex   sync.Mutex
+	fetches map[string]*remoteFetch
+}
+
+type remoteFetch struct {
+	done chan struct{}
+	path string
+	err  error
+}
+
+// Return the path of the cached contents of the url, downloading them if necessary, or waiting
+// for the download in progress if the url was already requested.
+func (fetcher *fetcher) fetch(url string, maxAge time.Duration) (string, error) {
+	fetcher.mutex.Lock()
+	fetch, found := fetcher.fetches[url]
+	if found {
+		fetcher.mutex.Unlock()
+		<-fetch.done
+		return fetch.path, fetch.err
+	}
+	fetch = &remoteFetch{done: make(chan struct{})}
+	fetcher.fetches[url] = fetch
+	fetcher.mutex.Unlock()
+
+	fetch.path, fetch.err = downloadRemote(url, maxAge)
+	fetcher.mutex.Lock()
+	delete(fetcher.fetches, url)
+	fetcher.mutex.Unlock()
+	close(fetch.done)
+	return fetch.path, fetch.err
+}
+
+// Download the contents of the url to the cache dir, unless the cached copy is still valid,
+// and return the path of the cached file. Cached copies younger than maxAge are used without
+// checking with the server.
+func downloadRemote(url string, maxAge time.Duration) (string, error) {
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	key := sha256.Sum256([]byte(url))
+	cachePath := filepath.Join(cacheDir, "remote", hex.EncodeToString(key[:]))
+	etagPath := cachePath + ".etag"
+
+	info, statErr := os.Stat(cachePath)
+	cached := statErr == nil
+	if cached && time.Since(info.ModTime()) < maxAge {
+		return cachePath, nil
+	}
+
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	if etag, err := os.ReadFile(etagPath); err == nil && cached {
+		request.Header.Set("If-None-Match", string(etag))
+	}
+
+	client := http.Client{Timeout: REMOTE_INCLUDE_TIMEOUT}
+	response, err := client.Do(request)
+	if err != nil {
+		if cached {
+			fmt.Printf("couldn't fetch %s, using cached version: %s\n", url, err)
+			return cachePath, nil
+		}
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && cached {
+		// restart the max age of the cached copy
+		now := time.Now()
+		os.Chtimes(cachePath, now, now)
+		return cachePath, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't fetch %s: %s", url, response.Status)
+	}
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	contentType := response.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	// the metadata files are written first, so they are never older than the contents
+	if err := WriteCacheFile(cachePath+".type", []byte(contentType)); err != nil {
+		return "", err
+	}
+	if etag := response.Header.Get("ETag"); etag != "" {
+		err = WriteCacheFile(etagPath, []byte(etag))
+	} else {
+		err = os.Remove(etagPath)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := WriteCacheFile(cachePath, content); err != nil {
+		return "", err
+	}
+	return cachePath, nil
+}
+
+func checkRemoteHash(path string, url string, expectedHash string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return verifyHash(content, url, expectedHash)
+}
+
+func verifyHash(content []byte, url string, expectedHash string) error {
+	if expectedHash == "" {
+		return nil
+	}
+	hash := sha256.Sum256(content)
+	if actual := hex.EncodeToString(hash[:]); actual != expectedHash {
+		return fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", url, expectedHash, actual)
+	}
+	return nil
+}
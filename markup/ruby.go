@@ -0,0 +1,144 @@
+package markup
+
+import (
+	"bytes"
+	std_html "html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Matches ruby annotations like {漢字|かんじ}, or {漢字|かん|じ} to annotate each character separately.
+var rubyPattern = regexp.MustCompile(`\{([^{}|\n]+)((?:\|[^{}|\n]+)+)\}`)
+
+// Return the ruby markup for the given base text and readings. If there's a reading for each
+// of the base characters, they are annotated separately, otherwise the reading applies to the whole text.
+func rubyHTML(base string, readings []string) string {
+	chars := []rune(base)
+	var buf strings.Builder
+	buf.WriteString("<ruby>")
+	if len(readings) > 1 && len(readings) == len(chars) {
+		for i, char := range chars {
+			buf.WriteString(std_html.EscapeString(string(char)) + rubyText(readings[i]))
+		}
+	} else {
+		buf.WriteString(std_html.EscapeString(base) + rubyText(strings.Join(readings, "")))
+	}
+	buf.WriteString("</ruby>")
+	return buf.String()
+}
+
+func rubyText(reading string) string {
+	return "<rp>(</rp><rt>" + std_html.EscapeString(reading) + "</rt><rp>)</rp>"
+}
+
+// Replace the ruby annotations found in the text of the given html fragment, outside of code blocks.
+func addRubyAnnotations(content []byte) ([]byte, error) {
+	if !rubyPattern.Match(content) {
+		return content, nil
+	}
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(content), body)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		replaceRubyText(node)
+		if err := html.Render(&buf, node); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func replaceRubyText(node *html.Node) {
+	if node.Type == html.ElementNode && (node.Data == "pre" || node.Data == "code" || node.Data == "script" || node.Data == "style") {
+		return
+	}
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.TextNode && rubyPattern.MatchString(child.Data) {
+			escaped := std_html.EscapeString(child.Data)
+			replaced := rubyPattern.ReplaceAllStringFunc(escaped, func(match string) string {
+				groups := rubyPattern.FindStringSubmatch(match)
+				base, readings := std_html.UnescapeString(groups[1]), strings.Split(groups[2][1:], "|")
+				for i := range readings {
+					readings[i] = std_html.UnescapeString(readings[i])
+				}
+				return rubyHTML(base, readings)
+			})
+			fragment, err := html.ParseFragment(strings.NewReader(replaced), node)
+			if err == nil {
+				for _, replacement := range fragment {
+					node.InsertBefore(replacement, child)
+				}
+				node.RemoveChild(child)
+			}
+		} else {
+			replaceRubyText(child)
+		}
+		child = next
+	}
+}
+
+// A goldmark extension that renders ruby annotations, e.g. {漢字|かんじ}.
+type rubyExtension struct{}
+
+var kindRuby = ast.NewNodeKind("Ruby")
+
+type rubyNode struct {
+	ast.BaseInline
+	base     string
+	readings []string
+}
+
+func (n *rubyNode) Kind() ast.NodeKind {
+	return kindRuby
+}
+
+func (n *rubyNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Base": n.base}, nil)
+}
+
+func (e *rubyExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(e, 500)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 500)))
+}
+
+func (e *rubyExtension) Trigger() []byte {
+	return []byte{'{'}
+}
+
+func (e *rubyExtension) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	match := rubyPattern.FindSubmatchIndex(line)
+	if match == nil || match[0] != 0 {
+		return nil
+	}
+	block.Advance(match[1])
+	return &rubyNode{
+		base:     string(line[match[2]:match[3]]),
+		readings: strings.Split(string(line[match[4]+1:match[5]]), "|"),
+	}
+}
+
+func (e *rubyExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindRuby, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			n := node.(*rubyNode)
+			w.WriteString(rubyHTML(n.base, n.readings))
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
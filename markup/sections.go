@@ -0,0 +1,206 @@
+package markup
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/osteele/liquid"
+	"github.com/osteele/liquid/render"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var nonSlugChars = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// Matches the markers output by the section tag, along with the paragraph tags
+// they get wrapped in when converting org and markdown.
+var sectionMarker = regexp.MustCompile(`(?:<p>\s*)?JORGESECTION(START|END)([\w-]+)NOITCESEGROJ(?:\s*</p>)?`)
+
+var sectionName = regexp.MustCompile(`^[\w-]+$`)
+
+// Register the section block tag, which names a part of the page content so it's available
+// as `page.sections.<name>` in its layouts, e.g. to place it in a different region of the design:
+//
+//	{% section hero %}
+//	# Welcome
+//	{% endsection %}
+//
+// The content is still output in place.
+func loadSectionTag(e *liquid.Engine) {
+	e.RegisterBlock("section", func(rc render.Context) (string, error) {
+		name := strings.Trim(strings.TrimSpace(rc.TagArgs()), `"'`)
+		if !sectionName.MatchString(name) {
+			return "", fmt.Errorf("invalid section name %q", name)
+		}
+		content, err := rc.InnerString()
+		if err != nil {
+			return "", err
+		}
+		// the markers are surrounded by blank lines so they aren't merged with the content paragraphs
+		return fmt.Sprintf("\n\nJORGESECTIONSTART%sNOITCESEGROJ\n\n%s\n\nJORGESECTIONEND%sNOITCESEGROJ\n\n", name, content, name), nil
+	})
+}
+
+// The named sections of some html content, see extractSections.
+// The sections split by headings are only extracted when looked up, since that requires parsing the html,
+// so pages that don't use them don't pay for it.
+type Sections struct {
+	content  []byte
+	headings bool
+	// the sections of the section tag, found when extracting the sections
+	tagged map[string]interface{}
+
+	once sync.Once
+	all  map[string]interface{}
+}
+
+// Return the html of the section with the given name, if found.
+func (sections *Sections) Get(name string) (string, bool) {
+	if sections == nil {
+		return "", false
+	}
+	if section, found := sections.tagged[name]; found {
+		return section.(string), true
+	}
+	if !sections.headings {
+		return "", false
+	}
+	section, err := ExtractSection(sections.content, name)
+	if err != nil {
+		return "", false
+	}
+	return string(section), true
+}
+
+// Return all the sections by name, to expose them to templates as page.sections.
+// Liquid only calls this when page.sections is accessed.
+func (sections *Sections) ToLiquid() interface{} {
+	sections.once.Do(func() {
+		sections.all = make(map[string]interface{})
+		if sections.headings {
+			if all, err := headingSections(sections.content); err == nil {
+				sections.all = all
+			}
+		}
+		maps.Copy(sections.all, sections.tagged)
+	})
+	return sections.all
+}
+
+// Remove the section tag markers from the given html content and return it along with its named sections,
+// or nil if it has none. When headings is true, the content following each heading, up to the next
+// one of the same or higher level, is also considered a section, named after the heading id or,
+// if it doesn't have one, the slug of its text, e.g. "about-me" for <h2>About me</h2>.
+func extractSections(content []byte, headings bool) ([]byte, *Sections) {
+	markers := sectionMarker.FindAllSubmatchIndex(content, -1)
+	if len(markers) == 0 && !headings {
+		return content, nil
+	}
+	stripped := sectionMarker.ReplaceAll(content, nil)
+	sections := &Sections{content: stripped, headings: headings, tagged: make(map[string]interface{})}
+
+	for i, start := range markers {
+		if string(content[start[2]:start[3]]) != "START" {
+			continue
+		}
+		name := string(content[start[4]:start[5]])
+		for _, end := range markers[i+1:] {
+			if string(content[end[2]:end[3]]) == "END" && string(content[end[4]:end[5]]) == name {
+				section := sectionMarker.ReplaceAll(content[start[1]:end[0]], nil)
+				sections.tagged[name] = string(bytes.TrimSpace(section))
+				break
+			}
+		}
+	}
+	return stripped, sections
+}
+
+// Return the html of the content following the heading with the given name, up to the next heading of
+// the same or higher level, excluding the heading itself. See extractSections for how headings are named.
+func ExtractSection(content []byte, name string) ([]byte, error) {
+	sections, err := headingSections(content)
+	if err != nil {
+		return nil, err
+	}
+	section, found := sections[name]
+	if !found {
+		return nil, fmt.Errorf("section %s not found", name)
+	}
+	return []byte(section.(string)), nil
+}
+
+// Return the html of the content following each heading of the given html fragment,
+// excluding the heading itself, by the heading name.
+func headingSections(content []byte) (map[string]interface{}, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(content), body)
+	if err != nil {
+		return nil, err
+	}
+
+	type openSection struct {
+		name  string
+		level int
+		html  bytes.Buffer
+	}
+	var open []*openSection
+	sections := make(map[string]interface{})
+	closeSection := func(section *openSection) {
+		if _, found := sections[section.name]; !found {
+			sections[section.name] = string(bytes.TrimSpace(section.html.Bytes()))
+		}
+	}
+
+	for _, node := range nodes {
+		level := headingLevel(node)
+		if level > 0 {
+			// a heading closes the sections of deeper or equal level
+			for len(open) > 0 && open[len(open)-1].level >= level {
+				closeSection(open[len(open)-1])
+				open = open[:len(open)-1]
+			}
+		}
+
+		// the node is part of all the enclosing sections, including subheadings
+		var buf bytes.Buffer
+		if err := html.Render(&buf, node); err != nil {
+			return nil, err
+		}
+		for _, section := range open {
+			section.html.Write(buf.Bytes())
+		}
+
+		if level > 0 {
+			open = append(open, &openSection{name: headingName(node), level: level})
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		closeSection(open[i])
+	}
+	return sections, nil
+}
+
+// Return the level of the given node if it's an h1-h6 heading, or 0 otherwise.
+func headingLevel(node *html.Node) int {
+	if node.Type != html.ElementNode || len(node.Data) != 2 || node.Data[0] != 'h' || node.Data[1] < '1' || node.Data[1] > '6' {
+		return 0
+	}
+	return int(node.Data[1] - '0')
+}
+
+// Return the id of the heading node or the slug of its text.
+func headingName(node *html.Node) string {
+	if id := GetAttribute(node, "id"); id != "" {
+		return id
+	}
+	return slugify(getTextContent(node))
+}
+
+// Return a lowercase version of the given text with words separated by dashes, suitable for urls and ids.
+func slugify(text string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(text), "-"), "-")
+}
@@ -0,0 +1,66 @@
+package markup
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHeadingSections(t *testing.T) {
+	input := `<h1>Intro</h1>
+<p>hello</p>
+<h2 id="the-sub">Sub section</h2>
+<p>sub text</p>
+<h3>Deeper</h3>
+<p>deeper text</p>
+<h2>About me</h2>
+<p>bio</p>`
+
+	_, sections := extractSections([]byte(input), true)
+	// the headings aren't parsed until the sections are accessed
+	assert(t, sections.all == nil)
+	section, found := sections.Get("about-me")
+	assert(t, found)
+	assertEqual(t, section, "<p>bio</p>")
+	_, found = sections.Get("missing")
+	assert(t, !found)
+
+	all := sections.ToLiquid().(map[string]interface{})
+	assertEqual(t, all["the-sub"], "<p>sub text</p>\n<h3>Deeper</h3>\n<p>deeper text</p>")
+	assertEqual(t, all["deeper"], "<p>deeper text</p>")
+	assertEqual(t, all["about-me"], "<p>bio</p>")
+	assert(t, strings.HasSuffix(all["intro"].(string), "<p>bio</p>"))
+
+	// html pages aren't split by headings
+	_, sections = extractSections([]byte(input), false)
+	assert(t, sections == nil)
+	_, found = sections.Get("about-me")
+	assert(t, !found)
+}
+
+func TestSectionTag(t *testing.T) {
+	input := `---
+title: sections
+---
+# Title
+
+{% section hero %}
+Welcome to **my site**
+{% endsection %}
+
+Rest of the page
+`
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+
+	content, sections, err := templ.RenderSections(map[string]interface{}{}, RenderOptions{HighlightTheme: NO_SYNTAX_HIGHLIGHTING})
+	assertEqual(t, err, nil)
+	hero, _ := sections.Get("hero")
+	assertEqual(t, hero, "<p>Welcome to <strong>my site</strong></p>")
+	assert(t, !strings.Contains(string(content), "JORGESECTION"))
+	assert(t, strings.Contains(string(content), "<p>Welcome to <strong>my site</strong></p>"))
+	assert(t, strings.Contains(string(content), "<p>Rest of the page</p>"))
+}
@@ -0,0 +1,124 @@
+package markup
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/osteele/liquid/render"
+)
+
+// The context key where the html output of shortcodes is collected while rendering org and markdown
+// templates, so it can be inserted after the conversion to html, which would otherwise escape or drop it.
+const SHORTCODES_KEY = "__shortcodes"
+
+type shortcodeOutputs struct {
+	html []string
+}
+
+func shortcodePlaceholder(i int) string {
+	return fmt.Sprintf("JORGESHORTCODE%dEDOCTROHSEGROJ", i)
+}
+
+// Register the shortcode tag, which renders the html snippet at `<dir>/<name>.html`
+// passing the given parameters as the `shortcode` variable, eg:
+//
+//	{% shortcode youtube id="dQw4w9WgXcQ" start=30 title=page.title %}
+//
+// Quoted parameter values are taken literally, the rest are evaluated as liquid expressions.
+// Shortcodes can be used in html templates as well as in org and markdown content.
+func LoadShortcodes(e *Engine, dir string) {
+	e.RegisterTag("shortcode", func(rc render.Context) (string, error) {
+		name, params, err := ParseTagArgs(rc)
+		if err != nil {
+			return "", err
+		} else if name == "" {
+			return "", fmt.Errorf("shortcode tag expects a shortcode name")
+		}
+
+		html, err := rc.RenderFile(filepath.Join(dir, name+".html"), map[string]interface{}{"shortcode": params})
+		if err != nil {
+			return "", fmt.Errorf("error rendering shortcode %s: %w", name, err)
+		}
+
+		return RawOutput(rc, html), nil
+	})
+}
+
+// Return the given html tag output so it's kept as is in the rendered page. In org and markdown
+// templates, a placeholder is returned instead, to be replaced with the html after the conversion.
+func RawOutput(rc render.Context, html string) string {
+	if outputs, ok := rc.Get(SHORTCODES_KEY).(*shortcodeOutputs); ok {
+		outputs.html = append(outputs.html, strings.TrimSpace(html))
+		return shortcodePlaceholder(len(outputs.html) - 1)
+	}
+	return html
+}
+
+// Return the leading argument of the current tag, e.g. a file name, and its key=value parameters
+// (see evaluateTagParams). The leading argument is empty if the tag has no arguments.
+func ParseTagArgs(rc render.Context) (string, map[string]interface{}, error) {
+	argsline, err := rc.ExpandTagArg()
+	if err != nil {
+		return "", nil, err
+	}
+	args := splitAttributes(argsline)
+	if len(args) == 0 {
+		return "", nil, nil
+	}
+
+	name := strings.Trim(args[0], `"'`)
+	params, err := evaluateTagParams(rc, args[1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid arguments to %s %s: %w", rc.TagName(), name, err)
+	}
+	return name, params, nil
+}
+
+// Parse the given key=value tag arguments. Quoted values are taken literally,
+// the rest are evaluated as liquid expressions.
+func evaluateTagParams(rc render.Context, args []string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			return nil, fmt.Errorf("expected key=value, got %s", arg)
+		}
+		if unquoted := strings.Trim(value, `"'`); unquoted != value {
+			params[key] = unquoted
+			continue
+		}
+		evaluated, err := rc.EvaluateString(value)
+		if err != nil {
+			return nil, err
+		}
+		params[key] = evaluated
+	}
+	return params, nil
+}
+
+// Return a copy of the context prepared to collect shortcode outputs, to be inserted in the
+// converted html with insertShortcodes.
+func withShortcodeOutputs(context map[string]interface{}) (map[string]interface{}, *shortcodeOutputs) {
+	outputs := &shortcodeOutputs{}
+	context = maps.Clone(context)
+	context[SHORTCODES_KEY] = outputs
+	return context, outputs
+}
+
+// Replace the shortcode placeholders in the converted html with their output.
+// Placeholders that take a whole paragraph replace it entirely.
+func insertShortcodes(content []byte, outputs *shortcodeOutputs) []byte {
+	// shortcodes used inside other shortcodes are collected before the outer one,
+	// so going backwards the nested placeholders are replaced after their parent output is inserted
+	for i := len(outputs.html) - 1; i >= 0; i-- {
+		placeholder := shortcodePlaceholder(i)
+		paragraph := regexp.MustCompile(`<p>\s*` + placeholder + `\s*</p>`)
+		html := []byte(outputs.html[i])
+		content = paragraph.ReplaceAllLiteral(content, html)
+		content = []byte(strings.ReplaceAll(string(content), placeholder, string(html)))
+	}
+	return content
+}
@@ -1,10 +1,11 @@
 package markup
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
+	std_html "html"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,8 +27,39 @@ const FM_SEPARATOR = "---"
 const NO_SYNTAX_HIGHLIGHTING = ""
 const CODE_TABWIDTH = 4
 
+// Returned by SplitFrontMatter for files that don't start with a front matter delimiter.
+var ErrNotTemplate = errors.New("not a template")
+
 type Engine = liquid.Engine
 
+// Settings that affect how org and markdown sources are converted to html.
+type RenderOptions struct {
+	HighlightTheme string
+	// emit css classes instead of inline styles in highlighted code, see WriteHighlightCSS
+	HighlightClasses bool
+	// commands used to render diagram code blocks at build time, by diagram language
+	DiagramCommands map[string]string
+	// commands used to render latex math to svg at build time, by mode: inline or display
+	MathCommands map[string]string
+	// runs the diagram and math commands, with the defaults if nil
+	Commands *CommandRunner
+	// org export settings, e.g. toc, num or top_level, see ORG_OPTION_KEYS
+	OrgOptions map[string]interface{}
+	// convert straight quotes, dashes and ellipses to their typographic equivalents
+	Typographer bool
+	// the language of the content. For right to left languages, the converted html is
+	// wrapped in an element with `lang` and `dir="rtl"` attributes
+	Lang string
+	// render ruby annotations like {漢字|かんじ}
+	Ruby bool
+	// if not nil, the files referenced by org attachment: links are added here, by link path,
+	// for them to be copied next to the page output
+	Attachments map[string]string
+	// if not nil, called with the path of the files read while rendering, like org includes
+	// and code tag files, so the caller can track what the output depends on
+	OnFileRead func(path string)
+}
+
 type Template struct {
 	SrcPath        string
 	Metadata       map[string]interface{}
@@ -39,6 +71,11 @@ type Template struct {
 func NewEngine(siteUrl string, includesDir string) *Engine {
 	e := liquid.NewEngine()
 	loadJekyllFilters(e, siteUrl, includesDir)
+	loadInheritanceTags(e)
+	loadSectionTag(e)
+	// the includes directory is at the project root
+	loadCodeTag(e, filepath.Dir(includesDir))
+	loadRemoteIncludeTag(e)
 	return e
 }
 
@@ -53,42 +90,20 @@ func EvalExpression(engine *Engine, expression string, context map[string]interf
 // return (nil, nil).
 // The front matter contents are stored in the returned template's Metadata.
 func Parse(engine *Engine, path string) (*Template, error) {
-	file, err := os.Open(path)
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-
-	scanner.Scan()
-	line := scanner.Text()
-
-	// if the file doesn't start with a front matter delimiter, it's not a template
-	if strings.TrimSpace(line) != FM_SEPARATOR {
-		return nil, nil
-	}
 
 	// extract the yaml front matter and save the rest of the template content separately
-	var yamlContent []byte
-	var liquidContent []byte
-	yamlClosed := false
-	for scanner.Scan() {
-		line := append(scanner.Bytes(), '\n')
-		if yamlClosed {
-			liquidContent = append(liquidContent, line...)
-		} else {
-			if strings.TrimSpace(scanner.Text()) == FM_SEPARATOR {
-				yamlClosed = true
-				continue
-			}
-			yamlContent = append(yamlContent, line...)
-		}
-	}
-	liquidContent = bytes.TrimSuffix(liquidContent, []byte("\n"))
-
-	if !yamlClosed {
-		return nil, errors.New("front matter not closed")
+	yamlContent, liquidContent, err := SplitFrontMatter(content)
+	if err == ErrNotTemplate {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
+	// the line where the liquid content starts, so errors report the position in the source file
+	contentLine := bytes.Count(yamlContent, []byte("\n")) + 3
 
 	metadata := make(map[string]interface{})
 	if len(yamlContent) != 0 {
@@ -98,20 +113,58 @@ func Parse(engine *Engine, path string) (*Template, error) {
 		}
 	}
 
-	liquid, err := engine.ParseTemplateAndCache(liquidContent, path, 0)
+	if escape, _ := metadata["auto_escape"].(bool); escape {
+		liquidContent = autoEscape(liquidContent, filepath.Ext(path))
+	}
+
+	liquidContent = expandIncludeBlocks(liquidContent)
+	liquid, err := engine.ParseTemplateAndCache(liquidContent, path, contentLine)
 	if err != nil {
-		return nil, err
+		return nil, wrapTemplateError(err, path)
 	}
 
 	templ := Template{SrcPath: path, Metadata: metadata, liquidTemplate: *liquid}
 	return &templ, nil
 }
 
+// Split the content of a template file in its yaml front matter and the rest of the template,
+// both without the delimiter lines. Returns ErrNotTemplate if the first line isn't a front matter delimiter.
+// Line endings are normalized to \n.
+func SplitFrontMatter(content []byte) ([]byte, []byte, error) {
+	lines := bytes.Split(content, []byte("\n"))
+	if len(lines) > 1 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		lines[i] = bytes.TrimSuffix(line, []byte("\r"))
+	}
+	if strings.TrimSpace(string(lines[0])) != FM_SEPARATOR {
+		return nil, nil, ErrNotTemplate
+	}
+
+	for i, line := range lines[1:] {
+		if strings.TrimSpace(string(line)) == FM_SEPARATOR {
+			var frontMatter []byte
+			for _, line := range lines[1 : i+1] {
+				frontMatter = append(append(frontMatter, line...), '\n')
+			}
+			return frontMatter, bytes.Join(lines[i+2:], []byte("\n")), nil
+		}
+	}
+	return nil, nil, errors.New("front matter not closed")
+}
+
 // Return the extension of this template's source file.
 func (templ Template) SrcExt() string {
 	return filepath.Ext(templ.SrcPath)
 }
 
+// Return the base name of this template's source file, without extension.
+func (templ Template) Name() string {
+	filename := filepath.Base(templ.SrcPath)
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
 // Return the extension for the output format of this template
 func (templ Template) TargetExt() string {
 	ext := filepath.Ext(templ.SrcPath)
@@ -138,65 +191,141 @@ func (templ Template) Render() ([]byte, error) {
 	ctx := map[string]interface{}{
 		"page": templ.Metadata,
 	}
-	return templ.RenderWith(ctx, NO_SYNTAX_HIGHLIGHTING)
+	return templ.RenderWith(ctx, RenderOptions{HighlightTheme: NO_SYNTAX_HIGHLIGHTING})
 }
 
 // Renders the liquid template with the given context as bindings.
 // If the template source is org or md, convert them to html after the
 // liquid rendering.
-func (templ Template) RenderWith(context map[string]interface{}, hlTheme string) ([]byte, error) {
+func (templ Template) RenderWith(context map[string]interface{}, options RenderOptions) ([]byte, error) {
+	content, _, err := templ.RenderSections(context, options)
+	return content, err
+}
+
+// Like RenderWith, but also return the named sections of the content, if any (see extractSections).
+// Org and markdown content is also split in sections by its headings.
+func (templ Template) RenderSections(context map[string]interface{}, options RenderOptions) ([]byte, *Sections, error) {
+	isMarkup := templ.SrcExt() == ".org" || templ.SrcExt() == ".md"
+	var shortcodes *shortcodeOutputs
+	if isMarkup {
+		context, shortcodes = withShortcodeOutputs(context)
+	}
+	if options.OnFileRead != nil {
+		context = maps.Clone(context)
+		context[FILE_READ_KEY] = options.OnFileRead
+	}
+
 	// liquid rendering
-	content, err := templ.liquidTemplate.Render(context)
-	if err != nil {
-		return nil, err
+	content, renderErr := templ.liquidTemplate.Render(context)
+	if renderErr != nil {
+		return nil, nil, wrapTemplateError(renderErr, templ.SrcPath)
 	}
 
 	if templ.SrcExt() == ".org" {
 		// org-mode rendering
-		doc := org.New().Parse(bytes.NewReader(content), templ.SrcPath)
+		expanded, err := expandOrgIncludes(content, filepath.Dir(templ.SrcPath), 0, options.OnFileRead)
+		if err != nil {
+			return nil, nil, err
+		}
+		orgConfig := org.New()
+		orgConfig.DefaultSettings["OPTIONS"] = orgExportOptions(orgConfig.DefaultSettings["OPTIONS"], options.OrgOptions)
+		doc := orgConfig.Parse(bytes.NewReader(expanded), templ.SrcPath)
 		htmlWriter := org.NewHTMLWriter()
 
-		// make * -> h1, ** -> h2, etc
-		htmlWriter.TopLevelHLevel = 1
+		// make * -> h1, ** -> h2, etc, unless configured otherwise
+		htmlWriter.TopLevelHLevel = orgTopLevel(options.OrgOptions)
 		// handle relative paths in links
 		htmlWriter.PrettyRelativeLinks = true
-		if hlTheme != NO_SYNTAX_HIGHLIGHTING {
-			htmlWriter.HighlightCodeBlock = highlightCodeBlock(hlTheme)
-		}
+		htmlWriter.HighlightCodeBlock = highlightCodeBlock(options, htmlWriter.HighlightCodeBlock)
+		writer := &orgWriter{HTMLWriter: htmlWriter, document: doc, mathCommands: options.MathCommands, runner: options.Commands,
+			dir: filepath.Dir(templ.SrcPath), isIndex: filepath.Base(templ.SrcPath) == "index.org", attachments: options.Attachments}
+		writer.setDocumentAttachDir()
+		htmlWriter.ExtendingWriter = writer
 
 		contentStr, err := doc.Write(htmlWriter)
+		if err == nil {
+			err = writer.err
+		}
 		if err != nil {
-			return nil, err
+			return nil, nil, wrapTemplateError(err, templ.SrcPath)
 		}
 		content = []byte(contentStr)
+		if options.Ruby {
+			if content, err = addRubyAnnotations(content); err != nil {
+				return nil, nil, err
+			}
+		}
 	} else if templ.SrcExt() == ".md" {
 		// markdown rendering
 		var buf bytes.Buffer
 
-		options := make([]goldmark.Option, 0)
-		if hlTheme != NO_SYNTAX_HIGHLIGHTING {
+		mdOptions := []goldmark.Option{
+			goldmark.WithExtensions(&diagramExtension{commands: options.DiagramCommands, runner: options.Commands}, &codeBlockAttributes{}),
+		}
+		if options.Typographer {
+			mdOptions = append(mdOptions, goldmark.WithExtensions(extension.Typographer))
+		}
+		if options.Ruby {
+			mdOptions = append(mdOptions, goldmark.WithExtensions(&rubyExtension{}))
+		}
+		if len(options.MathCommands) > 0 {
+			mdOptions = append(mdOptions, goldmark.WithExtensions(&mathExtension{commands: options.MathCommands, runner: options.Commands}))
+		}
+		if options.HighlightTheme != NO_SYNTAX_HIGHLIGHTING {
 
-			options = append(options, goldmark.WithExtensions(
+			mdOptions = append(mdOptions, goldmark.WithExtensions(
 				extension.GFM,
-				extension.Footnote,
+				footnoteExtension(options.Lang),
 				gm_highlight.NewHighlighting(
-					gm_highlight.WithStyle(hlTheme),
-					gm_highlight.WithFormatOptions(html.TabWidth(CODE_TABWIDTH)),
+					gm_highlight.WithStyle(options.HighlightTheme),
+					gm_highlight.WithFormatOptions(html.TabWidth(CODE_TABWIDTH), html.WithClasses(options.HighlightClasses)),
+					gm_highlight.WithWrapperRenderer(codeBlockWrapper),
 				)))
 		}
-		md := goldmark.New(options...)
+		md := goldmark.New(mdOptions...)
 		if err := md.Convert(content, &buf); err != nil {
-			return nil, err
+			return nil, nil, wrapTemplateError(err, templ.SrcPath)
 		}
 		content = buf.Bytes()
 	}
 
-	return content, nil
+	if isMarkup {
+		content = insertShortcodes(content, shortcodes)
+	}
+
+	content, sections := extractSections(content, isMarkup)
+
+	if isMarkup && TextDirection(options.Lang) == "rtl" {
+		// table of contents and footnotes are included in the content, so they inherit its direction
+		opening := fmt.Sprintf(`<div lang="%s" dir="rtl">`, std_html.EscapeString(options.Lang))
+		content = append(append([]byte(opening+"\n"), content...), []byte("\n</div>")...)
+	}
+
+	return content, sections, nil
+}
+
+// Return the footnote extension, using a backlink arrow that points in the reading direction of the language.
+func footnoteExtension(lang string) goldmark.Extender {
+	if TextDirection(lang) == "rtl" {
+		return extension.NewFootnote(extension.WithFootnoteBacklinkHTML("&#x21aa;&#xfe0e;"))
+	}
+	return extension.Footnote
 }
 
-func highlightCodeBlock(hlTheme string) func(source string, lang string, inline bool, params map[string]string) string {
+type codeBlockFunc = func(source string, lang string, inline bool, params map[string]string) string
+
+// Return a function to render org source blocks. Diagram blocks are handled separately,
+// the rest are syntax highlighted if a theme is set, otherwise passed to the `fallback` function.
+func highlightCodeBlock(options RenderOptions, fallback codeBlockFunc) codeBlockFunc {
 	// from https://github.com/niklasfasching/go-org/blob/a32df1461eb34a451b1e0dab71bd9b2558ea5dc4/blorg/util.go#L58
-	return func(source, lang string, inline bool, params map[string]string) string {
+	highlight := func(source, lang string, inline bool, params map[string]string) string {
+		if !inline && isDiagram(lang) {
+			return renderDiagram(source, lang, options.DiagramCommands, options.Commands)
+		}
+		if options.HighlightTheme == NO_SYNTAX_HIGHLIGHTING {
+			return fallback(source, lang, inline, params)
+		}
+
 		var w strings.Builder
 		l := lexers.Get(lang)
 		if l == nil {
@@ -204,19 +333,35 @@ func highlightCodeBlock(hlTheme string) func(source string, lang string, inline
 		}
 		l = chroma.Coalesce(l)
 		it, _ := l.Tokenise(nil, source)
-		options := []html.Option{
+		formatOptions := []html.Option{
 			html.TabWidth(CODE_TABWIDTH),
+			html.WithClasses(options.HighlightClasses),
 		}
 		if params[":hl_lines"] != "" {
 			ranges := org.ParseRanges(params[":hl_lines"])
 			if ranges != nil {
-				options = append(options, html.HighlightLines(ranges))
+				formatOptions = append(formatOptions, html.HighlightLines(ranges))
+			}
+		}
+		if linenos := params[":linenos"]; linenos != "" && linenos != "nil" {
+			formatOptions = append(formatOptions, html.WithLineNumbers(true))
+			if linenos == "table" {
+				formatOptions = append(formatOptions, html.LineNumbersInTable(true))
 			}
 		}
-		_ = html.New(options...).Format(&w, styles.Get(hlTheme), it)
+		_ = html.New(formatOptions...).Format(&w, styles.Get(options.HighlightTheme), it)
 		if inline {
 			return `<div class="highlight-inline">` + "\n" + w.String() + "\n" + `</div>`
 		}
 		return `<div class="highlight">` + "\n" + w.String() + "\n" + `</div>`
 	}
+
+	// blocks with a :title parameter are wrapped in a figure, with the title as caption
+	return func(source, lang string, inline bool, params map[string]string) string {
+		content := highlight(source, lang, inline, params)
+		if title := params[":title"]; title != "" && !inline {
+			return codeTitleOpening(title) + content + "\n" + CODE_TITLE_CLOSING
+		}
+		return content
+	}
 }
@@ -1,7 +1,9 @@
 package markup
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -31,6 +33,23 @@ tags: ["software", "web"]
 	assertEqual(t, string(content), "<p>Hello World!</p>")
 }
 
+func TestSplitFrontMatter(t *testing.T) {
+	frontMatter, body, err := SplitFrontMatter([]byte("---\r\ntitle: crlf\r\n---\r\nfirst\r\n---\r\nsecond\r\n"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(frontMatter), "title: crlf\n")
+	assertEqual(t, string(body), "first\n---\nsecond")
+
+	frontMatter, body, err = SplitFrontMatter([]byte("---\n---\n"))
+	assertEqual(t, err, nil)
+	assertEqual(t, len(frontMatter), 0)
+	assertEqual(t, len(body), 0)
+
+	_, _, err = SplitFrontMatter([]byte("title: none\n---\n"))
+	assertEqual(t, err, ErrNotTemplate)
+	_, _, err = SplitFrontMatter([]byte("---\ntitle: open\n"))
+	assert(t, err != nil && err != ErrNotTemplate)
+}
+
 func TestNonTemplate(t *testing.T) {
 	// not identified as front matter, leaving file as is
 	input := `+++
@@ -178,8 +197,377 @@ tags: ["software", "web"]
 	assertEqual(t, string(content), expected)
 }
 
+func TestRenderDiagrams(t *testing.T) {
+	input := `---
+title: diagrams
+---
+` + "```mermaid" + `
+graph TD;
+    A-->B;
+` + "```" + `
+
+` + "```dot" + `
+digraph { a -> b }
+` + "```" + `
+`
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+
+	// mermaid is left for client-side rendering, dot is piped through an external command
+	options := RenderOptions{DiagramCommands: map[string]string{"dot": "cat"}}
+	content, err := templ.RenderWith(map[string]interface{}{}, options)
+	assertEqual(t, err, nil)
+	expected := `<pre class="diagram mermaid">
+graph TD;
+    A--&gt;B;
+</pre>
+<div class="diagram dot">
+digraph { a -> b }
+</div>
+`
+	assertEqual(t, string(content), expected)
+
+	input = `---
+title: diagrams
+---
+#+begin_src mermaid
+graph TD;
+    A-->B;
+#+end_src
+`
+	file = newFile("test*.org", input)
+	defer os.Remove(file.Name())
+
+	templ, err = Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err = templ.RenderWith(map[string]interface{}{}, options)
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(content), `<pre class="diagram mermaid">
+graph TD;
+    A--&gt;B;
+</pre>`))
+}
+
+func TestRenderMarkdownTypographer(t *testing.T) {
+	input := `---
+title: quotes
+---
+the album is "Joe's Garage" -- by Frank Zappa...
+`
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+
+	content, err := templ.RenderWith(map[string]interface{}{}, RenderOptions{Typographer: true})
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), "<p>the album is &ldquo;Joe&rsquo;s Garage&rdquo; &ndash; by Frank Zappa&hellip;</p>\n")
+
+	content, err = templ.RenderWith(map[string]interface{}{}, RenderOptions{Typographer: false})
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), "<p>the album is &quot;Joe's Garage&quot; -- by Frank Zappa...</p>\n")
+}
+
+func TestRenderMarkdownLineNumbers(t *testing.T) {
+	input := "---\n---\n```go {linenos=true, hl_lines=[2,4-5]}\na\nb\nc\nd\ne\nf\n```\n"
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err := templ.RenderWith(map[string]interface{}{}, RenderOptions{HighlightTheme: "github"})
+	assertEqual(t, err, nil)
+
+	// 6 numbered lines, 3 of them highlighted
+	assertEqual(t, strings.Count(string(content), "color:#7f7f7f"), 6)
+	assertEqual(t, strings.Count(string(content), "background-color:#e5e5e5"), 3)
+	assert(t, strings.Contains(string(content), `<span style="display:flex; background-color:#e5e5e5"><span style="white-space:pre;-webkit-user-select:none;user-select:none;margin-right:0.4em;padding:0 0.4em 0 0.4em;color:#7f7f7f">5</span><span>e`))
+}
+
+func TestRenderCodeBlockTitle(t *testing.T) {
+	input := "---\n---\n```go title=\"main.go\"\npackage main\n```\n"
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err := templ.RenderWith(map[string]interface{}{}, RenderOptions{HighlightTheme: "github"})
+	assertEqual(t, err, nil)
+	assert(t, strings.HasPrefix(string(content), `<figure class="code-block">
+<figcaption>main.go</figcaption>
+<pre style=`))
+	assert(t, strings.HasSuffix(string(content), "</pre></figure>\n"))
+
+	input = `---
+---
+#+begin_src go :title main.go
+package main
+#+end_src
+`
+	file = newFile("test*.org", input)
+	defer os.Remove(file.Name())
+
+	templ, err = Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err = templ.RenderWith(map[string]interface{}{}, RenderOptions{HighlightTheme: "github"})
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(content), `<figure class="code-block">
+<figcaption>main.go</figcaption>
+<div class="highlight">`))
+}
+
+func TestRenderCustomHighlightTheme(t *testing.T) {
+	theme := newFile("theme*.xml", `<style name="jorge-test">
+  <entry type="Background" style="bg:#123456"/>
+  <entry type="Keyword" style="#abcdef"/>
+</style>`)
+	defer os.Remove(theme.Name())
+
+	name, err := LoadHighlightTheme(theme.Name())
+	assertEqual(t, err, nil)
+	assertEqual(t, name, "jorge-test")
+
+	input := "---\n---\n```go\npackage main\n```\n"
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err := templ.RenderWith(map[string]interface{}{}, RenderOptions{HighlightTheme: name})
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(content), "background-color:#123456"))
+	assert(t, strings.Contains(string(content), `<span style="color:#abcdef">package</span>`))
+}
+
+func TestCSSHighlightTheme(t *testing.T) {
+	theme := newFile("palette*.css", ".chroma .kn { color: #abcdef }\n")
+	defer os.Remove(theme.Name())
+
+	name, err := LoadHighlightTheme(theme.Name())
+	assertEqual(t, err, nil)
+	assertEqual(t, name, strings.TrimSuffix(filepath.Base(theme.Name()), ".css"))
+	assert(t, IsCSSTheme(name))
+	assert(t, !IsCSSTheme("github"))
+
+	// the file is used as is for the stylesheet
+	var css strings.Builder
+	err = WriteHighlightCSS(&css, name, "")
+	assertEqual(t, err, nil)
+	assertEqual(t, css.String(), ".chroma .kn { color: #abcdef }\n")
+	css.Reset()
+	err = WriteHighlightCSS(&css, "github", name)
+	assertEqual(t, err, nil)
+	assert(t, strings.HasSuffix(css.String(), "@media (prefers-color-scheme: dark) {\n.chroma .kn { color: #abcdef }\n}\n"))
+}
+
+func TestRenderHighlightClasses(t *testing.T) {
+	input := "---\n---\n```go\npackage main\n```\n"
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err := templ.RenderWith(map[string]interface{}{}, RenderOptions{HighlightTheme: "github", HighlightClasses: true})
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(content), `<pre class="chroma">`))
+	assert(t, strings.Contains(string(content), `<span class="kn">package</span>`))
+	assert(t, !strings.Contains(string(content), "style="))
+
+	var css strings.Builder
+	err = WriteHighlightCSS(&css, "github", "monokai")
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(css.String(), ".chroma .kn {"))
+	assert(t, strings.Contains(css.String(), "@media (prefers-color-scheme: dark) {"))
+}
+
+func TestRenderRuby(t *testing.T) {
+	input := "---\n---\n{漢字|かんじ}と{東京|とう|きょう}\n\n`{code|not ruby}`\n"
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err := templ.RenderWith(map[string]interface{}{}, RenderOptions{Ruby: true})
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), `<p><ruby>漢字<rp>(</rp><rt>かんじ</rt><rp>)</rp></ruby>と<ruby>東<rp>(</rp><rt>とう</rt><rp>)</rp>京<rp>(</rp><rt>きょう</rt><rp>)</rp></ruby></p>
+<p><code>{code|not ruby}</code></p>
+`)
+
+	input = "---\n---\n{漢字|かんじ}と ~{code|not ruby}~\n"
+	file = newFile("test*.org", input)
+	defer os.Remove(file.Name())
+
+	templ, err = Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err = templ.RenderWith(map[string]interface{}{}, RenderOptions{Ruby: true})
+	assertEqual(t, err, nil)
+	assertEqual(t, strings.TrimSpace(string(content)), `<p><ruby>漢字<rp>(</rp><rt>かんじ</rt><rp>)</rp></ruby>と <code>{code|not ruby}</code></p>`)
+}
+
+func TestRenderOrgInclude(t *testing.T) {
+	chapter := newFile("chapter*.org", "* Chapter\nchapter text\n")
+	defer os.Remove(chapter.Name())
+	code := newFile("code*.go", "package main\n\nfunc main() {\n}\n")
+	defer os.Remove(code.Name())
+
+	input := fmt.Sprintf(`---
+---
+#+INCLUDE: "%s"
+#+include: "%s" src go :lines "3-5"
+`, filepath.Base(chapter.Name()), filepath.Base(code.Name()))
+	file := newFile("test*.org", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err := templ.Render()
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(content), `<h1 id="chapter">
+Chapter
+</h1>
+<p>chapter text</p>
+<div class="src src-go">
+<div class="highlight">
+<pre>
+func main() {
+}
+</pre>`))
+
+	// missing files fail the rendering
+	file = newFile("test*.org", "---\n---\n#+INCLUDE: \"missing.org\"\n")
+	defer os.Remove(file.Name())
+	templ, err = Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	_, err = templ.Render()
+	assert(t, err != nil)
+}
+
+func TestRenderMath(t *testing.T) {
+	input := "---\n---\nif $x_1 < y_1$ then, for $5 and $10:\n\n$$\\sum_i x_i$$\n"
+	file := newFile("test*.md", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+
+	// inline math is piped through a command, display math is left for client-side rendering
+	options := RenderOptions{MathCommands: map[string]string{"inline": "tr a-z A-Z"}}
+	content, err := templ.RenderWith(map[string]interface{}{}, options)
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), `<p>if <span class="math inline">X_1 < Y_1</span> then, for $5 and $10:</p>
+<p><span class="math display">\[\sum_i x_i\]</span></p>
+`)
+
+	input = "---\n---\nif \\(x_1 < y_1\\) then\n"
+	file = newFile("test*.org", input)
+	defer os.Remove(file.Name())
+
+	templ, err = Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err = templ.RenderWith(map[string]interface{}{}, options)
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(content), `if <span class="math inline">X_1 < Y_1</span> then`))
+}
+
+func TestRenderOrgOptions(t *testing.T) {
+	input := `---
+---
+* TODO First
+:LOGBOOK:
+- logged
+:END:
+** Nested
+* Second
+`
+	file := newFile("test*.org", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+
+	// default go-org settings
+	content, err := templ.RenderWith(map[string]interface{}{}, RenderOptions{})
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(content), "<nav>"))
+	assert(t, strings.Contains(string(content), `<h1 id="first">
+<span class="todo status-todo">TODO</span>
+First
+</h1>`))
+	assert(t, strings.Contains(string(content), "logged"))
+
+	options := map[string]interface{}{"toc": false, "todo": false, "drawers": false, "num": 1, "top_level": 2}
+	content, err = templ.RenderWith(map[string]interface{}{}, RenderOptions{OrgOptions: options})
+	assertEqual(t, err, nil)
+	assert(t, !strings.Contains(string(content), "<nav>"))
+	assert(t, !strings.Contains(string(content), "logged"))
+	assert(t, strings.Contains(string(content), `<h2 id="first">
+<span class="section-number">1</span>
+First
+</h2>`))
+	assert(t, strings.Contains(string(content), `<h3 id="nested">
+Nested
+</h3>`))
+	assert(t, strings.Contains(string(content), `<h2 id="second">
+<span class="section-number">2</span>
+Second
+</h2>`))
+
+	// the file's own options take precedence
+	file = newFile("test*.org", "---\n---\n#+OPTIONS: toc:t\n"+input[8:])
+	defer os.Remove(file.Name())
+	templ, err = Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err = templ.RenderWith(map[string]interface{}{}, RenderOptions{OrgOptions: options})
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(content), "<nav>"))
+}
+
 // ------ HELPERS --------
 
+func TestRenderAutoEscape(t *testing.T) {
+	input := `---
+title: Tom & "Jerry"
+auto_escape: true
+---
+<title>{{ page.title }}</title>
+<link title="{{- page.title -}}"/>
+<summary>{{ page.title | cdata }}</summary>
+<content>{{ "<p>hi</p>" | raw }}</content>
+{% raw %}{{ page.title }}{% endraw %}`
+
+	file := newFile("test*.xml", input)
+	defer os.Remove(file.Name())
+
+	templ, err := Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err := templ.Render()
+	assertEqual(t, err, nil)
+	expected := `<title>Tom &amp; &#34;Jerry&#34;</title>
+<link title="Tom &amp; &#34;Jerry&#34;"/>
+<summary><![CDATA[Tom & "Jerry"]]></summary>
+<content><p>hi</p></content>
+{{ page.title }}`
+	assertEqual(t, string(content), expected)
+
+	input = `---
+title: Tom & "Jerry"
+auto_escape: true
+---
+{"title": "{{ page.title }}", "data": {{ page | jsonify }}}`
+	file = newFile("test*.json", input)
+	defer os.Remove(file.Name())
+
+	templ, err = Parse(NewEngine("https://olano.dev", "includes"), file.Name())
+	assertEqual(t, err, nil)
+	content, err = templ.Render()
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), `{"title": "Tom & \"Jerry\"", "data": {"auto_escape":true,"title":"Tom & \"Jerry\""}}`)
+}
+
 func newFile(path string, contents string) *os.File {
 	file, _ := os.CreateTemp("", path)
 	file.WriteString(contents)
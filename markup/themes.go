@@ -0,0 +1,113 @@
+package markup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Stylesheets loaded from CSS theme files, by theme name.
+var cssThemes = make(map[string]string)
+var cssThemesMutex sync.RWMutex
+
+// Return true if the given highlight theme is a path to a theme file instead of a builtin theme name.
+func IsHighlightThemeFile(theme string) bool {
+	ext := filepath.Ext(theme)
+	return ext == ".xml" || ext == ".css"
+}
+
+// Load a chroma style from the XML file at the given path and register it, so it can
+// be referenced by name like the builtin themes. Returns the name of the loaded style.
+// See https://github.com/alecthomas/chroma/tree/master/styles for examples of the format.
+// CSS files are registered as is, named after the file, and can only be used with class based
+// highlighting, see IsCSSTheme.
+func LoadHighlightTheme(path string) (string, error) {
+	if filepath.Ext(path) == ".css" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".css")
+		cssThemesMutex.Lock()
+		cssThemes[name] = string(content)
+		cssThemesMutex.Unlock()
+		return name, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	style, err := chroma.NewXMLStyle(file)
+	if err != nil {
+		return "", fmt.Errorf("invalid highlight theme file '%s': %w", path, err)
+	}
+	styles.Register(style)
+	return style.Name, nil
+}
+
+// Return true if the given theme was loaded from a CSS file, so it requires class based highlighting.
+func IsCSSTheme(name string) bool {
+	_, found := cssTheme(name)
+	return found
+}
+
+func cssTheme(name string) (string, bool) {
+	cssThemesMutex.RLock()
+	defer cssThemesMutex.RUnlock()
+	css, found := cssThemes[name]
+	return css, found
+}
+
+// Return the names of the available syntax highlighting themes.
+func HighlightThemes() []string {
+	return styles.Names()
+}
+
+// Write the stylesheet with the classes of the given highlighting theme, to be used along
+// with the HighlightClasses render option. If a dark theme is given, its classes are added
+// within a prefers-color-scheme media query.
+func WriteHighlightCSS(w io.Writer, theme string, darkTheme string) error {
+	if err := writeThemeCSS(w, theme); err != nil {
+		return err
+	}
+
+	if darkTheme != "" {
+		fmt.Fprintln(w, "@media (prefers-color-scheme: dark) {")
+		if err := writeThemeCSS(w, darkTheme); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "}")
+	}
+	return nil
+}
+
+// Write the classes of the given theme, either those of a chroma style or a loaded CSS file.
+func writeThemeCSS(w io.Writer, theme string) error {
+	if css, found := cssTheme(theme); found {
+		_, err := fmt.Fprintln(w, strings.TrimSpace(css))
+		return err
+	}
+	style, err := getTheme(theme)
+	if err != nil {
+		return err
+	}
+	return html.New(html.WithClasses(true)).WriteCSS(w, style)
+}
+
+func getTheme(name string) (*chroma.Style, error) {
+	style, ok := styles.Registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown highlight theme '%s'", name)
+	}
+	return style, nil
+}
@@ -0,0 +1,50 @@
+package markup
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Check that the given content is well-formed according to the format implied by the
+// target extension. Only xml and json are validated, other formats are always accepted.
+func ValidateOutput(content []byte, ext string) error {
+	switch ext {
+	case ".xml":
+		return validateXml(content)
+	case ".json":
+		return validateJson(content)
+	}
+	return nil
+}
+
+func validateXml(content []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			// xml syntax errors already include the output line number
+			return fmt.Errorf("invalid xml output: %w", err)
+		}
+	}
+}
+
+func validateJson(content []byte) error {
+	var value interface{}
+	err := json.Unmarshal(content, &value)
+	if err == nil {
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := bytes.Count(content[:syntaxErr.Offset], []byte("\n")) + 1
+		return fmt.Errorf("invalid json output on line %d: %w", line, err)
+	}
+	return fmt.Errorf("invalid json output: %w", err)
+}
@@ -0,0 +1,65 @@
+package markup
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Chinese and Japanese are written without spaces between words, so each of their
+// characters is counted as a word.
+func isCJK(char rune) bool {
+	return unicode.In(char, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// Return the byte offsets where each of the words of the given text end. Words are separated by
+// whitespace, except for CJK characters which are each a word. Punctuation is kept with the
+// preceding word.
+func wordEnds(text string) []int {
+	var ends []int
+	inWord, inCJK := false, false
+	for i, char := range text {
+		switch {
+		case unicode.IsSpace(char):
+			if inWord {
+				ends = append(ends, i)
+			}
+			inWord, inCJK = false, false
+		case unicode.IsPunct(char):
+			continue
+		case isCJK(char) || inCJK:
+			if inWord {
+				ends = append(ends, i)
+			}
+			inWord, inCJK = true, isCJK(char)
+		default:
+			inWord = true
+		}
+	}
+	if inWord {
+		ends = append(ends, len(strings.TrimRightFunc(text, unicode.IsSpace)))
+	}
+	return ends
+}
+
+// Return the number of words in the given text, counting CJK characters as words.
+func CountWords(text string) int {
+	return len(wordEnds(text))
+}
+
+// Truncate the given text to its first n words, counting CJK characters as words,
+// appending an ellipsis if it was truncated.
+func TruncateWords(text string, n int) string {
+	ends := wordEnds(text)
+	if len(ends) <= n || n <= 0 {
+		return text
+	}
+	// include the punctuation that follows the last word
+	end := ends[n-1]
+	for _, char := range text[end:] {
+		if !unicode.IsPunct(char) {
+			break
+		}
+		end += len(string(char))
+	}
+	return text[:end] + "…"
+}
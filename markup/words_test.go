@@ -0,0 +1,19 @@
+package markup
+
+import "testing"
+
+func TestCountWords(t *testing.T) {
+	assertEqual(t, CountWords("hello world, again."), 3)
+	assertEqual(t, CountWords("  "), 0)
+	assertEqual(t, CountWords("今日は良い天気です。"), 9)
+	assertEqual(t, CountWords("Go言語で書いた"), 7)
+	assertEqual(t, CountWords("안녕하세요 세계"), 2)
+}
+
+func TestTruncateWords(t *testing.T) {
+	assertEqual(t, TruncateWords("hello world, again.", 2), "hello world,…")
+	assertEqual(t, TruncateWords("hello world", 2), "hello world")
+	assertEqual(t, TruncateWords("今日は良い天気です。", 5), "今日は良い…")
+	assertEqual(t, TruncateWords("「東京」は大きい", 2), "「東京」…")
+	assertEqual(t, TruncateWords("Go言語で書いた", 3), "Go言語…")
+}
@@ -0,0 +1,140 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+// Pages can declare the urls they were previously published at, e.g. after being renamed or moved:
+//
+//	aliases: [/blog/old-title, /2023/01/old-title.html]
+//
+// A redirect to the page is written at each alias, and the aliases are available to templates as
+// `page.aliases` and, by alias, as `site.aliases`, so feeds and layouts can reference the old urls.
+// Aliases without extension are written as directory indexes, like the rest of the html pages,
+// and the rest at their literal path.
+func (site *Site) loadAliases() error {
+	targets := make(map[string]string)
+	for _, templ := range site.templates {
+		targets[templ.Metadata["path"].(string)] = templ.SrcPath
+	}
+
+	for _, templ := range site.templates {
+		aliases, err := pageAliases(templ.Metadata["aliases"])
+		if err != nil {
+			return fmt.Errorf("invalid aliases in %s: %w", templ.SrcPath, err)
+		}
+		if len(aliases) == 0 || (templ.IsDraft() && !site.config.IncludeDrafts) {
+			continue
+		}
+
+		normalized := make([]interface{}, len(aliases))
+		for i, alias := range aliases {
+			targetPath := aliasTargetPath(alias)
+			if other, found := targets[targetPath]; found {
+				return fmt.Errorf("alias %s of %s conflicts with %s", alias, templ.SrcPath, other)
+			}
+			targets[targetPath] = templ.SrcPath
+			site.aliases[alias] = templ.Metadata["url"].(string)
+			normalized[i] = alias
+		}
+		templ.Metadata["aliases"] = normalized
+	}
+	return nil
+}
+
+// Return the site-relative urls of the given aliases front matter value, either a string or a list.
+func pageAliases(value interface{}) ([]string, error) {
+	var values []interface{}
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		values = []interface{}{value}
+	case []interface{}:
+		values = value
+	default:
+		return nil, fmt.Errorf("expected a url or a list of urls")
+	}
+
+	var aliases []string
+	for _, value := range values {
+		alias, ok := value.(string)
+		if !ok || strings.TrimSpace(alias) == "" || strings.Contains(alias, "://") {
+			return nil, fmt.Errorf("expected a site path, got %v", value)
+		}
+		alias = path.Clean("/" + strings.TrimSpace(alias))
+		if alias == "/" {
+			return nil, fmt.Errorf("the site root can't be an alias")
+		}
+		if !slices.Contains(aliases, alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases, nil
+}
+
+// Return the path relative to the target directory where the redirect of the given alias is written.
+// Aliases with an extension are written at their literal path, so the old url keeps working
+// on static hosts.
+func aliasTargetPath(alias string) string {
+	relPath := filepath.FromSlash(strings.TrimPrefix(alias, "/"))
+	if filepath.Ext(relPath) == "" {
+		return filepath.Join(relPath, "index.html")
+	}
+	return relPath
+}
+
+// Write a page redirecting to its canonical url at each of the site aliases.
+func (site *Site) writeAliasRedirects() error {
+	for alias, pageUrl := range site.aliases {
+		canonical, err := markup.RelativeUrl(site.config.BaseUrl, pageUrl)
+		if err != nil {
+			return err
+		}
+		escaped := html.EscapeString(canonical)
+		absolute := html.EscapeString(site.config.SiteUrl + canonical)
+		content := fmt.Sprintf(ALIAS_REDIRECT_TEMPLATE, escaped, absolute, escaped, escaped)
+
+		targetPath := filepath.Join(site.config.TargetDir, aliasTargetPath(alias))
+		if err := os.MkdirAll(filepath.Dir(targetPath), DIR_RWE_MODE); err != nil {
+			return err
+		}
+		if err := site.writeToFile(targetPath, strings.NewReader(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the absolute urls of the aliases of the given page, for the alias_links option.
+func (site *Site) aliasLinks(templ *markup.Template) []string {
+	aliases, _ := templ.Metadata["aliases"].([]interface{})
+	var links []string
+	for _, alias := range aliases {
+		links = append(links, site.config.SiteUrl+site.config.BaseUrl+alias.(string))
+	}
+	return links
+}
+
+const ALIAS_REDIRECT_TEMPLATE = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Redirecting to %s</title>
+<link rel="canonical" href="%s">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url=%s">
+</head>
+<body>
+<p>This page has moved to <a href="%s">a new location</a>.</p>
+</body>
+</html>
+`
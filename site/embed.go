@@ -0,0 +1,88 @@
+package site
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/facundoolano/jorge/markup"
+	"github.com/osteele/liquid/render"
+)
+
+// The context key with the source paths of the pages being embedded, to detect cycles.
+const EMBEDDING_KEY = "__embedding"
+
+var pageTagArgs = regexp.MustCompile(`^\s*["']?([^"'\s]+)["']?(?:\s+section=["']?([^"']+?)["']?)?\s*$`)
+
+// Register the page tag, which outputs the rendered content of another page, without its layout,
+// or just one of its named sections (see Template.RenderSections):
+//
+//	{% page "about.md" %}
+//	{% page "about.md" section="bio" %}
+//
+// The path is relative to the src directory. This way shared text can be kept in a single file.
+func (site *Site) loadPageTag() {
+	site.templateEngine.RegisterTag("page", func(rc render.Context) (string, error) {
+		args, err := rc.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		match := pageTagArgs.FindStringSubmatch(args)
+		if match == nil {
+			return "", fmt.Errorf("invalid page tag arguments %s, expected a path and optional section", args)
+		}
+		return site.embedPage(rc, match[1], match[2])
+	})
+}
+
+// Render the template at the given path, relative to the src directory, in the context
+// of the current page, returning the contents of the given section if not empty.
+func (site *Site) embedPage(rc render.Context, relPath string, section string) (string, error) {
+	srcPath := filepath.Join(site.config.SrcDir, relPath)
+
+	// the pages currently being rendered, from the top-level one
+	embedding, _ := rc.Get(EMBEDDING_KEY).([]string)
+	if page, ok := rc.Get("page").(map[string]interface{}); ok && len(embedding) == 0 {
+		if pagePath, ok := page["src_path"].(string); ok {
+			embedding = []string{filepath.Join(site.config.RootDir, pagePath)}
+		}
+	}
+	if slices.Contains(embedding, srcPath) {
+		return "", fmt.Errorf("page %s embeds itself", relPath)
+	}
+	site.addReference(srcPath)
+
+	templ, found := site.templates[srcPath]
+	if !found {
+		var err error
+		templ, err = markup.Parse(site.templateEngine, srcPath)
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("page %s not found", relPath)
+		} else if err != nil {
+			return "", err
+		}
+	}
+	if templ == nil {
+		return "", fmt.Errorf("page %s is not a template", relPath)
+	}
+
+	ctx := site.AsContext()
+	ctx["page"] = templ.Metadata
+	ctx[EMBEDDING_KEY] = append(slices.Clone(embedding), srcPath)
+	content, sections, err := templ.RenderSections(ctx, site.renderOptions(templ))
+	if err != nil {
+		return "", err
+	}
+
+	if section != "" {
+		html, found := sections.Get(section)
+		if !found {
+			return "", fmt.Errorf("error embedding %s: section %s not found", relPath, section)
+		}
+		return markup.RawOutput(rc, html), nil
+	}
+	return markup.RawOutput(rc, strings.TrimSpace(string(content))), nil
+}
@@ -0,0 +1,45 @@
+package site
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+// Set the `feed_id` and `updated` metadata of the given post, for feeds to identify entries and
+// their changes without depending on the post url, which may change:
+//
+//   - feed_id defaults to a tag URI with the site host, the post date and the path it was originally
+//     published at, i.e. its first alias if it has any, e.g. tag:olano.dev,2024-02-01:/blog/hello.
+//   - updated defaults to the date of the last commit that changed the post content, ignoring
+//     front matter changes, if the updated_from_git config is set, or to the post date otherwise.
+//
+// Both can be set explicitly in the front matter.
+func (site *Site) addFeedMetadata(templ *markup.Template, relPath string) {
+	date, ok := templ.Metadata["date"].(time.Time)
+	if !ok {
+		return
+	}
+
+	if _, found := templ.Metadata["feed_id"]; !found {
+		originalUrl := templ.Metadata["url"].(string)
+		if aliases, err := pageAliases(templ.Metadata["aliases"]); err == nil && len(aliases) > 0 {
+			originalUrl = aliases[0]
+		}
+		host := "localhost"
+		if parsed, err := url.Parse(site.config.SiteUrl); err == nil && parsed.Hostname() != "" {
+			host = parsed.Hostname()
+		}
+		templ.Metadata["feed_id"] = fmt.Sprintf("tag:%s,%s:%s", host, date.Format(time.DateOnly), originalUrl)
+	}
+
+	if _, found := templ.Metadata["updated"]; !found {
+		updated := date
+		if modified, ok := site.lastModified[relPath]; ok && modified.After(date) {
+			updated = modified
+		}
+		templ.Metadata["updated"] = updated
+	}
+}
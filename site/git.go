@@ -0,0 +1,243 @@
+package site
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+// Return the files under the given directory that are committed to its git repository,
+// by their path relative to it. Untracked and staged but not yet committed files are excluded.
+func gitCommittedFiles(dir string) (map[string]bool, error) {
+	output, err := runGit(dir, "ls-tree", "-r", "--name-only", "-z", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool)
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path != "" {
+			files[filepath.FromSlash(path)] = true
+		}
+	}
+	return files, nil
+}
+
+// The results of gitLastModified, by directory and HEAD commit, since the log of a big repository
+// takes a while and it doesn't change on most serve rebuilds.
+var lastModifiedCache = struct {
+	sync.Mutex
+	entries map[string]map[string]time.Time
+}{entries: make(map[string]map[string]time.Time)}
+
+// A change to a file in a commit, as listed by git log --raw.
+type gitFileChange struct {
+	// the position of the commit in the log, from the most recent
+	commit  int
+	date    time.Time
+	oldBlob string
+	newBlob string
+	status  byte
+	// the previous path of renamed files
+	oldPath string
+}
+
+// Return the date of the last commit that modified the content of each of the files under the given directory,
+// by their path relative to it. Changes that only touch the front matter of templates, e.g. to fix a tag
+// or add an alias, are ignored, so they don't show up as updates in the feeds.
+func gitLastModified(dir string) (map[string]time.Time, error) {
+	head, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := dir + "\x00" + strings.TrimSpace(string(head))
+	lastModifiedCache.Lock()
+	defer lastModifiedCache.Unlock()
+	if dates, found := lastModifiedCache.entries[cacheKey]; found {
+		return dates, nil
+	}
+
+	output, err := runGit(dir, "-c", "core.quotepath=off", "log", "--format=@%cI", "--raw", "--no-abbrev", "-M", "--relative", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	// the log is sorted by most recent commit, followed by the files it changed, e.g.:
+	// :100644 100644 <old blob> <new blob> M	blog/hello.md
+	changes := make(map[string][]gitFileChange)
+	var commitDate time.Time
+	commit := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		if date, found := strings.CutPrefix(line, "@"); found {
+			if commitDate, err = time.Parse(time.RFC3339, date); err != nil {
+				return nil, err
+			}
+			commit++
+			continue
+		}
+		fields, paths, found := strings.Cut(line, "\t")
+		fields = strings.TrimPrefix(fields, ":")
+		parts := strings.Fields(fields)
+		if !found || len(parts) != 5 {
+			continue
+		}
+		change := gitFileChange{commit: commit, date: commitDate, oldBlob: parts[2], newBlob: parts[3], status: parts[4][0]}
+		path := paths
+		if oldPath, newPath, renamed := strings.Cut(paths, "\t"); renamed {
+			change.oldPath, path = filepath.FromSlash(oldPath), newPath
+		}
+		path = filepath.FromSlash(path)
+		changes[path] = append(changes[path], change)
+	}
+
+	blobs, err := newGitBlobReader(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer blobs.Close()
+
+	dates := make(map[string]time.Time)
+	for path, fileChanges := range changes {
+		if fileChanges[0].status == 'D' {
+			continue
+		}
+		if ext := filepath.Ext(path); ext != ".md" && ext != ".org" && ext != ".html" {
+			// only the dates of posts are used, no need to look into other files
+			dates[path] = fileChanges[0].date
+			continue
+		}
+		date, err := lastContentChange(blobs, changes, path)
+		if err != nil {
+			return nil, err
+		}
+		dates[path] = date
+	}
+	lastModifiedCache.entries[cacheKey] = dates
+	return dates, nil
+}
+
+// Return the date of the most recent change of the file at the given path that modified its content, following renames.
+// If only front matter changes are found, e.g. in a shallow clone, return the oldest one.
+func lastContentChange(blobs *gitBlobReader, changes map[string][]gitFileChange, path string) (time.Time, error) {
+	fileChanges := changes[path]
+	var date time.Time
+	for len(fileChanges) > 0 {
+		change := fileChanges[0]
+		fileChanges = fileChanges[1:]
+		date = change.date
+		if change.status == 'A' {
+			return date, nil
+		}
+		same, err := blobs.sameContent(change.oldBlob, change.newBlob)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !same {
+			return date, nil
+		}
+		if change.oldPath != "" {
+			// continue with the changes made before the file was renamed
+			fileChanges = changes[change.oldPath]
+			for len(fileChanges) > 0 && fileChanges[0].commit <= change.commit {
+				fileChanges = fileChanges[1:]
+			}
+		}
+	}
+	return date, nil
+}
+
+// Reads blobs from the repository with a single git cat-file process.
+type gitBlobReader struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func newGitBlobReader(dir string) (*gitBlobReader, error) {
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = dir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &gitBlobReader{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+func (reader *gitBlobReader) read(blob string) ([]byte, error) {
+	if _, err := fmt.Fprintln(reader.stdin, blob); err != nil {
+		return nil, err
+	}
+	// the blob is preceded by a "<hash> blob <size>" header and followed by a newline
+	header, err := reader.stdout.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("git: can't read blob %s", blob)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, size+1)
+	if _, err := io.ReadFull(reader.stdout, content); err != nil {
+		return nil, err
+	}
+	return content[:size], nil
+}
+
+// Return true if the given blobs have the same content, not counting the front matter of templates.
+func (reader *gitBlobReader) sameContent(oldBlob string, newBlob string) (bool, error) {
+	if oldBlob == newBlob {
+		return true, nil
+	}
+	oldContent, err := reader.read(oldBlob)
+	if err != nil {
+		return false, err
+	}
+	newContent, err := reader.read(newBlob)
+	if err != nil {
+		return false, err
+	}
+	_, oldBody, oldErr := markup.SplitFrontMatter(oldContent)
+	_, newBody, newErr := markup.SplitFrontMatter(newContent)
+	if oldErr != nil || newErr != nil {
+		return bytes.Equal(oldContent, newContent), nil
+	}
+	return bytes.Equal(oldBody, newBody), nil
+}
+
+func (reader *gitBlobReader) Close() error {
+	reader.stdin.Close()
+	return reader.cmd.Wait()
+}
+
+// Run git with the given arguments in the given directory, returning its output.
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git: %w %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
@@ -0,0 +1,50 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+// The stylesheet written to the target root when class based syntax highlighting is enabled.
+const HIGHLIGHT_STYLESHEET = "highlight.css"
+
+// Register the highlight themes that point to chroma style or CSS files instead of builtin theme names,
+// replacing them in the config with the name of the loaded style. CSS themes switch to class based
+// highlighting, with the file contents as the highlight stylesheet.
+func (site *Site) loadHighlightThemes() error {
+	for _, theme := range []*string{&site.config.HighlightTheme, &site.config.HighlightThemeDark} {
+		if !markup.IsHighlightThemeFile(*theme) {
+			continue
+		}
+		name, err := markup.LoadHighlightTheme(filepath.Join(site.config.RootDir, *theme))
+		if err != nil {
+			return err
+		}
+		*theme = name
+		if markup.IsCSSTheme(name) {
+			site.config.HighlightClasses = true
+		}
+	}
+	return nil
+}
+
+// If syntax highlighting uses css classes, write the stylesheet for the configured themes,
+// unless the site provides its own. When a dark theme is configured, it's applied according
+// to the `prefers-color-scheme` media query.
+func (site *Site) writeHighlightStylesheet() error {
+	if !site.config.HighlightClasses || site.config.HighlightTheme == markup.NO_SYNTAX_HIGHLIGHTING {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(site.config.SrcDir, HIGHLIGHT_STYLESHEET)); err == nil {
+		return nil
+	}
+
+	var css strings.Builder
+	if err := markup.WriteHighlightCSS(&css, site.config.HighlightTheme, site.config.HighlightThemeDark); err != nil {
+		return err
+	}
+	return site.writeToFile(filepath.Join(site.config.TargetDir, HIGHLIGHT_STYLESHEET), strings.NewReader(css.String()))
+}
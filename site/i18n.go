@@ -0,0 +1,135 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+// When the `languages` config key is set, each language is expected to have a top-level
+// directory in src/, e.g. src/en/ and src/es/, and pages at the same path relative to those
+// directories are considered translations of each other.
+
+// Return the language of the given src-relative path, according to its top-level
+// directory, and the path relative to that language directory.
+func (site *Site) pathLanguage(relPath string) (string, string, bool) {
+	parts := strings.SplitN(filepath.ToSlash(relPath), "/", 2)
+	if len(parts) < 2 || !slices.Contains(site.config.Languages, parts[0]) {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Set the `lang` of the templates in language directories, unless explicitly set in their front matter,
+// and a list of `translations` with the url of each of the page's language variants, which can be
+// used in layouts to add hreflang alternate links.
+func (site *Site) addTranslations() {
+	if len(site.config.Languages) == 0 {
+		return
+	}
+
+	variants := make(map[string][]map[string]interface{})
+	for path, templ := range site.templates {
+		relPath, _ := filepath.Rel(site.config.SrcDir, path)
+		lang, langPath, ok := site.pathLanguage(relPath)
+		if !ok {
+			continue
+		}
+		if _, found := templ.Metadata["lang"]; !found {
+			templ.Metadata["lang"] = lang
+		}
+		variants[langPath] = append(variants[langPath], map[string]interface{}{
+			"lang": lang,
+			"url":  templ.Metadata["url"],
+		})
+	}
+
+	for path, templ := range site.templates {
+		relPath, _ := filepath.Rel(site.config.SrcDir, path)
+		if _, langPath, ok := site.pathLanguage(relPath); ok {
+			translations := variants[langPath]
+			slices.SortFunc(translations, func(a map[string]interface{}, b map[string]interface{}) int {
+				return strings.Compare(a["lang"].(string), b["lang"].(string))
+			})
+			templ.Metadata["translations"] = translations
+		}
+	}
+}
+
+// Set the `text_direction` of each template, "rtl" or "ltr" according to its language, unless
+// explicitly set in its front matter. Layouts can use it as the `dir` attribute of the html element.
+func (site *Site) addTextDirection() {
+	for _, templ := range site.templates {
+		if _, found := templ.Metadata["text_direction"]; !found {
+			templ.Metadata["text_direction"] = markup.TextDirection(site.pageLang(templ))
+		}
+	}
+}
+
+// If enabled with the `language_redirect` config key, and the site doesn't provide its own
+// root index page, write an index.html that redirects visitors to their preferred language
+// directory, including hreflang alternates for each language plus an x-default pointing to itself.
+func (site *Site) writeLanguageRedirect() error {
+	if !site.config.LanguageRedirect || len(site.config.Languages) == 0 {
+		return nil
+	}
+
+	// skip if there's already a root index, either static or as a template
+	if _, err := os.Stat(filepath.Join(site.config.SrcDir, "index.html")); err == nil {
+		return nil
+	}
+	for _, templ := range site.templates {
+		if templ.Metadata["path"] == "index.html" {
+			return nil
+		}
+	}
+
+	var links, items, quoted []string
+	for _, lang := range site.config.Languages {
+		href, _ := url.JoinPath(site.config.SiteUrl, site.config.BaseUrl, lang+"/")
+		links = append(links, fmt.Sprintf(`<link rel="alternate" hreflang="%s" href="%s">`, lang, html.EscapeString(href)))
+		items = append(items, fmt.Sprintf(`<li><a href="%s/%s/">%s</a></li>`, site.config.BaseUrl, lang, lang))
+		quoted = append(quoted, fmt.Sprintf("%q", lang))
+	}
+	defaultHref, _ := url.JoinPath(site.config.SiteUrl, site.config.BaseUrl, "/")
+	links = append(links, fmt.Sprintf(`<link rel="alternate" hreflang="x-default" href="%s">`, html.EscapeString(defaultHref)))
+
+	content := fmt.Sprintf(LANGUAGE_REDIRECT_TEMPLATE,
+		strings.Join(links, "\n"),
+		strings.Join(quoted, ", "),
+		site.config.BaseUrl,
+		site.config.Languages[0],
+		strings.Join(items, "\n"))
+
+	return site.writeToFile(filepath.Join(site.config.TargetDir, "index.html"), strings.NewReader(content))
+}
+
+const LANGUAGE_REDIRECT_TEMPLATE = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+%s
+<script type="text/javascript">
+var languages = [%s];
+var preferred = (navigator.languages || [navigator.language]).map(function (lang) {
+  return lang.slice(0, 2).toLowerCase();
+}).find(function (lang) {
+  return languages.includes(lang);
+});
+location.replace("%s/" + (preferred || "%s") + "/");
+</script>
+</head>
+<body>
+<ul>
+%s
+</ul>
+</body>
+</html>
+`
@@ -0,0 +1,77 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+
+	"github.com/facundoolano/jorge/markup"
+	"github.com/osteele/liquid/render"
+)
+
+// Register the island tag, which embeds an interactive widget in an otherwise static page:
+//
+//	{% island "comments.js" props=page.slug %}
+//
+// It outputs a placeholder element and a module script that imports the given file, relative to
+// the src directory, and calls its default export with each placeholder element and its props:
+//
+//	export default function mount(element, props) { ... }
+//
+// The script url includes a hash of the file contents, so browsers don't use stale cached versions.
+func (site *Site) loadIslandTag() {
+	site.templateEngine.RegisterTag("island", func(rc render.Context) (string, error) {
+		relPath, params, err := markup.ParseTagArgs(rc)
+		if err != nil {
+			return "", err
+		} else if relPath == "" {
+			return "", fmt.Errorf("island tag expects a script path")
+		}
+
+		url, err := site.islandUrl(relPath)
+		if err != nil {
+			return "", err
+		}
+		props, err := json.Marshal(params["props"])
+		if err != nil {
+			return "", fmt.Errorf("invalid props for island %s: %w", relPath, err)
+		}
+
+		// each script mounts the placeholders not yet handled, so the same island can be used more than once in a page
+		selector := fmt.Sprintf(`[data-island="%s"]:not([data-island-mounted])`, url)
+		output := fmt.Sprintf(`<div data-island="%s" data-props="%s"></div>
+<script type="module">
+import mount from %q;
+document.querySelectorAll(%q).forEach((element) => {
+  element.dataset.islandMounted = "";
+  mount(element, JSON.parse(element.dataset.props));
+});
+</script>`, html.EscapeString(url), html.EscapeString(string(props)), url, selector)
+		return markup.RawOutput(rc, output), nil
+	})
+}
+
+// Return the url of the given script, relative to the src directory, including a hash of its contents.
+func (site *Site) islandUrl(relPath string) (string, error) {
+	url, err := site.linkUrl(relPath)
+	if err != nil {
+		return "", err
+	}
+	url, err = markup.RelativeUrl(site.config.BaseUrl, url)
+	if err != nil {
+		return "", err
+	}
+
+	srcPath := filepath.Join(site.config.SrcDir, relPath)
+	site.addReference(srcPath)
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(content)
+	return fmt.Sprintf("%s?v=%s", url, hex.EncodeToString(hash[:])[:8]), nil
+}
@@ -0,0 +1,94 @@
+package site
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/facundoolano/jorge/markup"
+	"github.com/osteele/liquid/render"
+)
+
+// Register the link and post_url tags, which output the url of another file of the site,
+// failing the build if it doesn't exist:
+//
+//	{% link blog/hello-world.org %}   -> /blog/hello-world
+//	{% post_url hello-world %}        -> /blog/hello-world
+//
+// `link` expects a path relative to the src directory, `post_url` the file name of a post, without extension.
+// The urls include the site base url, if configured.
+func (site *Site) loadLinkTags() {
+	site.templateEngine.RegisterTag("link", func(rc render.Context) (string, error) {
+		path, err := rc.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		url, err := site.linkUrl(strings.Trim(strings.TrimSpace(path), `"'`))
+		if err != nil {
+			return "", err
+		}
+		return markup.RelativeUrl(site.config.BaseUrl, url)
+	})
+
+	site.templateEngine.RegisterTag("post_url", func(rc render.Context) (string, error) {
+		name, err := rc.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		path, err := site.findPost(strings.Trim(strings.TrimSpace(name), `"'`))
+		if err != nil {
+			return "", err
+		}
+		url, err := site.linkUrl(path)
+		if err != nil {
+			return "", err
+		}
+		return markup.RelativeUrl(site.config.BaseUrl, url)
+	})
+}
+
+// Return the url of the file at the given path, relative to the src directory.
+// Templates may not be loaded yet when this is called, so their front matter is parsed
+// if necessary to find out their target path.
+func (site *Site) linkUrl(relPath string) (string, error) {
+	srcPath := filepath.Join(site.config.SrcDir, relPath)
+
+	templ, found := site.templates[srcPath]
+	if !found {
+		var err error
+		templ, err = markup.Parse(site.templateEngine, srcPath)
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("broken link to %s: file not found", relPath)
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	if templ == nil {
+		// static files keep their path, except for html
+		return targetPathToUrl(prettyTargetPath(relPath)), nil
+	}
+	if templ.IsDraft() && !site.config.IncludeDrafts {
+		return "", fmt.Errorf("broken link to %s: the file is a draft", relPath)
+	}
+	if url, ok := templ.Metadata["url"].(string); ok {
+		return url, nil
+	}
+	targetPath, err := templateTargetPath(templ, relPath)
+	if err != nil {
+		return "", err
+	}
+	return targetPathToUrl(targetPath), nil
+}
+
+// Return the path, relative to the src directory, of the post file with the given name, without extension.
+func (site *Site) findPost(name string) (string, error) {
+	matches := site.postPaths[name]
+	if len(matches) == 0 {
+		return "", fmt.Errorf("broken link to post %s: post not found", name)
+	} else if len(matches) > 1 {
+		return "", fmt.Errorf("ambiguous post_url %s, matches: %s", name, strings.Join(matches, ", "))
+	}
+	return matches[0], nil
+}
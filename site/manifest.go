@@ -0,0 +1,120 @@
+package site
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Bumped when the manifest structure changes in a backwards incompatible way.
+const MANIFEST_VERSION = 1
+
+type manifest struct {
+	Version     int                 `json:"version"`
+	Url         string              `json:"url"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Pages       []manifestPage      `json:"pages"`
+	Collections map[string][]string `json:"collections"`
+	Tags        map[string][]string `json:"tags"`
+}
+
+type manifestPage struct {
+	Url         string     `json:"url"`
+	AbsoluteUrl string     `json:"absolute_url"`
+	Path        string     `json:"path"`
+	SrcPath     string     `json:"src_path"`
+	Type        string     `json:"type"`
+	Title       string     `json:"title,omitempty"`
+	Date        *time.Time `json:"date,omitempty"`
+	Lang        string     `json:"lang,omitempty"`
+	Collection  string     `json:"collection,omitempty"`
+	Tags        []string   `json:"tags"`
+	Aliases     []string   `json:"aliases,omitempty"`
+	Excerpt     string     `json:"excerpt,omitempty"`
+}
+
+// Write a site.json file to the target dir, describing the site pages and posts, their urls,
+// collections and tags, for external tools like search indexers to consume without parsing the html.
+// Collections are the top-level directories of the posts, e.g. blog.
+func (site *Site) writeManifest() error {
+	siteUrl := site.config.SiteUrl + site.config.BaseUrl
+	output := manifest{
+		Version:     MANIFEST_VERSION,
+		Url:         siteUrl,
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		Pages:       []manifestPage{},
+		Collections: make(map[string][]string),
+		Tags:        make(map[string][]string),
+	}
+
+	for _, templ := range site.templates {
+		if templ.IsDraft() && !site.config.IncludeDrafts {
+			continue
+		}
+		url := site.config.BaseUrl + templ.Metadata["url"].(string)
+		page := manifestPage{
+			Url:         url,
+			AbsoluteUrl: site.config.SiteUrl + url,
+			Path:        templ.Metadata["path"].(string),
+			SrcPath:     filepath.ToSlash(templ.Metadata["src_path"].(string)),
+			Type:        "page",
+			Tags:        []string{},
+			Lang:        site.pageLang(templ),
+		}
+		page.Title, _ = templ.Metadata["title"].(string)
+		if tags, ok := templ.Metadata["tags"].([]interface{}); ok {
+			for _, tag := range tags {
+				page.Tags = append(page.Tags, tag.(string))
+				output.Tags[tag.(string)] = append(output.Tags[tag.(string)], url)
+			}
+		}
+		if aliases, ok := templ.Metadata["aliases"].([]interface{}); ok {
+			for _, alias := range aliases {
+				page.Aliases = append(page.Aliases, site.config.BaseUrl+alias.(string))
+			}
+		}
+		if templ.IsPost() {
+			date := templ.Metadata["date"].(time.Time)
+			page.Type = "post"
+			page.Date = &date
+			page.Excerpt, _ = templ.Metadata["excerpt"].(string)
+			dir := strings.TrimPrefix(templ.Metadata["dir"].(string), "/")
+			if collection := strings.Split(dir, "/")[0]; collection != "." && collection != "" {
+				page.Collection = collection
+				output.Collections[collection] = append(output.Collections[collection], url)
+			}
+		}
+		output.Pages = append(output.Pages, page)
+	}
+
+	// keep the output stable across builds, sorting the pages by url and the rest as they'd be listed in the site
+	slices.SortFunc(output.Pages, func(a, b manifestPage) int {
+		return strings.Compare(a.Url, b.Url)
+	})
+	pagesByUrl := make(map[string]manifestPage)
+	for _, page := range output.Pages {
+		pagesByUrl[page.Url] = page
+	}
+	byDate := func(a, b string) int {
+		if dateA, dateB := pagesByUrl[a].Date, pagesByUrl[b].Date; dateA != nil && dateB != nil && !dateA.Equal(*dateB) {
+			return dateB.Compare(*dateA)
+		}
+		return strings.Compare(a, b)
+	}
+	for _, urls := range output.Collections {
+		slices.SortFunc(urls, byDate)
+	}
+	for _, urls := range output.Tags {
+		slices.SortFunc(urls, byDate)
+	}
+
+	content, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+	targetPath := filepath.Join(site.config.TargetDir, "site.json")
+	return site.writeToFile(targetPath, bytes.NewReader(content))
+}
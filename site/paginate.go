@@ -0,0 +1,226 @@
+package site
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+const DEFAULT_PER_PAGE = 10
+
+// Split the items of the templates that declare a `paginate` front matter key into pages,
+// preparing a template for each page with a `paginator` variable in its context. E.g.:
+//
+//	paginate:
+//	  collection: tags.software   # posts (default), pages or tags.<name>
+//	  per_page: 5
+//	  path: /blog/software/page/:num
+//	  where:
+//	    lang: es
+//	  json: true
+//
+// The first page is rendered at the template's regular location, the rest at the given path
+// (which defaults to `page/:num` relative to the template).
+// Items that have a `weight` key in their front matter are sorted by it and placed first.
+// If `json` is enabled, a JSON chunk with the items metadata is written next to each page,
+// e.g. at /page/2/index.json, to support infinite scrolling.
+func (site *Site) paginateTemplates() error {
+	for path, templ := range site.templates {
+		settings, ok := templ.Metadata["paginate"]
+		if !ok {
+			continue
+		}
+
+		pages, err := site.paginate(templ, settings)
+		if err != nil {
+			return fmt.Errorf("invalid paginate settings in %s: %w", path, err)
+		}
+		site.paginated[path] = pages
+	}
+	return nil
+}
+
+func (site *Site) paginate(templ *markup.Template, settings interface{}) ([]*markup.Template, error) {
+	options, ok := settings.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map of options")
+	}
+
+	collection := "posts"
+	if name, ok := options["collection"]; ok {
+		collection = fmt.Sprint(name)
+	}
+	items, err := site.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if where, ok := options["where"].(map[string]interface{}); ok {
+		items = slices.DeleteFunc(items, func(item map[string]interface{}) bool {
+			for key, value := range where {
+				if fmt.Sprint(item[key]) != fmt.Sprint(value) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	slices.SortStableFunc(items, compareWeights)
+
+	perPage := DEFAULT_PER_PAGE
+	if value, ok := options["per_page"]; ok {
+		perPage, ok = value.(int)
+		if !ok || perPage < 1 {
+			return nil, fmt.Errorf("per_page should be a positive integer")
+		}
+	}
+
+	pathPattern := "/" + filepath.Join(filepath.Dir(templ.Metadata["path"].(string)), "page", ":num")
+	if value, ok := options["path"]; ok {
+		pathPattern = fmt.Sprint(value)
+	}
+	if !strings.Contains(pathPattern, ":num") {
+		return nil, fmt.Errorf("path should include a :num placeholder")
+	}
+
+	emitJson, _ := options["json"].(bool)
+	totalPages := max(1, (len(items)+perPage-1)/perPage)
+
+	// the first page goes at the template location, the rest follow the path pattern
+	paths := []string{templ.Metadata["path"].(string)}
+	for num := 2; num <= totalPages; num++ {
+		path := strings.TrimPrefix(strings.ReplaceAll(pathPattern, ":num", strconv.Itoa(num)), "/")
+		if filepath.Ext(path) == "" {
+			path = filepath.Join(path, "index.html")
+		}
+		paths = append(paths, prettyTargetPath(path))
+	}
+
+	pages := make([]*markup.Template, totalPages)
+	for i := range totalPages {
+		start := i * perPage
+		end := min(start+perPage, len(items))
+
+		paginator := map[string]interface{}{
+			"items":       items[start:end],
+			"page":        i + 1,
+			"per_page":    perPage,
+			"total_items": len(items),
+			"total_pages": totalPages,
+		}
+		if i > 0 {
+			paginator["previous_page"] = i
+			paginator["previous_page_path"] = pageNumberUrl(paths[i-1])
+		}
+		if i < totalPages-1 {
+			paginator["next_page"] = i + 2
+			paginator["next_page_path"] = pageNumberUrl(paths[i+1])
+		}
+		if emitJson {
+			paginator["json_path"] = "/" + jsonChunkPath(paths[i])
+			if i > 0 {
+				paginator["previous_json_path"] = "/" + jsonChunkPath(paths[i-1])
+			}
+			if i < totalPages-1 {
+				paginator["next_json_path"] = "/" + jsonChunkPath(paths[i+1])
+			}
+		}
+
+		page := *templ
+		page.Metadata = maps.Clone(templ.Metadata)
+		page.Metadata["path"] = paths[i]
+		page.Metadata["url"] = targetPathToUrl(paths[i])
+		page.Metadata["paginator"] = paginator
+		pages[i] = &page
+	}
+	return pages, nil
+}
+
+// Return a copy of the site collection with the given name.
+func (site *Site) collection(name string) ([]map[string]interface{}, error) {
+	switch {
+	case name == "posts":
+		return slices.Clone(site.posts), nil
+	case name == "pages":
+		return slices.Clone(site.pages), nil
+	case strings.HasPrefix(name, "tags."):
+		return slices.Clone(site.tags[strings.TrimPrefix(name, "tags.")]), nil
+	}
+	return nil, fmt.Errorf("unknown collection '%s'", name)
+}
+
+// Sort items with a `weight` first, in ascending order, leaving the rest as is.
+func compareWeights(a map[string]interface{}, b map[string]interface{}) int {
+	aweight, aok := a["weight"].(int)
+	bweight, bok := b["weight"].(int)
+	switch {
+	case aok && bok:
+		return aweight - bweight
+	case aok:
+		return -1
+	case bok:
+		return 1
+	}
+	return 0
+}
+
+// Return the target path of the JSON chunk for the paginated page at the given target path.
+func jsonChunkPath(targetPath string) string {
+	return strings.TrimSuffix(targetPath, filepath.Ext(targetPath)) + ".json"
+}
+
+// If enabled, write the JSON chunk with the metadata of the items in the given paginated page.
+func (site *Site) writeJsonChunk(page *markup.Template) error {
+	paginator, ok := page.Metadata["paginator"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if _, ok := paginator["json_path"]; !ok {
+		return nil
+	}
+
+	items := []map[string]interface{}{}
+	for _, item := range paginator["items"].([]map[string]interface{}) {
+		// leave out the rendered content and nested pages
+		item = maps.Clone(item)
+		delete(item, "content")
+		delete(item, "previous")
+		delete(item, "next")
+		delete(item, "paginator")
+		items = append(items, item)
+	}
+
+	chunk := map[string]interface{}{
+		"page":               paginator["page"],
+		"per_page":           paginator["per_page"],
+		"total_items":        paginator["total_items"],
+		"total_pages":        paginator["total_pages"],
+		"previous_page_path": paginator["previous_json_path"],
+		"next_page_path":     paginator["next_json_path"],
+		"items":              items,
+	}
+	content, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+
+	targetPath := filepath.Join(site.config.TargetDir, jsonChunkPath(page.Metadata["path"].(string)))
+	return site.writeToFile(targetPath, bytes.NewReader(content))
+}
+
+// Return the url of the paginated page at the given target path. The first page of the root index
+// is served at the site root.
+func pageNumberUrl(targetPath string) string {
+	if targetPath == "index.html" {
+		return "/"
+	}
+	return targetPathToUrl(targetPath)
+}
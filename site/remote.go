@@ -0,0 +1,110 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+// The path the dev server loads remote assets through, followed by their url,
+// e.g. /_proxy/https://example.com/photo.jpg, when the proxy_remote_assets config is set.
+const REMOTE_PROXY_PATH = "/_proxy/"
+
+// The remote urls rewritten to load through the proxy path by the builds of this process. The dev
+// server only fetches these, so it can't be used to request arbitrary urls.
+var proxiedAssets sync.Map
+
+// The directory, relative to the target, where remote assets are downloaded to
+// when the localize_remote_assets config is set.
+const REMOTE_ASSETS_DIR = "assets/remote"
+
+// A remote asset copied to the target dir, downloaded once even if embedded in several pages.
+type remoteAsset struct {
+	once    sync.Once
+	relPath string
+	err     error
+}
+
+// Return the url to load the given remote asset from, according to the site config, or false
+// to keep the remote url, e.g. if it couldn't be downloaded.
+func (site *Site) remoteAssetUrl(assetUrl string) (string, bool) {
+	if site.config.ProxyRemoteAssets {
+		proxiedAssets.Store(assetUrl, true)
+		return REMOTE_PROXY_PATH + assetUrl, true
+	}
+
+	relPath, err := site.localizeRemoteAsset(assetUrl)
+	if err != nil {
+		fmt.Printf("couldn't download %s, keeping the remote url: %s\n", assetUrl, err)
+		return "", false
+	}
+	return site.config.BaseUrl + "/" + relPath, true
+}
+
+// Return true if the given remote url was rewritten to load through the proxy path by a site build.
+func IsProxiedAsset(assetUrl string) bool {
+	_, found := proxiedAssets.Load(assetUrl)
+	return found
+}
+
+// Copy the given remote asset, from the cache if possible, to the remote assets dir of the target
+// and return its path relative to the target.
+func (site *Site) localizeRemoteAsset(assetUrl string) (string, error) {
+	site.remoteAssetsMutex.Lock()
+	asset, found := site.remoteAssets[assetUrl]
+	if !found {
+		asset = &remoteAsset{}
+		site.remoteAssets[assetUrl] = asset
+	}
+	site.remoteAssetsMutex.Unlock()
+
+	asset.once.Do(func() {
+		cachePath, contentType, err := markup.FetchRemoteAsset(assetUrl)
+		if err != nil {
+			asset.err = err
+			return
+		}
+		key := sha256.Sum256([]byte(assetUrl))
+		asset.relPath = path.Join(REMOTE_ASSETS_DIR, hex.EncodeToString(key[:8])+remoteAssetExt(assetUrl, contentType))
+		asset.err = site.copyRemoteAsset(cachePath, asset.relPath)
+	})
+	return asset.relPath, asset.err
+}
+
+func (site *Site) copyRemoteAsset(cachePath string, relPath string) error {
+	targetPath := filepath.Join(site.config.TargetDir, filepath.FromSlash(relPath))
+	if _, err := os.Stat(targetPath); err == nil {
+		// already copied in a previous build of the dev server
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), DIR_RWE_MODE); err != nil {
+		return err
+	}
+	file, err := os.Open(cachePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return site.writeToFile(targetPath, file)
+}
+
+// Return the extension of the asset file, from its url or else from its content type.
+func remoteAssetExt(assetUrl string, contentType string) string {
+	if parsed, err := url.Parse(assetUrl); err == nil {
+		if ext := path.Ext(parsed.Path); ext != "" && len(ext) <= 6 {
+			return ext
+		}
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
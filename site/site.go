@@ -2,12 +2,17 @@ package site
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"maps"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"slices"
 	"strings"
@@ -22,37 +27,87 @@ import (
 const FILE_RW_MODE = 0666
 const DIR_RWE_MODE = 0777
 
-type site struct {
+// appended to the target dir to get the directory where the site is built before replacing it
+const STAGING_SUFFIX = ".tmp"
+
+// appended to the target dir to get the directory where the previous output is moved while replacing it
+const PREVIOUS_SUFFIX = ".old"
+
+type Site struct {
 	config       config.Config
 	layouts      map[string]markup.Template
 	posts        []map[string]interface{}
 	pages        []map[string]interface{}
 	static_files []map[string]interface{}
 	tags         map[string][]map[string]interface{}
-	data         map[string]interface{}
+	// the url of the page each alias redirects to, by alias
+	aliases map[string]string
+	data    map[string]interface{}
+	// the pages by directory, see buildTree
+	tree map[string]interface{}
 
 	templateEngine *markup.Engine
 	templates      map[string]*markup.Template
+	// the paths of the posts relative to the src dir, by file name without extension, to resolve post_url tags
+	postPaths map[string][]string
+
+	// the per-page templates of paginated templates, by source path
+	paginated map[string][]*markup.Template
+
+	// the layouts each template was last rendered with, by template path.
+	// used to find out which pages need to be rendered again when a layout changes
+	layoutDeps  map[string][]string
+	layoutMutex sync.Mutex
+
+	// the front matter of each template as found in its source file, before adding the computed keys
+	frontMatter map[string]map[string]interface{}
+	// the src files used in the output of other pages, e.g. embedded pages, island scripts and images,
+	// which can't be rebuilt on their own when they change
+	referenced      map[string]bool
+	referencedMutex sync.Mutex
+
+	// the remote assets downloaded to the target, by url
+	remoteAssets      map[string]*remoteAsset
+	remoteAssetsMutex sync.Mutex
+
+	// the files of the static dir, by path, with their path relative to it
+	passthrough map[string]string
+	// the org-attach directories of the org pages, whose files are copied next to the pages that link them
+	attachmentDirs []string
+
+	// when building only committed posts, the files tracked by git, by path relative to the src dir
+	committedFiles map[string]bool
+	// when the updated_from_git config is set, the date of the last commit of each src file, by relative path
+	lastModified map[string]time.Time
+
+	// while building to a staging dir, the target dir where the output will be moved to
+	outputDir string
+
+	// the size in bytes of the rendered content of each page, by target path relative to the target dir
+	pageSizes      map[string]int
+	pageSizesMutex sync.Mutex
 
 	minifier markup.Minifier
+	// runs the external commands, e.g. diagram renderers and custom filters, bound to the build in progress
+	commands *markup.CommandRunner
 }
 
 // Load the site project pointed by `config`, then walk `config.SrcDir`
 // and recreate it at `config.TargetDir` by rendering template files and copying static ones.
 // The previous target dir contents are deleted.
 func Build(config config.Config) error {
-	site, err := load(config)
+	site, err := Load(config)
 	if err != nil {
 		return err
 	}
 
-	return site.build()
+	return site.Build()
 }
 
 // Parse and render the given liquid expression, eg. " site.posts | map:title "
 // and return the results as a json string.
 func EvalMetadata(config config.Config, expression string) (string, error) {
-	site, err := load(config)
+	site, err := Load(config)
 	if err != nil {
 		return "", err
 	}
@@ -61,14 +116,51 @@ func EvalMetadata(config config.Config, expression string) (string, error) {
 
 // Create a new site instance by scanning the project directories
 // pointed by `config`, loading layouts, templates and data files.
-func load(config config.Config) (*site, error) {
-	site := site{
+func Load(config config.Config) (*Site, error) {
+	return LoadContext(context.Background(), config)
+}
+
+// Like Load, but stops loading templates if the given context is canceled.
+func LoadContext(ctx context.Context, config config.Config) (*Site, error) {
+	site := Site{
 		layouts:        make(map[string]markup.Template),
 		templates:      make(map[string]*markup.Template),
+		postPaths:      make(map[string][]string),
+		paginated:      make(map[string][]*markup.Template),
+		layoutDeps:     make(map[string][]string),
+		frontMatter:    make(map[string]map[string]interface{}),
+		referenced:     make(map[string]bool),
+		pageSizes:      make(map[string]int),
+		passthrough:    make(map[string]string),
+		remoteAssets:   make(map[string]*remoteAsset),
 		config:         config,
 		tags:           make(map[string][]map[string]interface{}),
+		aliases:        make(map[string]string),
 		data:           make(map[string]interface{}),
 		templateEngine: markup.NewEngine(config.SiteUrl, config.IncludesDir),
+		commands:       config.CommandRunner(),
+	}
+	site.commands.SetContext(ctx)
+
+	if config.StrictVariables {
+		site.templateEngine.StrictVariables()
+	}
+
+	if config.BaseUrl != "" {
+		markup.SetBaseUrl(site.templateEngine, config.SiteUrl, config.BaseUrl)
+	}
+	markup.LoadShortcodes(site.templateEngine, config.ShortcodesDir)
+	site.loadLinkTags()
+	site.loadPageTag()
+	site.loadIslandTag()
+	site.loadSiteMapTag()
+
+	if err := markup.LoadCustomHelpers(site.templateEngine, config.CustomFilters, config.CustomTags, site.commands); err != nil {
+		return nil, err
+	}
+
+	if err := site.loadHighlightThemes(); err != nil {
+		return nil, err
 	}
 
 	if err := site.loadDataFiles(); err != nil {
@@ -79,7 +171,24 @@ func load(config config.Config) (*site, error) {
 		return nil, err
 	}
 
-	if err := site.loadTemplates(); err != nil {
+	if config.CommittedOnly {
+		var err error
+		if site.committedFiles, err = gitCommittedFiles(config.SrcDir); err != nil {
+			return nil, err
+		}
+	}
+	if config.UpdatedFromGit {
+		var err error
+		if site.lastModified, err = gitLastModified(config.SrcDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := site.loadTemplates(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := site.loadPassthroughFiles(); err != nil {
 		return nil, err
 	}
 
@@ -88,7 +197,7 @@ func load(config config.Config) (*site, error) {
 	return &site, nil
 }
 
-func (site *site) loadLayouts() error {
+func (site *Site) loadLayouts() error {
 	files, err := os.ReadDir(site.config.LayoutsDir)
 
 	if os.IsNotExist(err) {
@@ -110,15 +219,14 @@ func (site *site) loadLayouts() error {
 					" Ensure the file starts with '---'", filename)
 			}
 
-			layout_name := strings.TrimSuffix(filename, filepath.Ext(filename))
-			site.layouts[layout_name] = *templ
+			site.layouts[templ.Name()] = *templ
 		}
 	}
 
 	return nil
 }
 
-func (site *site) loadDataFiles() error {
+func (site *Site) loadDataFiles() error {
 	files, err := os.ReadDir(site.config.DataDir)
 
 	if os.IsNotExist(err) {
@@ -150,12 +258,20 @@ func (site *site) loadDataFiles() error {
 	return nil
 }
 
-func (site *site) loadTemplates() error {
+func (site *Site) loadTemplates(ctx context.Context) error {
 	if _, err := os.Stat(site.config.SrcDir); err != nil {
 		return fmt.Errorf("missing src directory")
 	}
 
-	err := filepath.WalkDir(site.config.SrcDir, func(path string, entry fs.DirEntry, err error) error {
+	// the post previews are rendered after the walk, since they can link to posts that aren't loaded yet
+	var previewPosts []*markup.Template
+	err := WalkSource(&site.config, site.config.SrcDir, func(path string, entry fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if site.config.IsIgnored(path, entry.IsDir()) {
+			return skipEntry(entry)
+		}
 		if !entry.IsDir() {
 			templ, err := markup.Parse(site.templateEngine, path)
 			// if something fails skip
@@ -179,25 +295,42 @@ func (site *site) loadTemplates() error {
 				return nil
 			}
 
+			if templ.SrcExt() == ".org" {
+				dirs, err := markup.OrgAttachmentDirs(templ)
+				if err != nil {
+					return err
+				}
+				site.attachmentDirs = append(site.attachmentDirs, dirs...)
+			}
+
+			site.frontMatter[path] = maps.Clone(templ.Metadata)
 			srcPath, _ := filepath.Rel(site.config.RootDir, path)
-			targetPath := strings.TrimSuffix(relPath, filepath.Ext(relPath)) + templ.TargetExt()
-			if templ.TargetExt() == ".html" && baseName != "index" {
-				targetPath = filepath.Join(strings.TrimSuffix(relPath, filepath.Ext(relPath)), "index.html")
+			targetPath, err := templateTargetPath(templ, relPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", srcPath, err)
 			}
 			templ.Metadata["src_path"] = srcPath
 			templ.Metadata["path"] = targetPath
-			templ.Metadata["url"] = "/" + strings.TrimSuffix(strings.TrimSuffix(targetPath, "/index.html"), ".html")
+			templ.Metadata["url"] = targetPathToUrl(targetPath)
 			templ.Metadata["dir"] = "/" + filepath.Dir(relPath)
 			templ.Metadata["slug"] = filepath.Base(templ.Metadata["url"].(string))
 
+			if templ.IsPost() && site.committedFiles != nil && !site.committedFiles[relPath] {
+				fmt.Println("skipping uncommitted post", srcPath)
+				templ.Metadata["draft"] = true
+			}
+			if templ.IsPost() {
+				site.postPaths[baseName] = append(site.postPaths[baseName], relPath)
+			}
+
 			// if drafts are disabled, exclude from posts, page and tags indexes, but not from site.templates
 			// we want to explicitly exclude the template from the target, rather than treating it as a non template file
 			if !templ.IsDraft() || site.config.IncludeDrafts {
 				// posts are templates that can be chronologically sorted --that have a date.
 				// the rest are pages.
 				if templ.IsPost() {
-
-					templ.Metadata["content"], templ.Metadata["excerpt"] = getPreviewContent(templ)
+					site.addFeedMetadata(templ, relPath)
+					previewPosts = append(previewPosts, templ)
 					site.posts = append(site.posts, templ.Metadata)
 
 					// also add to tags index
@@ -222,6 +355,13 @@ func (site *site) loadTemplates() error {
 	if err != nil {
 		return err
 	}
+	for _, templ := range previewPosts {
+		templ.Metadata["content"], templ.Metadata["excerpt"] = getPreviewContent(templ, site.config.ExcerptWords, site.config.BaseUrl)
+	}
+	// the attachments are published along with the pages that link them, not as static files
+	site.static_files = slices.DeleteFunc(site.static_files, func(file map[string]interface{}) bool {
+		return site.isAttachment(filepath.Join(site.config.SrcDir, file["path"].(string)))
+	})
 
 	// sort by reverse chronological order when date is present
 	// otherwise by path alphabetical
@@ -243,11 +383,17 @@ func (site *site) loadTemplates() error {
 	// populate previous and next in template index
 	site.addPrevNext(site.pages)
 	site.addPrevNext(site.posts)
+	site.addTranslations()
+	site.addTextDirection()
+	if err := site.loadAliases(); err != nil {
+		return err
+	}
+	site.tree = site.buildTree()
 
-	return nil
+	return site.paginateTemplates()
 }
 
-func (site *site) addPrevNext(posts []map[string]interface{}) {
+func (site *Site) addPrevNext(posts []map[string]interface{}) {
 	for i, post := range posts {
 		path := filepath.Join(site.config.RootDir, post["src_path"].(string))
 
@@ -271,23 +417,69 @@ func (site *site) addPrevNext(posts []map[string]interface{}) {
 
 // Walk the `site.Config.SrcDir` directory and reproduce it at `site.Config.TargetDir`,
 // rendering template files and copying static ones.
-func (site *site) build() error {
-	// clear previous target contents
-	os.RemoveAll(site.config.TargetDir)
+// The site is built in a separate directory that replaces the target one only if there were no errors,
+// so a failed build leaves the previous output in place.
+func (site *Site) Build() error {
+	return site.BuildContext(context.Background())
+}
+
+// Like Build, but stops building if the given context is canceled, in which case
+// the previous target contents are kept.
+func (site *Site) BuildContext(ctx context.Context) error {
+	targetDir := site.config.TargetDir
+	stagingDir := targetDir + STAGING_SUFFIX
+	os.RemoveAll(stagingDir)
+
+	site.config.TargetDir = stagingDir
+	site.outputDir = targetDir
+	err := site.buildTo(ctx)
+	site.config.TargetDir = targetDir
+	site.outputDir = ""
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		return err
+	}
+
+	// replace the previous target contents. Moving them aside instead of removing them first
+	// leaves the target missing only between the renames, so the dev server never serves a partial site
+	previousDir := targetDir + PREVIOUS_SUFFIX
+	os.RemoveAll(previousDir)
+	if err := os.Rename(targetDir, previousDir); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(stagingDir)
+		return err
+	}
+	if err := os.Rename(stagingDir, targetDir); err != nil {
+		// put the previous output back
+		os.Rename(previousDir, targetDir)
+		os.RemoveAll(stagingDir)
+		return err
+	}
+	return os.RemoveAll(previousDir)
+}
+
+// Build the site at the current `site.Config.TargetDir`, returning the errors of all failed files.
+func (site *Site) buildTo(ctx context.Context) error {
+	if err := os.MkdirAll(site.config.TargetDir, DIR_RWE_MODE); err != nil {
+		return err
+	}
 
-	wg, files := spawnBuildWorkers(site)
-	defer wg.Wait()
-	defer close(files)
+	workers := spawnBuildWorkers(ctx, site)
 
 	// walk the source directory, creating directories and files at the target dir
-	return filepath.WalkDir(site.config.SrcDir, func(path string, entry fs.DirEntry, err error) error {
+	err := WalkSource(&site.config, site.config.SrcDir, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if strings.HasPrefix(filepath.Base(path), ".") {
-			// skip dot files and directories
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if strings.HasPrefix(filepath.Base(path), ".") && !site.config.IsIncluded(path, entry.IsDir()) {
+			// skip dot files and directories, unless explicitly included
 			return nil
 		}
+		if site.config.IsIgnored(path, entry.IsDir()) {
+			return skipEntry(entry)
+		}
 		subpath, _ := filepath.Rel(site.config.SrcDir, path)
 		targetPath := filepath.Join(site.config.TargetDir, subpath)
 
@@ -295,46 +487,241 @@ func (site *site) build() error {
 		if entry.IsDir() {
 			return os.MkdirAll(targetPath, DIR_RWE_MODE)
 		}
+		if _, isTemplate := site.templates[path]; !isTemplate && site.isAttachment(path) {
+			// copied by the pages that link it, see copyAttachments
+			return nil
+		}
 		// if it's a file (either static or template) send the path to a worker to build in target
-		files <- path
+		workers.files <- path
 		return nil
 	})
+	if err == nil {
+		err = site.sendPassthroughFiles(ctx, workers)
+	}
+	if buildErr := workers.wait(); buildErr != nil {
+		return buildErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := site.writeHighlightStylesheet(); err != nil {
+		return err
+	}
+	if site.config.Manifest {
+		if err := site.writeManifest(); err != nil {
+			return err
+		}
+	}
+	if err := site.writeAliasRedirects(); err != nil {
+		return err
+	}
+	return site.writeLanguageRedirect()
+}
+
+// Reload the site layouts and render again the pages affected by changes in the given layout
+// or include files, without reloading the rest of the site from disk.
+// Since there's no tracking of what includes are used by each template, a change in an include
+// file, or the addition or removal of a layout, will cause all pages to be rendered again.
+func (site *Site) ReloadLayouts(ctx context.Context, changedPaths []string) error {
+	previous := site.layouts
+	site.layouts = make(map[string]markup.Template)
+	if err := site.loadLayouts(); err != nil {
+		return err
+	}
+
+	changedLayouts := make(map[string]bool)
+	renderAll := false
+	for _, path := range changedPaths {
+		if filepath.Dir(path) != filepath.Clean(site.config.LayoutsDir) {
+			renderAll = true
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		_, existed := previous[name]
+		_, exists := site.layouts[name]
+		if existed != exists {
+			// new layouts can change the fallback of pages without an explicit layout
+			renderAll = true
+		}
+		changedLayouts[name] = true
+	}
+
+	affected := []string{}
+	site.layoutMutex.Lock()
+	for path := range site.templates {
+		dependsOnChanged := slices.ContainsFunc(site.layoutDeps[path], func(layout string) bool {
+			return changedLayouts[layout]
+		})
+		if renderAll || dependsOnChanged {
+			affected = append(affected, path)
+		}
+	}
+	site.layoutMutex.Unlock()
+
+	workers := spawnBuildWorkers(ctx, site)
+	for _, path := range affected {
+		workers.files <- path
+	}
+	return workers.wait()
+}
+
+// Returned by ReloadFiles when the changes can affect other files, so the whole site needs to be loaded again.
+var ErrReloadAll = errors.New("the changes require reloading the site")
+
+// Render again the templates and copy the static files at the given paths, without reloading the rest
+// of the site from disk. Returns ErrReloadAll if the changes could affect other outputs: when files
+// are added or removed, posts change (since they are listed in other pages), the front matter of
+// a page changes or the file is used by other pages (see Site.addReference).
+func (site *Site) ReloadFiles(ctx context.Context, changedPaths []string) error {
+	changed := make(map[string]*markup.Template)
+	for _, path := range changedPaths {
+		if _, found := site.passthrough[path]; found {
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				return ErrReloadAll
+			}
+			if !site.config.LinkStatic {
+				changed[path] = nil
+			}
+			continue
+		}
+		relPath, err := filepath.Rel(site.config.SrcDir, path)
+		if err != nil || !filepath.IsLocal(relPath) || site.isReferenced(path) {
+			return ErrReloadAll
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return ErrReloadAll
+		}
+
+		templ, err := markup.Parse(site.templateEngine, path)
+		if err != nil {
+			return err
+		}
+		previous, wasTemplate := site.templates[path]
+		if !wasTemplate {
+			isStatic := slices.ContainsFunc(site.static_files, func(file map[string]interface{}) bool {
+				return file["path"] == relPath
+			})
+			if templ != nil || !isStatic {
+				return ErrReloadAll
+			}
+			if !site.config.LinkStatic {
+				// linked static files are already up to date
+				changed[path] = nil
+			}
+			continue
+		}
+
+		_, paginated := site.paginated[path]
+		if templ == nil || paginated || previous.IsPost() || templ.IsPost() ||
+			!reflect.DeepEqual(templ.Metadata, site.frontMatter[path]) {
+			return ErrReloadAll
+		}
+		// the front matter didn't change, so the computed metadata, shared with other pages, is still valid
+		templ.Metadata = previous.Metadata
+		changed[path] = templ
+	}
+
+	for path, templ := range changed {
+		if templ != nil {
+			site.templates[path] = templ
+		}
+	}
+	workers := spawnBuildWorkers(ctx, site)
+	for path := range changed {
+		workers.files <- path
+	}
+	return workers.wait()
+}
+
+func (site *Site) recordPageSize(path string, size int) {
+	site.pageSizesMutex.Lock()
+	site.pageSizes[path] = size
+	site.pageSizesMutex.Unlock()
+}
+
+// Return the size in bytes of the rendered content of the pages built so far, by target path,
+// before minifying and other post-processing.
+func (site *Site) PageSizes() map[string]int {
+	site.pageSizesMutex.Lock()
+	defer site.pageSizesMutex.Unlock()
+	return maps.Clone(site.pageSizes)
+}
+
+// Register that the given src file is used in the output of other pages.
+func (site *Site) addReference(path string) {
+	site.referencedMutex.Lock()
+	site.referenced[filepath.Clean(path)] = true
+	site.referencedMutex.Unlock()
 }
 
-// Create a channel to send paths to build and a worker pool to handle them concurrently
-func spawnBuildWorkers(site *site) (*sync.WaitGroup, chan string) {
+func (site *Site) isReferenced(path string) bool {
+	site.referencedMutex.Lock()
+	defer site.referencedMutex.Unlock()
+	return site.referenced[filepath.Clean(path)]
+}
 
-	var wg sync.WaitGroup
-	files := make(chan string, 20)
+// A pool of workers building the files sent through a channel, collecting their errors.
+type buildWorkers struct {
+	ctx    context.Context
+	files  chan string
+	wg     sync.WaitGroup
+	mutex  sync.Mutex
+	errors []error
+}
+
+// Create a channel to send paths to build and a worker pool to handle them concurrently.
+// Once the context is canceled, the remaining paths are skipped.
+func spawnBuildWorkers(ctx context.Context, site *Site) *buildWorkers {
+	workers := &buildWorkers{ctx: ctx, files: make(chan string, 20)}
+	// kill the external commands still running if the build is canceled
+	site.commands.SetContext(ctx)
 
 	for range runtime.NumCPU() {
-		wg.Add(1)
-		go func(files <-chan string) {
-			defer wg.Done()
-			for path := range files {
+		workers.wg.Add(1)
+		go func() {
+			defer workers.wg.Done()
+			for path := range workers.files {
+				if ctx.Err() != nil {
+					continue
+				}
 				err := site.buildFile(path)
 				if err != nil {
-					fmt.Printf("error in %s: %s\n", path, err)
+					workers.mutex.Lock()
+					workers.errors = append(workers.errors, err)
+					workers.mutex.Unlock()
 				}
 			}
-		}(files)
+		}()
+	}
+	return workers
+}
+
+// Close the files channel, wait for the workers to finish and return the joined errors of the failed files.
+func (workers *buildWorkers) wait() error {
+	close(workers.files)
+	workers.wg.Wait()
+	if err := workers.ctx.Err(); err != nil {
+		return err
 	}
-	return &wg, files
+	return errors.Join(workers.errors...)
 }
 
-func (site *site) buildFile(path string) error {
+func (site *Site) buildFile(path string) error {
+	if relPath, found := site.passthrough[path]; found {
+		return site.copyPassthrough(path, relPath)
+	}
+
 	subpath, _ := filepath.Rel(site.config.SrcDir, path)
 	targetPath := filepath.Join(site.config.TargetDir, subpath)
 
-	var contentReader io.Reader
-	var err error
 	templ, found := site.templates[path]
 	if !found {
 		// if no template found at location, treat the file as static write its contents to target
 		if site.config.LinkStatic {
 			// dev optimization: link static files instead of copying them
 			abs, _ := filepath.Abs(path)
-			err = os.Symlink(abs, targetPath)
+			err := os.Symlink(abs, targetPath)
 			return checkFileError(err)
 		}
 
@@ -343,79 +730,328 @@ func (site *site) buildFile(path string) error {
 			return checkFileError(err)
 		}
 		defer srcFile.Close()
-		contentReader = srcFile
-	} else {
-		if templ.IsDraft() && !site.config.IncludeDrafts {
-			fmt.Println("skipping draft", targetPath)
-			return nil
-		}
+		return site.writeOutput(nil, subpath, targetPath, srcFile)
+	}
+
+	if templ.IsDraft() && !site.config.IncludeDrafts {
+		fmt.Println("skipping draft", site.outputPath(targetPath))
+		return nil
+	}
 
-		content, err := site.render(templ)
+	// paginated templates produce one output file per page
+	pages, paginated := site.paginated[path]
+	if !paginated {
+		pages = []*markup.Template{templ}
+	}
+	for _, page := range pages {
+		content, attachments, err := site.renderPage(page)
 		if err != nil {
 			return err
 		}
 
-		targetPath = strings.TrimSuffix(targetPath, filepath.Ext(targetPath)) + templ.TargetExt()
-		contentReader = bytes.NewReader(content)
+		targetPath = filepath.Join(site.config.TargetDir, page.Metadata["path"].(string))
+		site.recordPageSize(page.Metadata["path"].(string), len(content))
+		// catch broken feeds and data files before publishing them
+		if err := markup.ValidateOutput(content, filepath.Ext(targetPath)); err != nil {
+			return &markup.TemplateError{Path: page.SrcPath, Err: err}
+		}
+		if filepath.Ext(targetPath) == ".html" {
+			site.checkSocialImages(page, targetPath, content)
+		}
+		if err := site.writeOutput(page, subpath, targetPath, bytes.NewReader(content)); err != nil {
+			return err
+		}
+		// only publish the attachments of pages that rendered successfully
+		if err := site.copyAttachments(page, attachments); err != nil {
+			return err
+		}
+		if err := site.writeJsonChunk(page); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// Post-process the given content according to the target extension and site config,
+// and write it to the target path. `templ` is nil for static files.
+func (site *Site) writeOutput(templ *markup.Template, subpath string, targetPath string, contentReader io.Reader) error {
+	var err error
 	targetExt := filepath.Ext(targetPath)
 
-	// arrange paths to ensure pretty uris, eg move blog/tags.html to blog/tags/index.html
-	if targetExt == ".html" && filepath.Base(targetPath) != "index.html" {
-		targetDir := strings.TrimSuffix(targetPath, ".html")
-		targetPath = filepath.Join(targetDir, "index.html")
-		err = os.MkdirAll(targetDir, DIR_RWE_MODE)
+	if templ == nil {
+		// template paths are already resolved
+		targetPath = prettyTargetPath(targetPath)
+	}
+	err = os.MkdirAll(filepath.Dir(targetPath), DIR_RWE_MODE)
+	if err != nil {
+		return err
+	}
+
+	// post process file acording to extension and config
+	if site.config.SmartPunctuation && !site.usesTypographer(templ) {
+		contentReader, err = markup.Smartify(targetExt, contentReader)
 		if err != nil {
 			return err
 		}
 	}
-
-	// post process file acording to extension and config
-	contentReader, err = markup.Smartify(targetExt, contentReader)
-	if err != nil {
-		return err
+	if targetExt == ".html" && (site.config.ExternalLinkRel != "" || site.config.ExternalLinkNewTab) {
+		contentReader, err = markup.MarkExternalLinks(contentReader, site.config.SiteUrl, site.config.ExternalLinkRel, site.config.ExternalLinkNewTab)
+		if err != nil {
+			return err
+		}
 	}
-	contentReader, err = site.injectLiveReload(targetExt, contentReader)
-	if err != nil {
-		return err
+	if templ != nil && targetExt == ".html" && site.config.AliasLinks && templ.Metadata["aliases"] != nil {
+		contentReader, err = markup.InjectHeadLinks(contentReader, "alternate", site.aliasLinks(templ))
+		if err != nil {
+			return err
+		}
+	}
+	if targetExt == ".html" && len(site.config.ScrollWrappers) > 0 {
+		contentReader, err = markup.WrapOverflow(contentReader, site.config.ScrollWrappers)
+		if err != nil {
+			return err
+		}
+	}
+	if templ != nil && targetExt == ".html" && (site.config.ProxyRemoteAssets || site.config.LocalizeRemoteAssets) {
+		contentReader, err = markup.RewriteRemoteAssets(contentReader, site.config.SiteUrl, site.remoteAssetUrl)
+		if err != nil {
+			return err
+		}
+	}
+	if templ != nil && targetExt == ".html" && site.imageAttributesEnabled(templ) {
+		contentReader, err = markup.AddImageAttributes(contentReader, func(src string) (int, int, bool) {
+			return site.imageDimensions(targetPath, src)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if targetExt == ".html" && len(site.config.UrlRewrites) > 0 {
+		// after the other steps, which may need the local urls, e.g. to read image dimensions
+		contentReader, err = markup.RewriteUrls(contentReader, site.config.RewriteUrl)
+		if err != nil {
+			return err
+		}
 	}
 	if site.config.Minify {
 		contentReader = site.minifier.Minify(subpath, contentReader)
 	}
 
 	// write the file contents over to target
-	return writeToFile(targetPath, contentReader)
+	return site.writeToFile(targetPath, contentReader)
 }
 
-func (site *site) render(templ *markup.Template) ([]byte, error) {
+func (site *Site) render(templ *markup.Template) ([]byte, error) {
+	content, _, err := site.renderPage(templ)
+	return content, err
+}
+
+// Render the given template with its layouts, returning the files referenced by its org attachment links,
+// by their path relative to the output directory of the page, to be copied once the page is written.
+func (site *Site) renderPage(templ *markup.Template) ([]byte, map[string]string, error) {
 	ctx := site.AsContext()
 
 	ctx["page"] = templ.Metadata
-	content, err := templ.RenderWith(ctx, site.config.HighlightTheme)
+	if paginator, ok := templ.Metadata["paginator"]; ok {
+		ctx["paginator"] = paginator
+	}
+
+	// the inheritance state is shared across the layout chain to resolve {% block %} overrides
+	inheritance := markup.NewInheritance()
+	ctx[markup.INHERITANCE_KEY] = inheritance
+	inheritance.Parent = site.pageLayout(templ)
+	options := site.renderOptions(templ)
+	if templ.SrcExt() == ".org" {
+		options.Attachments = make(map[string]string)
+	}
+	content, sections, err := templ.RenderSections(ctx, options)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if content, err = resolveBundleLinks(templ, content, site.config.BaseUrl); err != nil {
+		return nil, nil, err
+	}
+	if sections != nil {
+		// the page metadata is shared with other pages being rendered concurrently, so use a copy
+		page := maps.Clone(templ.Metadata)
+		page["sections"] = sections
+		ctx["page"] = page
 	}
 
 	// recursively render parent layouts
-	layout := templ.Metadata["layout"]
-	for layout != nil && err == nil {
-		if layout_templ, ok := site.layouts[layout.(string)]; ok {
+	lang := site.pageLang(templ)
+	layout := inheritance.Parent
+	usedLayouts := []string{}
+	for layout != "" && err == nil {
+		if layout_templ, ok := site.findLayout(layout, lang); ok {
+			usedLayouts = append(usedLayouts, layout_templ.Name())
 			ctx["layout"] = layout_templ.Metadata
 			ctx["content"] = content
-			content, err = layout_templ.RenderWith(ctx, site.config.HighlightTheme)
+			inheritance.Parent = layoutName(&layout_templ)
+			content, err = layout_templ.RenderWith(ctx, site.renderOptions(templ))
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			layout = layout_templ.Metadata["layout"]
+			layout = inheritance.Parent
 		} else {
-			return nil, fmt.Errorf("layout '%s' not found", layout)
+			return nil, nil, fmt.Errorf("layout '%s' not found", layout)
+		}
+	}
+
+	site.layoutMutex.Lock()
+	site.layoutDeps[templ.SrcPath] = usedLayouts
+	site.layoutMutex.Unlock()
+
+	return content, options.Attachments, nil
+}
+
+// The layout front matter value that selects the layout by collection, see pageLayout.
+const AUTO_LAYOUT = "auto"
+
+// Return the name of the layout declared in the template front matter, if any.
+func layoutName(templ *markup.Template) string {
+	if layout, ok := templ.Metadata["layout"]; ok && layout != nil {
+		return layout.(string)
+	}
+	return ""
+}
+
+// Return the name of the layout the given page should be rendered with.
+// With `layout: auto` in the front matter of org and markdown files, or no `layout` key when the
+// layout_fallback config is set, look for a layout matching the page collection (its top-level
+// directory), then `post` or `page`, then `default`.
+// Use `layout: null` to skip the fallback and render the page without layout.
+func (site *Site) pageLayout(templ *markup.Template) string {
+	layout, declared := templ.Metadata["layout"]
+	if declared && layout != AUTO_LAYOUT {
+		return layoutName(templ)
+	}
+	if !declared && !site.config.LayoutFallback {
+		return ""
+	}
+	if templ.SrcExt() != ".org" && templ.SrcExt() != ".md" {
+		return ""
+	}
+
+	candidates := []string{}
+	dir := strings.TrimPrefix(templ.Metadata["dir"].(string), "/")
+	if collection := strings.Split(dir, "/")[0]; collection != "." && collection != "" {
+		candidates = append(candidates, collection)
+	}
+	if templ.IsPost() {
+		candidates = append(candidates, "post")
+	} else {
+		candidates = append(candidates, "page")
+	}
+	candidates = append(candidates, "default")
+
+	lang := site.pageLang(templ)
+	for _, name := range candidates {
+		if _, ok := site.findLayout(name, lang); ok {
+			return name
 		}
 	}
+	return ""
+}
 
-	return content, nil
+// Lookup a layout by name, preferring a language-specific variant if available,
+// e.g. `post.es.html` over `post.html` for pages in spanish.
+func (site *Site) findLayout(name string, lang string) (markup.Template, bool) {
+	if layout, ok := site.layouts[name+"."+lang]; ok {
+		return layout, true
+	}
+	layout, ok := site.layouts[name]
+	return layout, ok
 }
 
-func (site *site) AsContext() map[string]interface{} {
+// Return the language of the given page, either from its front matter or the site config.
+func (site *Site) pageLang(templ *markup.Template) string {
+	if lang, ok := templ.Metadata["lang"].(string); ok {
+		return lang
+	}
+	return site.config.Lang
+}
+
+// Return the org export settings from the config, overridden by those in the template front matter.
+func (site *Site) orgOptions(templ *markup.Template) map[string]interface{} {
+	options := maps.Clone(site.config.OrgOptions)
+	if overrides, ok := templ.Metadata["org"].(map[string]interface{}); ok {
+		if options == nil {
+			options = make(map[string]interface{})
+		}
+		maps.Copy(options, overrides)
+	}
+	return options
+}
+
+// Page bundles are markdown or org index files, whose directory holds the files they link to,
+// e.g. src/blog/my-post/index.md and src/blog/my-post/photo.jpg. Since the files are copied as is,
+// resolve the links to them relative to the page directory, so they work regardless of the trailing slash
+// and where the content is included, e.g. in feeds.
+func resolveBundleLinks(templ *markup.Template, content []byte, baseUrl string) ([]byte, error) {
+	isIndex := strings.TrimSuffix(filepath.Base(templ.SrcPath), templ.SrcExt()) == "index"
+	if !isIndex || (templ.SrcExt() != ".md" && templ.SrcExt() != ".org") || templ.TargetExt() != ".html" {
+		return content, nil
+	}
+	targetPath, _ := templ.Metadata["path"].(string)
+	dir := path.Join("/", filepath.ToSlash(filepath.Dir(targetPath)))
+	return markup.ResolveRelativeUrls(content, baseUrl+strings.TrimSuffix(dir, "/")+"/")
+}
+
+// Return true if the given src file is in the org-attach directory of an org page.
+func (site *Site) isAttachment(path string) bool {
+	return slices.ContainsFunc(site.attachmentDirs, func(dir string) bool {
+		return strings.HasPrefix(path, dir+string(filepath.Separator))
+	})
+}
+
+// Copy the files referenced by org attachment links to the output directory of the given page.
+func (site *Site) copyAttachments(templ *markup.Template, attachments map[string]string) error {
+	targetDir := filepath.Dir(filepath.Join(site.config.TargetDir, templ.Metadata["path"].(string)))
+	for name, srcPath := range attachments {
+		site.addReference(srcPath)
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("invalid attachment %s in %s", name, templ.SrcPath)
+		}
+		targetPath := filepath.Join(targetDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(targetPath), DIR_RWE_MODE); err != nil {
+			return err
+		}
+		srcFile, err := os.Open(srcPath)
+		if err != nil {
+			return err
+		}
+		err = site.writeToFile(targetPath, srcFile)
+		srcFile.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (site *Site) renderOptions(templ *markup.Template) markup.RenderOptions {
+	return markup.RenderOptions{
+		Lang:             site.pageLang(templ),
+		HighlightTheme:   site.config.HighlightTheme,
+		HighlightClasses: site.config.HighlightClasses,
+		DiagramCommands:  site.config.DiagramCommands,
+		MathCommands:     site.config.MathCommands,
+		OrgOptions:       site.orgOptions(templ),
+		Typographer:      site.usesTypographer(templ),
+		Ruby:             site.config.Ruby,
+		OnFileRead:       site.addReference,
+		Commands:         site.commands,
+	}
+}
+
+// Return true if the smart punctuation of the given template is handled by the markdown converter,
+// in which case its output shouldn't go through markup.Smartify again.
+func (site *Site) usesTypographer(templ *markup.Template) bool {
+	return site.config.SmartPunctuation && site.config.MarkdownTypographer && templ != nil && templ.SrcExt() == ".md"
+}
+
+func (site *Site) AsContext() map[string]interface{} {
 	return map[string]interface{}{
 		"site": map[string]interface{}{
 			"config":       site.config.AsContext(),
@@ -424,10 +1060,132 @@ func (site *site) AsContext() map[string]interface{} {
 			"pages":        site.pages,
 			"static_files": site.static_files,
 			"data":         site.data,
+			"tree":         site.tree,
+			"aliases":      site.aliases,
 		},
 	}
 }
 
+// Image attributes are added if enabled in the config, unless the page opts out
+// with `image_attributes: false` in its front matter.
+func (site *Site) imageAttributesEnabled(templ *markup.Template) bool {
+	if enabled, ok := templ.Metadata["image_attributes"].(bool); ok {
+		return enabled
+	}
+	return site.config.ImageAttributes
+}
+
+// Return the dimensions of the local image referenced by `src` in the page at the given target path.
+func (site *Site) imageDimensions(targetPath string, src string) (int, int, bool) {
+	srcPath, ok := site.localImagePath(targetPath, src)
+	if !ok {
+		return 0, 0, false
+	}
+	site.addReference(srcPath)
+	width, height, err := markup.ImageDimensions(srcPath)
+	return width, height, err == nil
+}
+
+// Return the path in the src directory of the image referenced by `src` in the page at the given target path,
+// or false if it's not a local image. Absolute urls are considered local if they point to the site url.
+func (site *Site) localImagePath(targetPath string, src string) (string, bool) {
+	parsed, err := url.Parse(src)
+	if err != nil || parsed.Path == "" {
+		return "", false
+	}
+	if parsed.Host != "" {
+		siteUrl, err := url.Parse(site.config.SiteUrl)
+		if err != nil || parsed.Host != siteUrl.Host {
+			return "", false
+		}
+		parsed.Path = strings.TrimPrefix(parsed.Path, site.config.BaseUrl)
+	}
+
+	// the target dir mirrors the src dir, so look for the image at the same relative location
+	var relPath string
+	if strings.HasPrefix(parsed.Path, "/") {
+		relPath = parsed.Path
+	} else {
+		pageDir, _ := filepath.Rel(site.config.TargetDir, filepath.Dir(targetPath))
+		relPath = filepath.Join(pageDir, parsed.Path)
+	}
+	srcPath := filepath.Join(site.config.SrcDir, relPath)
+	if _, err := os.Stat(srcPath); err != nil {
+		if staticPath := filepath.Join(site.config.StaticDir, relPath); site.passthrough[staticPath] != "" {
+			return staticPath, true
+		}
+	}
+	return srcPath, true
+}
+
+// Return the target path explicitly set in the template front matter, or an empty string if there isn't one.
+// It can be set with a `permalink` relative to the site root, e.g. /feed.xml or /blog/ (for /blog/index.html),
+// with an `output_path` that is used as is, e.g. about/cv/index.html, unless it's a directory like about/cv/,
+// or with a `target` filename that replaces the template's own, e.g. robots.txt.
+// Fails if the path points outside of the target directory.
+func customTargetPath(templ *markup.Template, relPath string) (string, error) {
+	if permalink, ok := templ.Metadata["permalink"].(string); ok {
+		path := strings.TrimPrefix(permalink, "/")
+		if path == "" || strings.HasSuffix(path, "/") || filepath.Ext(path) == "" {
+			path = filepath.Join(path, "index.html")
+		}
+		return cleanTargetPath(path)
+	}
+	if outputPath, ok := templ.Metadata["output_path"].(string); ok && strings.Trim(outputPath, "/") != "" {
+		// joining a rooted path would drop the .. components that escape the target dir
+		outputPath = strings.TrimLeft(outputPath, "/")
+		if strings.HasSuffix(outputPath, "/") || filepath.Ext(outputPath) == "" {
+			// directories get an index file, as with permalinks
+			outputPath = filepath.Join(outputPath, "index.html")
+		}
+		return cleanTargetPath(outputPath)
+	}
+	if target, ok := templ.Metadata["target"].(string); ok {
+		return cleanTargetPath(filepath.Join(filepath.Dir(relPath), target))
+	}
+	return "", nil
+}
+
+// Clean the given path relative to the target dir, failing if it points outside of it.
+func cleanTargetPath(path string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(strings.TrimLeft(path, "/")))
+	if !filepath.IsLocal(cleaned) {
+		return "", fmt.Errorf("target path %s is outside of the target directory", path)
+	}
+	return cleaned, nil
+}
+
+// Arrange html paths to ensure pretty uris, eg blog/tags.html to blog/tags/index.html
+func prettyTargetPath(targetPath string) string {
+	if filepath.Ext(targetPath) == ".html" && filepath.Base(targetPath) != "index.html" {
+		return filepath.Join(strings.TrimSuffix(targetPath, ".html"), "index.html")
+	}
+	return targetPath
+}
+
+// Return the path relative to the target directory where the given template will be written,
+// based on its path relative to the source directory.
+func templateTargetPath(templ *markup.Template, relPath string) (string, error) {
+	targetPath, err := customTargetPath(templ, relPath)
+	if err != nil || targetPath != "" {
+		return targetPath, err
+	}
+	return prettyTargetPath(strings.TrimSuffix(relPath, filepath.Ext(relPath)) + templ.TargetExt()), nil
+}
+
+// Return the url that will serve the file at the given target path, relative to the site root.
+func targetPathToUrl(targetPath string) string {
+	return "/" + strings.TrimSuffix(strings.TrimSuffix(targetPath, "/index.html"), ".html")
+}
+
+// Return the value for a WalkDir function to skip the given entry, including its contents if it's a directory.
+func skipEntry(entry fs.DirEntry) error {
+	if entry.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
 func checkFileError(err error) error {
 	// When walking the source dir it can happen that a file is present when walking starts
 	// but missing or inaccessible when trying to open it (this is particularly frequent with
@@ -441,7 +1199,7 @@ func checkFileError(err error) error {
 	return err
 }
 
-func writeToFile(targetPath string, source io.Reader) error {
+func (site *Site) writeToFile(targetPath string, source io.Reader) error {
 	targetFile, err := os.Create(targetPath)
 	if err != nil {
 		return err
@@ -453,20 +1211,35 @@ func writeToFile(targetPath string, source io.Reader) error {
 		return err
 	}
 
-	fmt.Println("wrote", targetPath)
+	fmt.Println("wrote", site.outputPath(targetPath))
 	return targetFile.Sync()
 }
 
+// Return the location a file written at `targetPath` will have once the current build is finished.
+func (site *Site) outputPath(targetPath string) string {
+	if site.outputDir == "" {
+		return targetPath
+	}
+	subpath, err := filepath.Rel(site.config.TargetDir, targetPath)
+	if err != nil {
+		return targetPath
+	}
+	return filepath.Join(site.outputDir, subpath)
+}
+
 // Assuming the given template is a post, try to generating a preview version of its context
 // and an excerpt of it. If the metadata contains an `excerpt` key use that, use the first <p>
 // from the context preview.
-func getPreviewContent(templ *markup.Template) (string, string) {
+func getPreviewContent(templ *markup.Template, excerptWords int, baseUrl string) (string, string) {
 	// if we don't expect this to render to html don't bother parsing it
 	if templ.TargetExt() != ".html" {
 		return "", ""
 	}
 
 	content, err := templ.Render()
+	if err == nil {
+		content, err = resolveBundleLinks(templ, content, baseUrl)
+	}
 	if err != nil {
 		return "", ""
 	}
@@ -476,33 +1249,8 @@ func getPreviewContent(templ *markup.Template) (string, string) {
 	}
 
 	excerpt := markup.ExtractFirstParagraph(bytes.NewReader(content))
+	if excerptWords > 0 {
+		excerpt = markup.TruncateWords(excerpt, excerptWords)
+	}
 	return string(content), excerpt
 }
-
-// if live reload is enabled, inject the reload snippet to html files
-func (site *site) injectLiveReload(extension string, contentReader io.Reader) (io.Reader, error) {
-	if !site.config.LiveReload || extension != ".html" {
-		return contentReader, nil
-	}
-
-	const JS_SNIPPET = `
-const url = location.origin + '/_events/'
-var eventSource;
-function newSSE() {
-  console.log("connecting to server events");
-  eventSource = new EventSource(url);
-  eventSource.onmessage = function () {
-    location.reload()
-  };
-  window.onbeforeunload = function() {
-    eventSource.close();
-  }
-  eventSource.onerror = function (event) {
-    console.error('An error occurred:', event);
-    eventSource.close();
-    setTimeout(newSSE, 5000)
-  };
-}
-newSSE();`
-	return markup.InjectScript(contentReader, JS_SNIPPET)
-}
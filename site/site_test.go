@@ -1,10 +1,21 @@
 package site
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/facundoolano/jorge/config"
 )
@@ -71,7 +82,7 @@ title: about
 	content = `go away!`
 	newFile(config.SrcDir, "robots.txt", content)
 
-	site, err := load(*config)
+	site, err := Load(*config)
 
 	assertEqual(t, err, nil)
 
@@ -166,7 +177,7 @@ date: 2024-02-03
 	newFile(tutorial2, "another-entry.html", `---
 ---`)
 
-	site, err := load(*config)
+	site, err := Load(*config)
 	// helper method to map a filename to its prev next keys (if any)
 	getPrevNext := func(dir string, filename string) (interface{}, interface{}) {
 		path := filepath.Join(dir, filename)
@@ -261,7 +272,7 @@ date: 2023-01-01
 	file = newFile(config.SrcDir, "about.html", content)
 	defer os.Remove(file.Name())
 
-	site, _ := load(*config)
+	site, _ := Load(*config)
 	output, err := site.render(site.templates[file.Name()])
 	assertEqual(t, err, nil)
 	assertEqual(t, string(output), `<ul>
@@ -350,7 +361,7 @@ tags: [software]
 	file = newFile(config.SrcDir, "about.html", content)
 	defer os.Remove(file.Name())
 
-	site, _ := load(*config)
+	site, _ := Load(*config)
 	output, err := site.render(site.templates[file.Name()])
 	assertEqual(t, err, nil)
 	assertEqual(t, string(output), `<h1>software</h1>
@@ -401,7 +412,7 @@ title: "2. an oldie!"
 	file = newFile(config.SrcDir, "index.html", content)
 	defer os.Remove(file.Name())
 
-	site, _ := load(*config)
+	site, _ := Load(*config)
 	output, err := site.render(site.templates[file.Name()])
 	assertEqual(t, err, nil)
 	assertEqual(t, string(output), `<ul>
@@ -456,7 +467,7 @@ tags: [software]
 	file = newFile(config.SrcDir, "about.html", content)
 	defer os.Remove(file.Name())
 
-	site, _ := load(*config)
+	site, _ := Load(*config)
 	output, err := site.render(site.templates[file.Name()])
 	assertEqual(t, err, nil)
 	assertEqual(t, strings.TrimSpace(string(output)), `goodbye! - an overridden excerpt
@@ -503,7 +514,7 @@ excerpt: an overridden excerpt
 	file = newFile(config.SrcDir, "about.html", content)
 	defer os.Remove(file.Name())
 
-	site, _ := load(*config)
+	site, _ := Load(*config)
 	output, err := site.render(site.templates[file.Name()])
 	assertEqual(t, err, nil)
 	assertEqual(t, strings.TrimSpace(string(output)), `<h1>goodbye!</h1>
@@ -538,7 +549,7 @@ func TestRenderDataFile(t *testing.T) {
 	file = newFile(config.SrcDir, "projects.html", content)
 	defer os.Remove(file.Name())
 
-	site, _ := load(*config)
+	site, _ := Load(*config)
 	output, err := site.render(site.templates[file.Name()])
 	assertEqual(t, err, nil)
 	assertEqual(t, string(output), `<ul>
@@ -590,9 +601,9 @@ layout: base
 	newFile(config.SrcDir, "index.html", content)
 
 	// build site
-	site, err := load(*config)
+	site, err := Load(*config)
 	assertEqual(t, err, nil)
-	err = site.build()
+	err = site.Build()
 	assertEqual(t, err, nil)
 
 	// test target files generated
@@ -659,9 +670,9 @@ layout: base
 
 	// build site with drafts
 	config.IncludeDrafts = true
-	site, err := load(*config)
+	site, err := Load(*config)
 	assertEqual(t, err, nil)
-	err = site.build()
+	err = site.Build()
 	assertEqual(t, err, nil)
 
 	// test target files generated
@@ -684,9 +695,9 @@ layout: base
 
 	// build site WITHOUT drafts
 	config.IncludeDrafts = false
-	site, err = load(*config)
+	site, err = Load(*config)
 	assertEqual(t, err, nil)
-	err = site.build()
+	err = site.Build()
 	assertEqual(t, err, nil)
 
 	// test only non drafts generated
@@ -707,8 +718,1946 @@ layout: base
 </body></html>`)
 }
 
+func TestRenderLayoutBlocks(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	content := `---
+---
+<html>
+<head>{% block head %}<title>{{page.title}}</title>{% endblock %}</head>
+<body>
+<aside>{% block sidebar %}default sidebar{% endblock %}</aside>
+{{content}}
+<footer>{% block footer %}default footer{% endblock %}</footer>
+</body>
+</html>`
+	newFile(config.LayoutsDir, "base.html", content)
+
+	// a layout that extends base through the tag instead of front matter
+	content = `---
+---
+{% extends "base" %}
+{% block footer %}post footer{% endblock %}
+<article>{{content}}</article>`
+	newFile(config.LayoutsDir, "post.html", content)
+
+	content = `---
+layout: post
+title: hello
+---
+{% block sidebar %}custom sidebar{% endblock %}
+<p>Hello world!</p>`
+	file := newFile(config.SrcDir, "hello.html", content)
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+
+	output, err := site.render(site.templates[file.Name()])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html>
+<head><title>hello</title></head>
+<body>
+<aside>custom sidebar</aside>
+
+
+<article>
+<p>Hello world!</p></article>
+<footer>post footer</footer>
+</body>
+</html>`)
+}
+
+func TestLayoutFallback(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	config.LayoutFallback = true
+
+	newFile(config.LayoutsDir, "default.html", `---
+---
+<div class="default">{{content}}</div>`)
+	newFile(config.LayoutsDir, "post.html", `---
+---
+<div class="post">{{content}}</div>`)
+	newFile(config.LayoutsDir, "post.es.html", `---
+---
+<div class="post-es">{{content}}</div>`)
+	newFile(config.LayoutsDir, "notes.html", `---
+layout: default
+---
+<div class="notes">{{content}}</div>`)
+
+	os.Mkdir(filepath.Join(config.SrcDir, "notes"), DIR_RWE_MODE)
+	os.Mkdir(filepath.Join(config.SrcDir, "blog"), DIR_RWE_MODE)
+
+	// no layout, pages fallback to default
+	about := newFile(config.SrcDir, "about.md", `---
+title: about
+---
+about`)
+	// no layout, post in a collection without layout
+	post := newFile(filepath.Join(config.SrcDir, "blog"), "hello.md", `---
+date: 2024-01-01
+---
+hello`)
+	// no layout, post with a language-specific layout
+	postEs := newFile(filepath.Join(config.SrcDir, "blog"), "hola.md", `---
+date: 2024-01-01
+lang: es
+---
+hola`)
+	// no layout, collection layout
+	note := newFile(filepath.Join(config.SrcDir, "notes"), "note.md", `---
+title: note
+---
+note`)
+	// explicitly disabled layout
+	raw := newFile(config.SrcDir, "raw.md", `---
+layout: null
+---
+raw`)
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+
+	output, _ := site.render(site.templates[about.Name()])
+	assertEqual(t, string(output), "<div class=\"default\"><p>about</p>\n</div>")
+	output, _ = site.render(site.templates[post.Name()])
+	assertEqual(t, string(output), "<div class=\"post\"><p>hello</p>\n</div>")
+	output, _ = site.render(site.templates[postEs.Name()])
+	assertEqual(t, string(output), "<div class=\"post-es\"><p>hola</p>\n</div>")
+	output, _ = site.render(site.templates[note.Name()])
+	assertEqual(t, string(output), "<div class=\"default\"><div class=\"notes\"><p>note</p>\n</div></div>")
+	output, _ = site.render(site.templates[raw.Name()])
+	assertEqual(t, string(output), "<p>raw</p>\n")
+
+	// without the config flag, pages without layout render unchanged unless they opt in
+	config.LayoutFallback = false
+	auto := newFile(filepath.Join(config.SrcDir, "blog"), "auto.md", `---
+date: 2024-01-01
+layout: auto
+---
+auto`)
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	output, _ = site.render(site.templates[about.Name()])
+	assertEqual(t, string(output), "<p>about</p>\n")
+	output, _ = site.render(site.templates[post.Name()])
+	assertEqual(t, string(output), "<p>hello</p>\n")
+	output, _ = site.render(site.templates[note.Name()])
+	assertEqual(t, string(output), "<p>note</p>\n")
+	output, _ = site.render(site.templates[auto.Name()])
+	assertEqual(t, string(output), "<div class=\"post\"><p>auto</p>\n</div>")
+}
+
+func TestReloadLayouts(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.LayoutsDir, "base.html", `---
+---
+<div>{{content}}</div>`)
+	newFile(config.LayoutsDir, "post.html", `---
+layout: base
+---
+<article>{{content}}</article>`)
+	newFile(config.LayoutsDir, "page.html", `---
+---
+<section>{{content}}</section>`)
+	newFile(config.SrcDir, "post.html", `---
+layout: post
+---
+post`)
+	newFile(config.SrcDir, "page.html", `---
+layout: page
+---
+page`)
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	// change both the base and page layouts, but only notify about base
+	basePath := newFile(config.LayoutsDir, "base.html", `---
+---
+<main>{{content}}</main>`).Name()
+	newFile(config.LayoutsDir, "page.html", `---
+---
+<p>{{content}}</p>`)
+	err = site.ReloadLayouts(context.Background(), []string{basePath})
+	assertEqual(t, err, nil)
+
+	// the post depends on base, so it should be rendered again
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "post", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<html><head></head><body><main><article>post</article></main></body></html>")
+
+	// the page doesn't, so it should be left as is
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "page", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<html><head></head><body><section>page</section></body></html>")
+}
+
+func TestReloadFiles(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "about.html", `---
+title: about
+---
+about`)
+	newFile(config.SrcDir, "index.html", `---
+---
+{% for page in site.pages %}{{ page.title }}{% endfor %}`)
+	newFile(config.SrcDir, "style.css", `body {}`)
+	newFile(config.SrcDir, "post.html", `---
+date: 2024-01-01
+---
+post`)
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	// a content change renders only that page again
+	aboutPath := newFile(config.SrcDir, "about.html", `---
+title: about
+---
+about me`).Name()
+	newFile(config.SrcDir, "index.html", `---
+---
+index`)
+	stylePath := newFile(config.SrcDir, "style.css", `main {}`).Name()
+	err = site.ReloadFiles(context.Background(), []string{aboutPath, stylePath})
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "about", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<html><head></head><body>about me</body></html>")
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "style.css"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "main {}")
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<html><head></head><body>about</body></html>")
+
+	// changes that may affect other pages require a full reload
+	newFile(config.SrcDir, "about.html", `---
+title: about me
+---
+about me`)
+	err = site.ReloadFiles(context.Background(), []string{aboutPath})
+	assertEqual(t, err, ErrReloadAll)
+
+	postPath := newFile(config.SrcDir, "post.html", `---
+date: 2024-01-01
+---
+updated post`).Name()
+	err = site.ReloadFiles(context.Background(), []string{postPath})
+	assertEqual(t, err, ErrReloadAll)
+
+	newPath := newFile(config.SrcDir, "new.html", `---
+---
+new`).Name()
+	err = site.ReloadFiles(context.Background(), []string{newPath})
+	assertEqual(t, err, ErrReloadAll)
+
+	// so do changes to pages embedded in others
+	newFile(config.SrcDir, "index.html", `---
+---
+{% page "about.html" %}`)
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+	err = site.ReloadFiles(context.Background(), []string{aboutPath})
+	assertEqual(t, err, ErrReloadAll)
+
+	// and to files included by org pages or embedded with the code tag
+	newFile(config.SrcDir, "index.html", `---
+---
+index`)
+	includedPath := newFile(config.SrcDir, "included.txt", `some text`).Name()
+	codePath := newFile(config.SrcDir, "example.go", `package main`).Name()
+	newFile(config.SrcDir, "chapter.org", `---
+---
+#+INCLUDE: "included.txt" example
+{% code "src/example.go" %}`)
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+	newFile(config.SrcDir, "included.txt", `edited text`)
+	err = site.ReloadFiles(context.Background(), []string{includedPath})
+	assertEqual(t, err, ErrReloadAll)
+	err = site.ReloadFiles(context.Background(), []string{codePath})
+	assertEqual(t, err, ErrReloadAll)
+}
+
+func TestBuildPaginated(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "p1.html", `---
+title: p1
+date: 2024-01-01
+tags: [software]
+---`)
+	newFile(config.SrcDir, "p2.html", `---
+title: p2
+date: 2024-01-02
+---`)
+	newFile(config.SrcDir, "p3.html", `---
+title: p3
+date: 2024-01-03
+tags: [software]
+---`)
+	newFile(config.SrcDir, "p4.html", `---
+title: p4
+date: 2024-01-04
+weight: 1
+tags: [software]
+---`)
+
+	content := `---
+paginate:
+  per_page: 2
+---
+{% for post in paginator.items %}{{post.title}} {% endfor %}{{paginator.page}}/{{paginator.total_pages}} {{paginator.previous_page_path}} {{paginator.next_page_path}}`
+	newFile(config.SrcDir, "index.html", content)
+
+	content = `---
+paginate:
+  collection: tags.software
+  per_page: 1
+  path: /software/:num
+---
+{% for post in paginator.items %}{{post.title}}{% endfor %}`
+	newFile(config.SrcDir, "software.html", content)
+
+	config.SmartPunctuation = false
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	// weighted posts go first, the rest in reverse chronological order
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "p4 p3 1/2  /page/2")
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "page", "2", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "p2 p1 2/2 / ")
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "software", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "p4")
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "software", "3", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "p1")
+}
+
+func TestBuildPaginatedJson(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "p1.html", `---
+title: p1
+date: 2024-01-01
+excerpt: first post
+---`)
+	newFile(config.SrcDir, "p2.html", `---
+title: p2
+date: 2024-01-02
+excerpt: second post
+---`)
+	newFile(config.SrcDir, "index.html", `---
+paginate:
+  per_page: 1
+  json: true
+---
+{{paginator.json_path}}`)
+
+	config.SmartPunctuation = false
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "/index.json")
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "page", "2", "index.json"))
+	assertEqual(t, err, nil)
+	var chunk map[string]interface{}
+	err = json.Unmarshal(output, &chunk)
+	assertEqual(t, err, nil)
+	assertEqual(t, chunk["page"], float64(2))
+	assertEqual(t, chunk["previous_page_path"], "/index.json")
+	assertEqual(t, chunk["next_page_path"], nil)
+	item := chunk["items"].([]interface{})[0].(map[string]interface{})
+	assertEqual(t, item["title"], "p1")
+	assertEqual(t, item["excerpt"], "first post")
+	assertEqual(t, item["url"], "/p1")
+}
+
+func TestBuildImageAttributes(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	imgDir := filepath.Join(config.SrcDir, "img")
+	os.Mkdir(imgDir, DIR_RWE_MODE)
+	file := newFile(imgDir, "pic.png", "")
+	png.Encode(file, image.NewRGBA(image.Rect(0, 0, 30, 20)))
+
+	content := `---
+---
+<img src="/img/pic.png"><img src="../img/pic.png"><img src="/img/missing.png"><img src="/img/pic.png" width="10" loading="eager">`
+	newFile(config.SrcDir, "about.html", content)
+
+	content = `---
+image_attributes: false
+---
+<img src="/img/pic.png">`
+	newFile(config.SrcDir, "other.html", content)
+
+	config.ImageAttributes = true
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "about", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html><head></head><body>`+
+		`<img src="/img/pic.png" loading="lazy" width="30" height="20"/>`+
+		`<img src="../img/pic.png" loading="lazy" width="30" height="20"/>`+
+		`<img src="/img/missing.png" loading="lazy"/>`+
+		`<img src="/img/pic.png" width="10" loading="eager"/>`+
+		`</body></html>`)
+
+	// the page opted out
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "other", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html><head></head><body><img src="/img/pic.png"/></body></html>`)
+}
+
+func TestSmartPunctuation(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "album.md", `---
+---
+the album is "Joe's Garage" -- by Frank Zappa...`).Close()
+	newFile(config.SrcDir, "single.html", `---
+---
+<p>the single is "Joe's Garage" -- by Frank Zappa...</p>`).Close()
+	build := func() (string, string) {
+		site, err := Load(*config)
+		assertEqual(t, err, nil)
+		err = site.Build()
+		assertEqual(t, err, nil)
+		album, err := os.ReadFile(filepath.Join(config.TargetDir, "album", "index.html"))
+		assertEqual(t, err, nil)
+		single, err := os.ReadFile(filepath.Join(config.TargetDir, "single", "index.html"))
+		assertEqual(t, err, nil)
+		return string(album), string(single)
+	}
+
+	// by default all pages go through the same smart punctuation pass, after rendering
+	album, single := build()
+	assertEqual(t, album, "<html><head></head><body><p>the album is “Joe’s Garage” – by Frank Zappa…</p>\n</body></html>")
+	assertEqual(t, single, "<html><head></head><body><p>the single is “Joe’s Garage” – by Frank Zappa…</p></body></html>")
+
+	// with the typographer, markdown pages are converted by goldmark and aren't processed again
+	config.MarkdownTypographer = true
+	album, single = build()
+	assertEqual(t, album, "<p>the album is &ldquo;Joe&rsquo;s Garage&rdquo; &ndash; by Frank Zappa&hellip;</p>\n")
+	assertEqual(t, single, "<html><head></head><body><p>the single is “Joe’s Garage” – by Frank Zappa…</p></body></html>")
+
+	config.SmartPunctuation = false
+	album, single = build()
+	assertEqual(t, album, "<p>the album is &quot;Joe's Garage&quot; -- by Frank Zappa...</p>\n")
+	assertEqual(t, single, `<p>the single is "Joe's Garage" -- by Frank Zappa...</p>`)
+}
+
+func TestSocialImageProblems(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	imgDir := filepath.Join(config.SrcDir, "img")
+	os.Mkdir(imgDir, DIR_RWE_MODE)
+	png.Encode(newFile(imgDir, "ok.png", ""), image.NewRGBA(image.Rect(0, 0, 1200, 630)))
+	png.Encode(newFile(imgDir, "small.png", ""), image.NewRGBA(image.Rect(0, 0, 100, 100)))
+	png.Encode(newFile(imgDir, "tall.png", ""), image.NewRGBA(image.Rect(0, 0, 400, 800)))
+	newFile(imgDir, "pic.svg", "<svg></svg>")
+
+	config.SiteUrl = "https://olano.dev"
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+
+	targetPath := filepath.Join(config.TargetDir, "about", "index.html")
+	problem := func(src string) string {
+		path, ok := site.localImagePath(targetPath, src)
+		assertEqual(t, ok, true)
+		return socialImageProblem(path)
+	}
+	assertEqual(t, problem("https://olano.dev/img/ok.png"), "")
+	assertEqual(t, problem("../img/ok.png"), "")
+	assertEqual(t, problem("/img/small.png"), "is too small (100x100, min 200x200)")
+	assertEqual(t, problem("/img/tall.png"), "has a 0.50:1 aspect ratio, it will be cropped (use between 1:1 and 2:1)")
+	assertEqual(t, problem("/img/pic.svg"), "is not a supported image format (use png, jpeg or gif)")
+	assertEqual(t, problem("/img/missing.png"), "not found")
+
+	_, ok := site.localImagePath(targetPath, "https://example.com/img/ok.png")
+	assertEqual(t, ok, false)
+}
+
+func TestBuildManifest(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	config.SiteUrl = "https://example.com"
+	config.Manifest = true
+
+	os.Mkdir(filepath.Join(config.SrcDir, "blog"), DIR_RWE_MODE)
+	newFile(filepath.Join(config.SrcDir, "blog"), "p1.html", `---
+title: first
+date: 2024-01-01
+tags: [go]
+---`)
+	newFile(filepath.Join(config.SrcDir, "blog"), "p2.html", `---
+title: second
+date: 2024-02-01
+tags: [go, web]
+---`)
+	newFile(config.SrcDir, "about.html", `---
+title: about
+---`)
+	newFile(config.SrcDir, "draft.html", `---
+draft: true
+---`)
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	content, err := os.ReadFile(filepath.Join(config.TargetDir, "site.json"))
+	assertEqual(t, err, nil)
+	var manifest map[string]interface{}
+	err = json.Unmarshal(content, &manifest)
+	assertEqual(t, err, nil)
+
+	assertEqual(t, manifest["version"], 1.0)
+	assertEqual(t, manifest["url"], "https://example.com")
+	pages := manifest["pages"].([]interface{})
+	assertEqual(t, len(pages), 3)
+	about := pages[0].(map[string]interface{})
+	assertEqual(t, about["url"], "/about")
+	assertEqual(t, about["absolute_url"], "https://example.com/about")
+	assertEqual(t, about["type"], "page")
+	post := pages[1].(map[string]interface{})
+	assertEqual(t, post["url"], "/blog/p1")
+	assertEqual(t, post["type"], "post")
+	assertEqual(t, post["collection"], "blog")
+	assertEqual(t, post["date"], "2024-01-01T00:00:00Z")
+
+	collections := manifest["collections"].(map[string]interface{})
+	assertEqual(t, fmt.Sprint(collections["blog"]), "[/blog/p2 /blog/p1]")
+	tags := manifest["tags"].(map[string]interface{})
+	assertEqual(t, fmt.Sprint(tags["go"]), "[/blog/p2 /blog/p1]")
+	assertEqual(t, fmt.Sprint(tags["web"]), "[/blog/p2]")
+}
+
+func TestFeedMetadata(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	config.SiteUrl = "https://olano.dev"
+
+	git := func(date string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = config.RootDir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s", args, output)
+		}
+	}
+
+	os.Mkdir(filepath.Join(config.SrcDir, "blog"), DIR_RWE_MODE)
+	newFile(filepath.Join(config.SrcDir, "blog"), "new-title.html", `---
+date: 2024-01-01
+aliases: /blog/old-title
+---
+moved`).Close()
+	newFile(filepath.Join(config.SrcDir, "blog"), "edited.html", `---
+date: 2024-01-02
+---
+edited`).Close()
+	newFile(filepath.Join(config.SrcDir, "blog"), "explicit.html", `---
+date: 2024-01-03
+updated: 2024-01-04
+feed_id: urn:uuid:1234
+---
+explicit`).Close()
+	git("2024-01-05T10:00:00Z", "init", "-q")
+	git("2024-01-05T10:00:00Z", "add", ".")
+	git("2024-01-05T10:00:00Z", "commit", "-q", "-m", "first")
+	newFile(filepath.Join(config.SrcDir, "blog"), "edited.html", `---
+date: 2024-01-02
+---
+edited again`).Close()
+	git("2024-02-01T10:00:00Z", "commit", "-q", "-am", "second")
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	post := site.templates[filepath.Join(config.SrcDir, "blog", "new-title.html")]
+	assertEqual(t, post.Metadata["feed_id"], "tag:olano.dev,2024-01-01:/blog/old-title")
+	assertEqual(t, post.Metadata["updated"], post.Metadata["date"])
+	post = site.templates[filepath.Join(config.SrcDir, "blog", "explicit.html")]
+	assertEqual(t, post.Metadata["feed_id"], "urn:uuid:1234")
+	assertEqual(t, post.Metadata["updated"].(time.Time).Format(time.DateOnly), "2024-01-04")
+
+	// the commit dates are only used when enabled
+	post = site.templates[filepath.Join(config.SrcDir, "blog", "edited.html")]
+	assertEqual(t, post.Metadata["feed_id"], "tag:olano.dev,2024-01-02:/blog/edited")
+	assertEqual(t, post.Metadata["updated"], post.Metadata["date"])
+	config.UpdatedFromGit = true
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	post = site.templates[filepath.Join(config.SrcDir, "blog", "edited.html")]
+	assertEqual(t, post.Metadata["updated"].(time.Time).UTC().Format(time.RFC3339), "2024-02-01T10:00:00Z")
+	post = site.templates[filepath.Join(config.SrcDir, "blog", "new-title.html")]
+	assertEqual(t, post.Metadata["updated"].(time.Time).UTC().Format(time.RFC3339), "2024-01-05T10:00:00Z")
+
+	// front matter changes and renames don't count as updates
+	newFile(filepath.Join(config.SrcDir, "blog"), "edited.html", `---
+date: 2024-01-02
+tags: [fixed]
+---
+edited again`).Close()
+	git("2024-03-01T10:00:00Z", "mv", "src/blog/new-title.html", "src/blog/newer-title.html")
+	git("2024-03-01T10:00:00Z", "commit", "-q", "-am", "third")
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	post = site.templates[filepath.Join(config.SrcDir, "blog", "edited.html")]
+	assertEqual(t, post.Metadata["updated"].(time.Time).UTC().Format(time.RFC3339), "2024-02-01T10:00:00Z")
+	post = site.templates[filepath.Join(config.SrcDir, "blog", "newer-title.html")]
+	assertEqual(t, post.Metadata["updated"].(time.Time).UTC().Format(time.RFC3339), "2024-01-05T10:00:00Z")
+}
+
+func TestBuildCommittedOnly(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = config.RootDir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s", args, output)
+		}
+	}
+
+	content := `---
+title: committed
+date: 2024-01-01
+---
+committed`
+	newFile(config.SrcDir, "committed.html", content)
+	newFile(config.SrcDir, "about.html", "---\n---\nabout")
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+
+	content = `---
+title: staged
+date: 2024-01-02
+---
+staged`
+	newFile(config.SrcDir, "staged.html", content)
+	git("add", ".")
+	content = `---
+title: untracked
+date: 2024-01-03
+---
+untracked`
+	newFile(config.SrcDir, "untracked.html", content)
+	newFile(config.SrcDir, "contact.html", "---\n---\ncontact")
+
+	config.CommittedOnly = true
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	assertEqual(t, len(site.posts), 1)
+	assertEqual(t, site.posts[0]["title"], "committed")
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	_, err = os.Stat(filepath.Join(config.TargetDir, "committed", "index.html"))
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "staged", "index.html"))
+	assertEqual(t, os.IsNotExist(err), true)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "untracked", "index.html"))
+	assertEqual(t, os.IsNotExist(err), true)
+	// pages are not affected
+	_, err = os.Stat(filepath.Join(config.TargetDir, "contact", "index.html"))
+	assertEqual(t, err, nil)
+}
+
+func TestBuildLanguages(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	os.Mkdir(filepath.Join(config.SrcDir, "en"), DIR_RWE_MODE)
+	os.Mkdir(filepath.Join(config.SrcDir, "es"), DIR_RWE_MODE)
+	content := `---
+---
+<html lang="{{page.lang}}"><head>{% for t in page.translations %}<link rel="alternate" hreflang="{{t.lang}}" href="{{t.url}}">{% endfor %}</head><body></body></html>`
+	newFile(filepath.Join(config.SrcDir, "en"), "about.html", content)
+	newFile(filepath.Join(config.SrcDir, "es"), "about.html", content)
+	newFile(filepath.Join(config.SrcDir, "es"), "contacto.html", content)
+
+	config.SiteUrl = "https://olano.dev"
+	config.Languages = []string{"en", "es"}
+	config.LanguageRedirect = true
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "es", "about", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html lang="es"><head><link rel="alternate" hreflang="en" href="/en/about"/><link rel="alternate" hreflang="es" href="/es/about"/></head><body></body></html>`)
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "es", "contacto", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html lang="es"><head><link rel="alternate" hreflang="es" href="/es/contacto"/></head><body></body></html>`)
+
+	// a language redirect index is added since the site doesn't have one
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<link rel="alternate" hreflang="es" href="https://olano.dev/es/">`))
+	assert(t, strings.Contains(string(output), `<link rel="alternate" hreflang="x-default" href="https://olano.dev/">`))
+	assert(t, strings.Contains(string(output), `var languages = ["en", "es"];`))
+}
+
+func TestBuildRightToLeft(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.LayoutsDir, "base.html", `---
+---
+<html dir="{{page.text_direction}}">{{content}}</html>`)
+	newFile(config.SrcDir, "hello.md", `---
+layout: base
+lang: ar
+---
+مرحبا`)
+	newFile(config.SrcDir, "goodbye.md", `---
+layout: base
+---
+goodbye`)
+
+	config.SmartPunctuation = false
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "hello", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html dir="rtl"><div lang="ar" dir="rtl">
+<p>مرحبا</p>
+
+</div></html>`)
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "goodbye", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html dir="ltr"><p>goodbye</p>
+</html>`)
+}
+
+func TestBuildHighlightStylesheet(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "hello.md", "---\n---\n```go\npackage main\n```\n")
+
+	config.HighlightTheme = "github"
+	config.HighlightThemeDark = "monokai"
+	config.HighlightClasses = true
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "hello", "index.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<span class="kn">package</span>`))
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "highlight.css"))
+	assertEqual(t, err, nil)
+	light, dark, found := strings.Cut(string(output), "@media (prefers-color-scheme: dark) {")
+	assert(t, found)
+	assert(t, strings.Contains(light, ".chroma { background-color: #ffffff; }"))
+	assert(t, strings.Contains(dark, ".chroma { color: #f8f8f2; background-color: #272822; }"))
+
+	// a site stylesheet takes precedence
+	newFile(config.SrcDir, "highlight.css", ".chroma {}")
+	err = site.Build()
+	assertEqual(t, err, nil)
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "highlight.css"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), ".chroma {}")
+}
+
+func TestExcerptWords(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "hello.html", `---
+date: 2024-01-01
+---
+<p>the intro paragraph, which is long</p>`)
+	newFile(config.SrcDir, "konnichiwa.html", `---
+date: 2024-02-01
+---
+<p>今日は良い天気です。</p>`)
+	file := newFile(config.SrcDir, "about.html", `---
+---
+{% for post in site.posts %}{{post.excerpt}}|{% endfor %}`)
+
+	config.ExcerptWords = 3
+	site, _ := Load(*config)
+	output, err := site.render(site.templates[file.Name()])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "今日は…|the intro paragraph,…|")
+}
+
+func TestCodeTag(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	os.Mkdir(filepath.Join(config.RootDir, "snippets"), DIR_RWE_MODE)
+	newFile(filepath.Join(config.RootDir, "snippets"), "example.go", `package main
+
+func main() {
+	fmt.Println("<hello>")
+}
+`)
+	newFile(config.SrcDir, "tutorial.html", `---
+---
+{% code "snippets/example.go" lines="4" %}`)
+	newFile(config.SrcDir, "tutorial.md", `---
+---
+{% code "snippets/example.go" lang="golang" lines="3-" %}`)
+	newFile(config.SrcDir, "tutorial.org", `---
+---
+{% code "snippets/example.go" lines="3-5" %}`)
+
+	config.HighlightTheme = ""
+	config.SmartPunctuation = false
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+
+	output, err := site.render(site.templates[filepath.Join(config.SrcDir, "tutorial.html")])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<pre><code class="language-go">fmt.Println(&#34;&lt;hello&gt;&#34;)</code></pre>`)
+
+	output, err = site.render(site.templates[filepath.Join(config.SrcDir, "tutorial.md")])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<pre><code class="language-golang">func main() {
+	fmt.Println(&quot;&lt;hello&gt;&quot;)
+}
+</code></pre>
+`)
+
+	output, err = site.render(site.templates[filepath.Join(config.SrcDir, "tutorial.org")])
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<div class="src src-go">`))
+	assert(t, strings.Contains(string(output), "func main() {"))
+}
+
+func TestBuildCustomTargetPath(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	os.Mkdir(filepath.Join(config.SrcDir, "blog"), DIR_RWE_MODE)
+	newFile(filepath.Join(config.SrcDir, "blog"), "feed.html", `---
+permalink: /feed.xml
+---
+<feed></feed>`)
+	newFile(filepath.Join(config.SrcDir, "blog"), "robots.html", `---
+target: robots.txt
+---
+User-agent: *`)
+	newFile(config.SrcDir, "about.md", `---
+permalink: /me/
+---
+about`)
+	newFile(config.SrcDir, "resume.md", `---
+output_path: about/cv/index.html
+---
+resume`)
+	newFile(config.SrcDir, "projects.md", `---
+output_path: work/projects/
+---
+projects`)
+	newFile(config.SrcDir, "index.html", `---
+---
+{% for page in site.pages %}{{ page.url }} {% endfor %}`)
+
+	config.SmartPunctuation = false
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "feed.xml"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<feed></feed>")
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "blog", "robots.txt"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "User-agent: *")
+
+	_, err = os.Stat(filepath.Join(config.TargetDir, "me", "index.html"))
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "about", "cv", "index.html"))
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "work", "projects", "index.html"))
+	assertEqual(t, err, nil)
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "/about/cv /blog/robots.txt /feed.xml /me /work/projects ")
+
+	// paths outside of the target dir are rejected
+	for _, frontMatter := range []string{"permalink: ../../outside.html", "output_path: /blog/../../outside/", "target: ../../robots.txt"} {
+		escape := newFile(config.SrcDir, "escape.html", "---\n"+frontMatter+"\n---\nescape")
+		escape.Close()
+		_, err = Load(*config)
+		assert(t, err != nil)
+		assert(t, strings.Contains(err.Error(), "outside of the target directory"))
+		os.Remove(escape.Name())
+	}
+}
+
+func TestStrictVariables(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	file := newFile(config.SrcDir, "hello.html", `---
+title: hello
+---
+{{ page.title }} {{ page.subtitle | default: "world" }} {{ page.typo }}`)
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	output, err := site.render(site.templates[file.Name()])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "hello world ")
+
+	config.StrictVariables = true
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	_, err = site.render(site.templates[file.Name()])
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "undefined variable"))
+	assert(t, strings.Contains(err.Error(), "hello.html"))
+}
+
+func TestBuildErrorKeepsPreviousOutput(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	config.StrictVariables = true
+
+	file := newFile(config.SrcDir, "hello.html", `---
+title: hello
+---
+<p>{{ page.title }}</p>`)
+	file.Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "hello", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<html><head></head><body><p>hello</p></body></html>")
+	_, err = os.Stat(config.TargetDir + PREVIOUS_SUFFIX)
+	assert(t, os.IsNotExist(err))
+
+	// undefined variable at line 5 of the source file
+	file = newFile(config.SrcDir, "hello.html", `---
+title: hello
+---
+<p>{{ page.title }}</p>
+<p>{{ page.typo }}</p>
+<p>bye</p>`)
+	file.Close()
+
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), file.Name()+":5: undefined variable"))
+	assert(t, strings.Contains(err.Error(), ">    5 | <p>{{ page.typo }}</p>"))
+	assert(t, strings.Contains(err.Error(), "     4 | <p>{{ page.title }}</p>"))
+
+	// the output of the previous build is kept
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "hello", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<html><head></head><body><p>hello</p></body></html>")
+	_, err = os.Stat(config.TargetDir + STAGING_SUFFIX)
+	assert(t, os.IsNotExist(err))
+}
+
+func TestParseErrorLine(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	file := newFile(config.SrcDir, "hello.html", `---
+title: hello
+tags: [a, b]
+---
+<p>{{ page.title }}</p>
+{% if page.title %}
+<p>unclosed</p>`)
+	file.Close()
+
+	_, err := Load(*config)
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), file.Name()+":6: "))
+}
+
+func TestBuildInvalidOutput(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	file := newFile(config.SrcDir, "feed.xml", `---
+title: Tom & Jerry
+---
+<feed>
+<title>{{ page.title }}</title>
+</feed>`)
+	file.Close()
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), file.Name()+": invalid xml output"))
+	assert(t, strings.Contains(err.Error(), "line 2"))
+
+	file = newFile(config.SrcDir, "feed.xml", `---
+title: Tom & Jerry
+---
+<feed>
+<title>{{ page.title | xml_escape }}</title>
+</feed>`)
+	file.Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	file = newFile(config.SrcDir, "data.json", `---
+title: hello
+---
+{"title": "{{ page.title }}",
+ "tags": [1, 2,]}`)
+	file.Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), file.Name()+": invalid json output on line 2"))
+}
+
+func TestShortcodes(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	os.Mkdir(config.ShortcodesDir, DIR_RWE_MODE)
+
+	newFile(config.ShortcodesDir, "video.html", `<iframe src="https://www.youtube.com/embed/{{ shortcode.id }}?start={{ shortcode.start | default: 0 }}" title="{{ shortcode.title }}"></iframe>`).Close()
+	newFile(config.ShortcodesDir, "badge.html", `<span class="badge">{{ shortcode.text }}</span>`).Close()
+
+	newFile(config.SrcDir, "hello.md", `---
+title: hello
+---
+# Hello
+
+{% shortcode video id="abc" start=30 title=page.title %}
+
+A {% shortcode badge text="new" %} post.`).Close()
+
+	newFile(config.SrcDir, "goodbye.org", `---
+title: goodbye
+---
+* Goodbye
+
+{% shortcode video id="xyz" title="bye" %}
+
+A {% shortcode badge text="old" %} post.`).Close()
+
+	newFile(config.SrcDir, "index.html", `---
+---
+{% shortcode badge text="home" %}`).Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+
+	output, err := site.render(site.templates[filepath.Join(config.SrcDir, "hello.md")])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<h1>Hello</h1>
+<iframe src="https://www.youtube.com/embed/abc?start=30" title="hello"></iframe>
+<p>A <span class="badge">new</span> post.</p>
+`)
+
+	output, err = site.render(site.templates[filepath.Join(config.SrcDir, "goodbye.org")])
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<iframe src="https://www.youtube.com/embed/xyz?start=0" title="bye"></iframe>`))
+	assert(t, !strings.Contains(string(output), `<p>
+<iframe`))
+	assert(t, strings.Contains(string(output), `A <span class="badge">old</span> post.`))
+
+	output, err = site.render(site.templates[filepath.Join(config.SrcDir, "index.html")])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<span class="badge">home</span>`)
+}
+
+func TestPageTag(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "about.md", `---
+title: about
+---
+# About
+
+## Bio
+I write **code**.
+
+## Contact
+write me`).Close()
+	newFile(config.SrcDir, "disclaimer.html", `---
+---
+<p>not {{ page.title }} advice</p>`).Close()
+	index := newFile(config.SrcDir, "index.html", `---
+title: index
+---
+{% page "disclaimer.html" %}
+{% page "about.md" section="bio" %}`)
+	index.Close()
+	post := newFile(config.SrcDir, "post.md", `---
+title: post
+---
+{% page about.md section=contact %}`)
+	post.Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	output, err := site.render(site.templates[index.Name()])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<p>not  advice</p>\n<p>I write <strong>code</strong>.</p>")
+
+	// embedded html is preserved in markdown
+	output, err = site.render(site.templates[post.Name()])
+	assertEqual(t, err, nil)
+	assertEqual(t, strings.TrimSpace(string(output)), "<p>write me</p>")
+
+	newFile(config.SrcDir, "loop.html", `---
+---
+{% page "index.html" %}`).Close()
+	newFile(config.SrcDir, "index.html", `---
+---
+{% page "loop.html" %}`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	_, err = site.render(site.templates[index.Name()])
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "page index.html embeds itself"))
+
+	newFile(config.SrcDir, "index.html", `---
+---
+{% page "about.md" section="missing" %}`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	_, err = site.render(site.templates[index.Name()])
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "section missing not found"))
+}
+
+func TestLinkTags(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	os.Mkdir(filepath.Join(config.SrcDir, "blog"), DIR_RWE_MODE)
+
+	// the post links to one that is loaded after it
+	newFile(filepath.Join(config.SrcDir, "blog"), "first.md", `---
+title: first
+date: 2024-01-01
+---
+see [the second post]({% post_url second %})`).Close()
+	newFile(filepath.Join(config.SrcDir, "blog"), "second.org", `---
+title: second
+date: 2024-02-01
+permalink: /posts/second/
+---
+hello`).Close()
+	newFile(config.SrcDir, "draft.html", `---
+draft: true
+---
+draft`).Close()
+	newFile(config.SrcDir, "logo.png", "").Close()
+	index := newFile(config.SrcDir, "index.html", `---
+---
+{% link blog/first.md %} {% link blog/second.org %} {% link logo.png %} {% post_url first %}`)
+	index.Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	output, err := site.render(site.templates[index.Name()])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "/blog/first /posts/second /logo.png /blog/first")
+	assertEqual(t, site.posts[1]["excerpt"], "see the second post")
+
+	output, err = site.render(site.templates[filepath.Join(config.SrcDir, "blog", "first.md")])
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<a href="/posts/second">the second post</a>`))
+
+	newFile(config.SrcDir, "index.html", `---
+---
+{% link blog/missing.md %}`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "broken link to blog/missing.md"))
+
+	newFile(config.SrcDir, "index.html", `---
+---
+{% link draft.html %}`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "draft"))
+}
+
+func TestBuildCanceled(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "hello.html", `---
+---
+hello`).Close()
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	newFile(config.SrcDir, "goodbye.html", `---
+---
+goodbye`).Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = LoadContext(ctx, *config)
+	assertEqual(t, err, context.Canceled)
+
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.BuildContext(ctx)
+	assertEqual(t, err, context.Canceled)
+
+	// the previous output is kept
+	_, err = os.Stat(filepath.Join(config.TargetDir, "hello", "index.html"))
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "goodbye", "index.html"))
+	assert(t, os.IsNotExist(err))
+}
+
+func TestBaseUrl(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	config.SiteUrl = "https://user.github.io"
+	config.BaseUrl = "/myrepo"
+
+	newFile(config.SrcDir, "about.md", `---
+title: about
+---
+about`).Close()
+	index := newFile(config.SrcDir, "index.html", `---
+---
+{{ "/feed.xml" | relative_url }} {{ "blog/" | relative_url }} {{ "/about" | absolute_url }} {% link about.md %} {{ "https://olano.dev" | relative_url }}`)
+	index.Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	output, err := site.render(site.templates[index.Name()])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "/myrepo/feed.xml /myrepo/blog/ https://user.github.io/myrepo/about /myrepo/about https://olano.dev")
+}
+
 // ------ HELPERS --------
 
+func TestPageSections(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.LayoutsDir, "base.html", `---
+---
+<header>{{ page.sections.hero }}</header>
+<aside>{{ page.sections.links }}</aside>
+<main>{{ content }}</main>`).Close()
+	post := newFile(config.SrcDir, "post.md", `---
+title: post
+layout: base
+---
+{% section hero %}
+Hello **world**
+{% endsection %}
+
+## Links
+[home](/)`)
+	post.Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	output, err := site.render(site.templates[post.Name()])
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), "<header><p>Hello <strong>world</strong></p></header>"))
+	assert(t, strings.Contains(string(output), `<aside><p><a href="/">home</a></p></aside>`))
+	assert(t, !strings.Contains(string(output), "JORGESECTION"))
+
+	// the shared page metadata isn't modified
+	_, found := site.templates[post.Name()].Metadata["sections"]
+	assert(t, !found)
+}
+
+func TestIslandTag(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "comments.js", `export default function mount(element, props) {}`).Close()
+	post := newFile(config.SrcDir, "post.md", `---
+title: post
+---
+# Hello
+
+{% island "comments.js" props=page.slug %}`)
+	post.Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	output, err := site.render(site.templates[post.Name()])
+	assertEqual(t, err, nil)
+	assert(t, regexp.MustCompile(`<div data-island="/comments.js\?v=[0-9a-f]{8}" data-props="&#34;post&#34;"></div>`).Match(output))
+	assert(t, regexp.MustCompile(`import mount from "/comments.js\?v=[0-9a-f]{8}";`).Match(output))
+	assert(t, !strings.Contains(string(output), "<p><div"))
+
+	// the hash changes with the script content
+	firstUrl := regexp.MustCompile(`/comments.js\?v=[0-9a-f]{8}`).Find(output)
+	newFile(config.SrcDir, "comments.js", `export default function mount(element, props) { console.log(props) }`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	output, err = site.render(site.templates[post.Name()])
+	assertEqual(t, err, nil)
+	assert(t, !strings.Contains(string(output), string(firstUrl)))
+
+	newFile(config.SrcDir, "post.md", `---
+title: post
+---
+{% island "missing.js" %}`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	_, err = site.render(site.templates[post.Name()])
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "missing.js: file not found"))
+}
+
+func TestSiteMap(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	newFile(config.SrcDir, "about.html", `---
+title: About
+---`).Close()
+	newFile(config.SrcDir, "feed.xml", `---
+title: feed
+---`).Close()
+	os.Mkdir(filepath.Join(config.SrcDir, "blog"), DIR_RWE_MODE)
+	newFile(filepath.Join(config.SrcDir, "blog"), "index.html", `---
+title: Blog
+---`).Close()
+	newFile(filepath.Join(config.SrcDir, "blog"), "p1.html", `---
+title: First
+date: 2024-01-01
+---`).Close()
+	newFile(filepath.Join(config.SrcDir, "blog"), "p2.html", `---
+title: Second
+date: 2024-02-01
+---`).Close()
+	os.MkdirAll(filepath.Join(config.SrcDir, "docs", "api"), DIR_RWE_MODE)
+	newFile(filepath.Join(config.SrcDir, "docs", "api"), "auth.html", `---
+title: Auth
+---`).Close()
+	// non string titles are supported
+	newFile(filepath.Join(config.SrcDir, "docs"), "index.html", `---
+title: 2024
+---`).Close()
+	index := newFile(config.SrcDir, "index.html", `---
+---
+{{ site.tree.children[0].title }} {{ site.tree.children[0].pages | size }}
+{% site_map %}`)
+	index.Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	output, err := site.render(site.templates[index.Name()])
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `Blog 2
+<ul class="site-map"><li><a href="/about">About</a></li>`+
+		`<li><a href="/blog">Blog</a><ul class="site-map">`+
+		`<li><a href="/blog/p2">Second</a> <time datetime="2024-02-01">2024-02-01</time></li>`+
+		`<li><a href="/blog/p1">First</a> <time datetime="2024-01-01">2024-01-01</time></li></ul></li>`+
+		`<li><a href="/docs">2024</a><ul class="site-map"><li>api<ul class="site-map"><li><a href="/docs/api/auth">Auth</a></li></ul></li></ul></li></ul>`)
+}
+
+func TestOrgAttachments(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	// org-attach dirs derived from the heading ID and set explicitly with DIR
+	attachDir := filepath.Join(config.SrcDir, "blog", "data", "5f", "0a1e2b")
+	os.MkdirAll(attachDir, DIR_RWE_MODE)
+	newFile(attachDir, "diagram.png", "png").Close()
+	otherDir := filepath.Join(config.RootDir, "files")
+	os.MkdirAll(otherDir, DIR_RWE_MODE)
+	newFile(otherDir, "notes.txt", "notes").Close()
+
+	os.Mkdir(filepath.Join(config.SrcDir, "blog"), DIR_RWE_MODE)
+	newFile(filepath.Join(config.SrcDir, "blog"), "hello.org", `---
+title: hello
+---
+* Diagrams
+:PROPERTIES:
+:ID: 5f0a1e2b
+:END:
+[[attachment:diagram.png]]
+
+** Notes
+:PROPERTIES:
+:DIR: ../../files
+:END:
+[[attachment:notes.txt][my notes]]
+`).Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "blog", "hello", "index.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<img src="diagram.png" alt="diagram.png" title="diagram.png"/>`))
+	assert(t, strings.Contains(string(output), `<a href="notes.txt">my notes</a>`))
+
+	content, err := os.ReadFile(filepath.Join(config.TargetDir, "blog", "hello", "diagram.png"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), "png")
+	content, err = os.ReadFile(filepath.Join(config.TargetDir, "blog", "hello", "notes.txt"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(content), "notes")
+	// the attachments aren't also published as static files
+	_, err = os.Stat(filepath.Join(config.TargetDir, "blog", "data", "5f", "0a1e2b", "diagram.png"))
+	assert(t, os.IsNotExist(err))
+	assertEqual(t, len(site.static_files), 0)
+
+	// nor copied if the page fails to render
+	newFile(filepath.Join(config.SrcDir, "blog"), "hello.org", `---
+title: hello
+layout: missing
+---
+* Diagrams
+:PROPERTIES:
+:ID: 5f0a1e2b
+:END:
+[[attachment:diagram.png]]
+`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	os.RemoveAll(config.TargetDir)
+	os.MkdirAll(filepath.Join(config.TargetDir, "blog"), DIR_RWE_MODE)
+	err = site.buildFile(filepath.Join(config.SrcDir, "blog", "hello.org"))
+	assert(t, err != nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "blog", "hello", "diagram.png"))
+	assert(t, os.IsNotExist(err))
+
+	// links to missing attachments fail the build
+	newFile(filepath.Join(config.SrcDir, "blog"), "hello.org", `---
+title: hello
+---
+* Diagrams
+:PROPERTIES:
+:ID: 5f0a1e2b
+:END:
+[[attachment:missing.png]]
+`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "broken attachment link missing.png"))
+
+	// and so do attachments that would be copied outside of the page dir
+	newFile(filepath.Join(config.SrcDir, "blog"), "hello.org", `---
+title: hello
+---
+* Diagrams
+:PROPERTIES:
+:ID: 5f0a1e2b
+:END:
+[[attachment:../0a1e2b/diagram.png]]
+`).Close()
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "invalid attachment link ../0a1e2b/diagram.png"))
+}
+
+func TestIgnoreFile(t *testing.T) {
+	projectDir, _ := os.MkdirTemp("", "root")
+	defer os.RemoveAll(projectDir)
+	newFile(projectDir, ".jorgeignore", `# scratch files
+*.scratch.md
+/src/notes/
+!keep.scratch.md
+`).Close()
+	srcDir := filepath.Join(projectDir, "src")
+	os.MkdirAll(filepath.Join(srcDir, "notes"), DIR_RWE_MODE)
+	os.MkdirAll(filepath.Join(srcDir, "blog", "notes"), DIR_RWE_MODE)
+	newFile(srcDir, "index.html", "---\n---\n<p>index</p>").Close()
+	newFile(srcDir, "ideas.scratch.md", "---\n---\nideas").Close()
+	newFile(srcDir, "keep.scratch.md", "---\n---\nkeep").Close()
+	newFile(filepath.Join(srcDir, "notes"), "todo.txt", "todo").Close()
+	newFile(filepath.Join(srcDir, "blog", "notes"), "todo.txt", "todo").Close()
+
+	config, err := config.Load(projectDir)
+	assertEqual(t, err, nil)
+	config.Minify = false
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	_, err = os.Stat(filepath.Join(config.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "keep.scratch", "index.html"))
+	assertEqual(t, err, nil)
+	// only the top-level notes dir is anchored by the pattern
+	_, err = os.Stat(filepath.Join(config.TargetDir, "blog", "notes", "todo.txt"))
+	assertEqual(t, err, nil)
+
+	_, err = os.Stat(filepath.Join(config.TargetDir, "ideas.scratch", "index.html"))
+	assert(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(config.TargetDir, "notes"))
+	assert(t, os.IsNotExist(err))
+	assertEqual(t, len(site.pages), 1)
+}
+
+func TestPageBundles(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	bundleDir := filepath.Join(config.SrcDir, "blog", "my-trip")
+	os.MkdirAll(bundleDir, DIR_RWE_MODE)
+	newFile(bundleDir, "index.md", `---
+title: my trip
+date: 2024-02-01
+---
+![the view](view.jpg)
+
+[the itinerary](itinerary.pdf)`).Close()
+	newFile(bundleDir, "view.jpg", "jpg").Close()
+	newFile(bundleDir, "itinerary.pdf", "pdf").Close()
+
+	orgDir := filepath.Join(config.SrcDir, "talks")
+	os.MkdirAll(orgDir, DIR_RWE_MODE)
+	newFile(orgDir, "index.org", `---
+title: talks
+---
+[[file:slides.pdf][the slides]] and [[file:../about.org][about]]`).Close()
+	newFile(orgDir, "slides.pdf", "pdf").Close()
+
+	newFile(config.SrcDir, "index.md", `---
+---
+[talks](talks/)`).Close()
+	newFile(config.SrcDir, "feed.html", `---
+---
+{% for post in site.posts %}{{ post.content }}{% endfor %}`).Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "blog", "my-trip", "index.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<img src="/blog/my-trip/view.jpg" alt="the view"/>`))
+	assert(t, strings.Contains(string(output), `<a href="/blog/my-trip/itinerary.pdf">the itinerary</a>`))
+	_, err = os.Stat(filepath.Join(config.TargetDir, "blog", "my-trip", "view.jpg"))
+	assertEqual(t, err, nil)
+
+	// the links keep working when the content is included in other pages
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "feed", "index.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<img src="/blog/my-trip/view.jpg" alt="the view"/>`))
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "talks", "index.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<a href="/talks/slides.pdf">the slides</a>`))
+	assert(t, strings.Contains(string(output), `<a href="/about/">about</a>`))
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<a href="/talks/">talks</a>`))
+}
+
+func TestExcludeInclude(t *testing.T) {
+	projectDir, _ := os.MkdirTemp("", "root")
+	defer os.RemoveAll(projectDir)
+	newFile(projectDir, "config.yml", `
+exclude: [README.md, "drafts/**", "*.txt"]
+include: [".well-known/**", .htaccess]
+`).Close()
+	srcDir := filepath.Join(projectDir, "src")
+	os.MkdirAll(filepath.Join(srcDir, "drafts"), DIR_RWE_MODE)
+	os.MkdirAll(filepath.Join(srcDir, ".well-known"), DIR_RWE_MODE)
+	newFile(srcDir, "README.md", "# readme").Close()
+	newFile(srcDir, "notes.txt", "notes").Close()
+	newFile(srcDir, ".htaccess", "Options -Indexes").Close()
+	newFile(srcDir, ".env", "SECRET=1").Close()
+	newFile(filepath.Join(srcDir, "drafts"), "wip.md", "---\n---\nwip").Close()
+	newFile(filepath.Join(srcDir, ".well-known"), "security.txt", "Contact: me").Close()
+
+	config, err := config.Load(projectDir)
+	assertEqual(t, err, nil)
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	for _, path := range []string{".htaccess", filepath.Join(".well-known", "security.txt")} {
+		_, err = os.Stat(filepath.Join(config.TargetDir, path))
+		assertEqual(t, err, nil)
+	}
+	for _, path := range []string{"README.md", "notes.txt", ".env", "drafts"} {
+		_, err = os.Stat(filepath.Join(config.TargetDir, path))
+		assert(t, os.IsNotExist(err))
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+
+	// content shared with other sites, outside the project
+	sharedDir, _ := os.MkdirTemp("", "shared")
+	defer os.RemoveAll(sharedDir)
+	newFile(sharedDir, "about.html", "---\ntitle: about\n---\n<p>about</p>").Close()
+	newFile(sharedDir, "logo.svg", "<svg></svg>").Close()
+	os.Symlink(sharedDir, filepath.Join(config.SrcDir, "shared"))
+	os.Symlink(filepath.Join(sharedDir, "logo.svg"), filepath.Join(config.SrcDir, "logo.svg"))
+	// a link back to the src dir shouldn't cause an endless loop
+	os.Symlink(config.SrcDir, filepath.Join(sharedDir, "loop"))
+	os.Symlink(filepath.Join(sharedDir, "missing.html"), filepath.Join(config.SrcDir, "broken.html"))
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "shared", "about", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<html><head></head><body><p>about</p></body></html>")
+	_, err = os.Stat(filepath.Join(config.TargetDir, "shared", "logo.svg"))
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "logo.svg"))
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "shared", "loop"))
+	assert(t, os.IsNotExist(err))
+
+	config.FollowSymlinks = false
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, "shared"))
+	assert(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(config.TargetDir, "logo.svg"))
+	assert(t, os.IsNotExist(err))
+}
+
+func TestStaticDir(t *testing.T) {
+	projectDir := newProject().RootDir
+	defer os.RemoveAll(projectDir)
+	os.MkdirAll(filepath.Join(projectDir, "static"), DIR_RWE_MODE)
+	newFile(filepath.Join(projectDir, "static"), "robots.txt", "User-agent: *").Close()
+
+	// the static dir is only used when configured
+	conf, err := config.LoadEnv(projectDir, "", nil)
+	assertEqual(t, err, nil)
+	assertEqual(t, conf.StaticDir, "")
+	site, err := Load(*conf)
+	assertEqual(t, err, nil)
+	assertEqual(t, site.Build(), nil)
+	_, err = os.Stat(filepath.Join(conf.TargetDir, "robots.txt"))
+	assert(t, os.IsNotExist(err))
+	conf, err = config.LoadEnv(projectDir, "", []string{"static_dir=static"})
+	assertEqual(t, err, nil)
+	assertEqual(t, conf.StaticDir, filepath.Join(projectDir, "static"))
+	config := conf
+	os.Remove(filepath.Join(config.StaticDir, "robots.txt"))
+
+	os.MkdirAll(filepath.Join(config.StaticDir, "video"), DIR_RWE_MODE)
+	// files that look like templates are copied verbatim
+	newFile(filepath.Join(config.StaticDir, "video"), "notes.html", "---\ntitle: not parsed\n---\n<p>{{ page.title }}</p>").Close()
+	newFile(config.StaticDir, ".hidden", "secret").Close()
+	newFile(config.SrcDir, "index.html", "---\n---\n{% for file in site.static_files %}{{ file.path }} {% endfor %}").Close()
+
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "video", "notes.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "---\ntitle: not parsed\n---\n<p>{{ page.title }}</p>")
+	_, err = os.Stat(filepath.Join(config.TargetDir, ".hidden"))
+	assert(t, os.IsNotExist(err))
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "video/notes.html")
+
+	// a src file can't be overridden by the static dir
+	newFile(config.SrcDir, "robots.txt", "User-agent: *").Close()
+	newFile(config.StaticDir, "robots.txt", "User-agent: *").Close()
+	_, err = Load(*config)
+	assert(t, err != nil)
+}
+
+func TestLocalizeRemoteAssets(t *testing.T) {
+	t.Setenv("JORGE_CACHE_DIR", t.TempDir())
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/missing.png" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	config.LocalizeRemoteAssets = true
+	content := fmt.Sprintf(`<img src="%s/photo.png"/><img src="%s/photo.png"/><img src="%s/missing.png"/>`, server.URL, server.URL, server.URL)
+	newFile(config.SrcDir, "a.html", "---\n---\n"+content).Close()
+	newFile(config.SrcDir, "b.html", "---\n---\n"+content).Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	entries, err := os.ReadDir(filepath.Join(config.TargetDir, "assets", "remote"))
+	assertEqual(t, err, nil)
+	assertEqual(t, len(entries), 1)
+	localPath := "/assets/remote/" + entries[0].Name()
+	assertEqual(t, filepath.Ext(localPath), ".png")
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "a", "index.html"))
+	assertEqual(t, err, nil)
+	// unavailable assets keep their remote url
+	assertEqual(t, string(output), fmt.Sprintf(`<html><head></head><body><img src="%s"/><img src="%s"/><img src="%s/missing.png"/></body></html>`, localPath, localPath, server.URL))
+	// downloaded once for all the pages
+	assertEqual(t, requests.Load(), int32(2))
+
+	// cached copies are used in the next build
+	site, err = Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+	_, err = os.Stat(filepath.Join(config.TargetDir, filepath.FromSlash(localPath)))
+	assertEqual(t, err, nil)
+	assertEqual(t, requests.Load(), int32(3))
+}
+
+func TestProxyRemoteAssets(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	config.ProxyRemoteAssets = true
+	newFile(config.SrcDir, "a.html", `---
+---
+<img src="https://example.com/photo.png"/>`).Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "a", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html><head></head><body><img src="/_proxy/https://example.com/photo.png"/></body></html>`)
+	// only the urls found in the site can be requested through the proxy
+	assert(t, IsProxiedAsset("https://example.com/photo.png"))
+	assert(t, !IsProxiedAsset("http://169.254.169.254/latest/meta-data"))
+}
+
+func TestConfigEnvironments(t *testing.T) {
+	projectDir := newProject().RootDir
+	defer os.RemoveAll(projectDir)
+
+	newFile(projectDir, "config.yml", `url: https://olano.dev
+analytics:
+  id: main
+  enabled: false
+`).Close()
+	newFile(projectDir, "config.staging.yml", `url: https://staging.olano.dev
+analytics:
+  enabled: true
+`).Close()
+	newFile(filepath.Join(projectDir, "src"), "index.html", `---
+---
+{{ site.config.env }} {{ site.config.url }} {{ site.config.analytics.id }} {{ site.config.analytics.enabled }}`).Close()
+
+	render := func(config *config.Config) string {
+		site, err := Load(*config)
+		assertEqual(t, err, nil)
+		output, err := site.render(site.templates[filepath.Join(config.SrcDir, "index.html")])
+		assertEqual(t, err, nil)
+		return string(output)
+	}
+
+	conf, err := config.LoadEnv(projectDir, "staging", nil)
+	assertEqual(t, err, nil)
+	assertEqual(t, conf.SiteUrl, "https://staging.olano.dev")
+	assertEqual(t, render(conf), "staging https://staging.olano.dev main true")
+
+	// the prod environment doesn't need an overlay
+	conf, err = config.LoadEnv(projectDir, "", nil)
+	assertEqual(t, err, nil)
+	assertEqual(t, render(conf), "prod https://olano.dev main false")
+
+	t.Setenv(config.ENV_VARIABLE, "staging")
+	conf, err = config.Load(projectDir)
+	assertEqual(t, err, nil)
+	assertEqual(t, conf.Env, "staging")
+
+	_, err = config.LoadEnv(projectDir, "qa", nil)
+	assert(t, err != nil)
+	_, err = config.LoadEnv(projectDir, "../other", nil)
+	assert(t, err != nil)
+}
+
+func TestUrlRewrites(t *testing.T) {
+	projectDir := newProject().RootDir
+	defer os.RemoveAll(projectDir)
+
+	// only applied in production builds
+	newFile(projectDir, "config.prod.yml", `url_rewrites:
+  - prefix: /media/
+    replace: https://cdn.olano.dev/media/
+  - pattern: ^/downloads/(.+)\.zip$
+    replace: https://dl.olano.dev/$1.zip
+`).Close()
+	newFile(filepath.Join(projectDir, "src"), "index.html", `---
+---
+<html><head></head><body><img src="/media/photo.jpg" srcset="/media/photo.jpg 1x, /media/photo@2x.jpg 2x"/>
+<a href="/downloads/book.zip">book</a> <a href="/downloads/">downloads</a> <a href="/about/media/">media</a></body></html>`).Close()
+
+	conf, err := config.LoadEnv(projectDir, "", nil)
+	assertEqual(t, err, nil)
+	conf.Minify = false
+	site, err := Load(*conf)
+	assertEqual(t, err, nil)
+	err = site.Build()
+	assertEqual(t, err, nil)
+	output, err := os.ReadFile(filepath.Join(conf.TargetDir, "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html><head></head><body><img src="https://cdn.olano.dev/media/photo.jpg" srcset="https://cdn.olano.dev/media/photo.jpg 1x, https://cdn.olano.dev/media/photo@2x.jpg 2x"/>
+<a href="https://dl.olano.dev/book.zip">book</a> <a href="/downloads/">downloads</a> <a href="/about/media/">media</a></body></html>`)
+
+	_, err = config.LoadEnv(projectDir, "", []string{"url_rewrites=[{prefix: /media/}]"})
+	assert(t, err != nil)
+}
+
+func TestAliases(t *testing.T) {
+	config := newProject()
+	defer os.RemoveAll(config.RootDir)
+	config.SiteUrl = "https://olano.dev"
+	config.AliasLinks = true
+
+	os.Mkdir(filepath.Join(config.SrcDir, "blog"), DIR_RWE_MODE)
+	newFile(filepath.Join(config.SrcDir, "blog"), "new-title.html", `---
+title: new title
+date: 2024-02-01
+aliases: [/blog/old-title, 2023/old-title.html]
+---
+<html><head></head><body>new</body></html>`).Close()
+	newFile(config.SrcDir, "moved.html", `---
+---
+{{ site.aliases["/blog/old-title"] }}`).Close()
+
+	site, err := Load(*config)
+	assertEqual(t, err, nil)
+	post := site.templates[filepath.Join(config.SrcDir, "blog", "new-title.html")]
+	assertEqual(t, post.Metadata["aliases"].([]interface{})[0], "/blog/old-title")
+	assertEqual(t, post.Metadata["aliases"].([]interface{})[1], "/2023/old-title.html")
+	assertEqual(t, site.aliases["/2023/old-title.html"], "/blog/new-title")
+
+	err = site.Build()
+	assertEqual(t, err, nil)
+
+	output, err := os.ReadFile(filepath.Join(config.TargetDir, "moved", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), "<html><head></head><body>/blog/new-title</body></html>")
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "blog", "old-title", "index.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<meta http-equiv="refresh" content="0; url=/blog/new-title">`))
+	assert(t, strings.Contains(string(output), `<link rel="canonical" href="https://olano.dev/blog/new-title">`))
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "2023", "old-title.html"))
+	assertEqual(t, err, nil)
+	assert(t, strings.Contains(string(output), `<meta http-equiv="refresh" content="0; url=/blog/new-title">`))
+
+	output, err = os.ReadFile(filepath.Join(config.TargetDir, "blog", "new-title", "index.html"))
+	assertEqual(t, err, nil)
+	assertEqual(t, string(output), `<html><head><link rel="alternate" href="https://olano.dev/blog/old-title"/><link rel="alternate" href="https://olano.dev/2023/old-title.html"/></head><body>new</body></html>`)
+
+	// aliases can't replace other pages
+	newFile(config.SrcDir, "about.html", `---
+aliases: /blog/new-title
+---
+about`).Close()
+	_, err = Load(*config)
+	assert(t, err != nil)
+	assert(t, strings.Contains(err.Error(), "alias /blog/new-title of "))
+}
+
 func newProject() *config.Config {
 	projectDir, _ := os.MkdirTemp("", "root")
 	layoutsDir := filepath.Join(projectDir, "layouts")
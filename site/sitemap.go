@@ -0,0 +1,133 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/facundoolano/jorge/markup"
+	"github.com/osteele/liquid/render"
+)
+
+// Build the hierarchy of the site html pages and posts, by directory, available to templates as
+// `site.tree`. Each node has the directory `name` and `path`, the `title` and `url` of its index page,
+// if any, its `pages`, in the same order as site.posts and site.pages, and its `children` directories.
+func (site *Site) buildTree() map[string]interface{} {
+	root := newTreeNode("/")
+	nodes := map[string]map[string]interface{}{"/": root}
+
+	// return the node of the given dir, creating it and its ancestors if necessary
+	var findNode func(dir string) map[string]interface{}
+	findNode = func(dir string) map[string]interface{} {
+		if node, ok := nodes[dir]; ok {
+			return node
+		}
+		node := newTreeNode(dir)
+		nodes[dir] = node
+		parent := findNode(filepath.Dir(dir))
+		parent["children"] = append(parent["children"].([]map[string]interface{}), node)
+		return node
+	}
+
+	pageDir := func(page map[string]interface{}) string {
+		return filepath.Clean(page["dir"].(string))
+	}
+	isHtml := func(page map[string]interface{}) bool {
+		return filepath.Ext(page["path"].(string)) == ".html"
+	}
+
+	for _, page := range slices.Concat(site.posts, site.pages) {
+		if isHtml(page) {
+			node := findNode(pageDir(page))
+			node["pages"] = append(node["pages"].([]map[string]interface{}), page)
+		}
+	}
+
+	// index pages aren't included in site.pages, they are used as the title of their directory
+	for _, templ := range site.templates {
+		name := strings.TrimSuffix(filepath.Base(templ.SrcPath), filepath.Ext(templ.SrcPath))
+		if name != "index" || !isHtml(templ.Metadata) || (templ.IsDraft() && !site.config.IncludeDrafts) {
+			continue
+		}
+		node := findNode(pageDir(templ.Metadata))
+		node["url"] = templ.Metadata["url"]
+		if title, ok := templ.Metadata["title"]; ok && title != nil {
+			// the front matter can have non string titles, like `title: 2024`
+			node["title"] = fmt.Sprint(title)
+		}
+	}
+
+	for _, node := range nodes {
+		slices.SortFunc(node["children"].([]map[string]interface{}), func(a, b map[string]interface{}) int {
+			return strings.Compare(a["path"].(string), b["path"].(string))
+		})
+	}
+	return root
+}
+
+func newTreeNode(dir string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     filepath.Base(dir),
+		"path":     dir,
+		"title":    filepath.Base(dir),
+		"pages":    []map[string]interface{}{},
+		"children": []map[string]interface{}{},
+	}
+}
+
+// Register the site_map tag, which outputs site.tree as nested html lists of links, with the dates of posts,
+// e.g. for an "all pages" index in the footer.
+func (site *Site) loadSiteMapTag() {
+	site.templateEngine.RegisterTag("site_map", func(rc render.Context) (string, error) {
+		if site.tree == nil {
+			// rendering post previews, before the templates are loaded
+			return "", nil
+		}
+		var output strings.Builder
+		if err := site.writeTreeNode(&output, site.tree); err != nil {
+			return "", err
+		}
+		return markup.RawOutput(rc, output.String()), nil
+	})
+}
+
+func (site *Site) writeTreeNode(output *strings.Builder, node map[string]interface{}) error {
+	output.WriteString(`<ul class="site-map">`)
+	for _, page := range node["pages"].([]map[string]interface{}) {
+		title, ok := page["title"].(string)
+		if !ok {
+			title = page["url"].(string)
+		}
+		url, err := markup.RelativeUrl(site.config.BaseUrl, page["url"].(string))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(output, `<li><a href="%s">%s</a>`, html.EscapeString(url), html.EscapeString(title))
+		if date, ok := page["date"].(time.Time); ok {
+			fmt.Fprintf(output, ` <time datetime="%s">%s</time>`, date.Format(time.DateOnly), date.Format(time.DateOnly))
+		}
+		output.WriteString("</li>")
+	}
+
+	for _, child := range node["children"].([]map[string]interface{}) {
+		title := html.EscapeString(fmt.Sprint(child["title"]))
+		if url, ok := child["url"].(string); ok {
+			url, err := markup.RelativeUrl(site.config.BaseUrl, url)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(output, `<li><a href="%s">%s</a>`, html.EscapeString(url), title)
+		} else {
+			fmt.Fprintf(output, "<li>%s", title)
+		}
+		if err := site.writeTreeNode(output, child); err != nil {
+			return err
+		}
+		output.WriteString("</li>")
+	}
+	output.WriteString("</ul>")
+	return nil
+}
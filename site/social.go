@@ -0,0 +1,58 @@
+package site
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/facundoolano/jorge/markup"
+)
+
+// Social media platforms requirements for link preview images, see e.g.
+// https://developers.facebook.com/docs/sharing/webmasters/images/
+const (
+	SOCIAL_IMAGE_MIN_WIDTH  = 200
+	SOCIAL_IMAGE_MIN_HEIGHT = 200
+	// wider or taller images get cropped in previews
+	SOCIAL_IMAGE_MIN_RATIO = 1.0
+	SOCIAL_IMAGE_MAX_RATIO = 2.0
+	SOCIAL_IMAGE_MAX_BYTES = 5 * 1024 * 1024
+)
+
+// Print a warning for each local og:image or twitter:image of the given html page that doesn't
+// meet the usual platform requirements, since those would silently result in broken link previews.
+func (site *Site) checkSocialImages(templ *markup.Template, targetPath string, content []byte) {
+	for _, src := range markup.SocialImages(bytes.NewReader(content)) {
+		srcPath, ok := site.localImagePath(targetPath, src)
+		if !ok {
+			continue
+		}
+		if problem := socialImageProblem(srcPath); problem != "" {
+			fmt.Printf("warning: %s: social image %s %s\n", templ.SrcPath, src, problem)
+		}
+	}
+}
+
+// Return a description of the reason why the image at the given path is not suitable
+// for link previews, or an empty string if it is.
+func socialImageProblem(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "not found"
+	}
+	if info.Size() > SOCIAL_IMAGE_MAX_BYTES {
+		return fmt.Sprintf("is too large (%dKB, max %dKB)", info.Size()/1024, SOCIAL_IMAGE_MAX_BYTES/1024)
+	}
+
+	width, height, err := markup.ImageDimensions(path)
+	if err != nil {
+		return "is not a supported image format (use png, jpeg or gif)"
+	}
+	if width < SOCIAL_IMAGE_MIN_WIDTH || height < SOCIAL_IMAGE_MIN_HEIGHT {
+		return fmt.Sprintf("is too small (%dx%d, min %dx%d)", width, height, SOCIAL_IMAGE_MIN_WIDTH, SOCIAL_IMAGE_MIN_HEIGHT)
+	}
+	if ratio := float64(width) / float64(height); ratio < SOCIAL_IMAGE_MIN_RATIO || ratio > SOCIAL_IMAGE_MAX_RATIO {
+		return fmt.Sprintf("has a %.2f:1 aspect ratio, it will be cropped (use between %.0f:1 and %.0f:1)", ratio, SOCIAL_IMAGE_MIN_RATIO, SOCIAL_IMAGE_MAX_RATIO)
+	}
+	return ""
+}
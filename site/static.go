@@ -0,0 +1,80 @@
+package site
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Register the files in the static dir, which are copied to the same location in the target dir
+// without being opened to look for front matter or processed in any way, so large binary assets
+// don't slow down the build. They are listed along the src static files in `site.static_files`.
+func (site *Site) loadPassthroughFiles() error {
+	if site.config.StaticDir == "" {
+		return nil
+	}
+	if _, err := os.Stat(site.config.StaticDir); err != nil {
+		return fmt.Errorf("invalid static_dir: %w", err)
+	}
+
+	return WalkSource(&site.config, site.config.StaticDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// dot files are left out as in src
+		isDotFile := path != site.config.StaticDir && strings.HasPrefix(filepath.Base(path), ".")
+		if isDotFile || site.config.IsIgnored(path, entry.IsDir()) {
+			return skipEntry(entry)
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(site.config.StaticDir, path)
+		if _, err := os.Stat(filepath.Join(site.config.SrcDir, relPath)); err == nil {
+			return fmt.Errorf("%s conflicts with a src file at the same path", path)
+		}
+		site.passthrough[path] = relPath
+		site.static_files = append(site.static_files, map[string]interface{}{
+			"path":     relPath,
+			"name":     filepath.Base(relPath),
+			"basename": strings.TrimSuffix(filepath.Base(relPath), filepath.Ext(relPath)),
+			"extname":  filepath.Ext(relPath),
+		})
+		return nil
+	})
+}
+
+// Create the directories of the static dir files at the target and send the files to the build workers.
+func (site *Site) sendPassthroughFiles(ctx context.Context, workers *buildWorkers) error {
+	for path, relPath := range site.passthrough {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		targetDir := filepath.Dir(filepath.Join(site.config.TargetDir, relPath))
+		if err := os.MkdirAll(targetDir, DIR_RWE_MODE); err != nil {
+			return err
+		}
+		workers.files <- path
+	}
+	return nil
+}
+
+// Copy the given static dir file to the target, without any post-processing.
+func (site *Site) copyPassthrough(path string, relPath string) error {
+	targetPath := filepath.Join(site.config.TargetDir, relPath)
+	if site.config.LinkStatic {
+		abs, _ := filepath.Abs(path)
+		return checkFileError(os.Symlink(abs, targetPath))
+	}
+
+	srcFile, err := os.Open(path)
+	if err != nil {
+		return checkFileError(err)
+	}
+	defer srcFile.Close()
+	return site.writeToFile(targetPath, srcFile)
+}
@@ -0,0 +1,76 @@
+package site
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/facundoolano/jorge/config"
+)
+
+// Walk the file tree at root like filepath.WalkDir, but following symbolic links to files and
+// directories, e.g. to share content between sites, with their paths under root. Directories already
+// visited through another link are skipped to prevent cycles. If the follow_symlinks config is
+// disabled, links are skipped instead.
+func WalkSource(config *config.Config, root string, fn fs.WalkDirFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkSourceEntry(config, root, fs.FileInfoToDirEntry(info), fn, make(map[string]bool))
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkSourceEntry(config *config.Config, path string, entry fs.DirEntry, fn fs.WalkDirFunc, visited map[string]bool) error {
+	if entry.Type()&fs.ModeSymlink != 0 {
+		if !config.FollowSymlinks {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Println("skipping broken link", path)
+			return nil
+		}
+		entry = fs.FileInfoToDirEntry(info)
+	}
+	if !entry.IsDir() {
+		return fn(path, entry, nil)
+	}
+
+	if realPath, err := filepath.EvalSymlinks(path); err == nil {
+		if visited[realPath] {
+			return nil
+		}
+		visited[realPath] = true
+	}
+	if err := fn(path, entry, nil); err != nil {
+		if errors.Is(err, filepath.SkipDir) {
+			return nil
+		}
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if err := fn(path, entry, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+			return err
+		}
+		return nil
+	}
+	for _, child := range entries {
+		err := walkSourceEntry(config, filepath.Join(path, child.Name()), child, fn, visited)
+		if errors.Is(err, filepath.SkipDir) {
+			// returned for a file, skip the rest of the directory
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}